@@ -4,13 +4,19 @@
 package atom
 
 import (
+	"bytes"
 	"encoding/xml"
 	"io"
+	"io/ioutil"
+	"log"
 	"net/url"
+	"strings"
 
 	"hawx.me/code/riviera/feed/common"
 )
 
+const atomNamespace = "http://www.w3.org/2005/Atom"
+
 // Parser is capable of reading Atom feeds.
 type Parser struct{}
 
@@ -27,7 +33,7 @@ func (Parser) CanRead(r io.Reader, charset func(charset string, input io.Reader)
 			break
 		}
 		if t, ok := token.(xml.StartElement); ok {
-			if t.Name.Space == "http://www.w3.org/2005/Atom" && t.Name.Local == "feed" {
+			if t.Name.Space == atomNamespace && t.Name.Local == "feed" {
 				return true
 			}
 			break
@@ -38,7 +44,12 @@ func (Parser) CanRead(r io.Reader, charset func(charset string, input io.Reader)
 }
 
 func (Parser) Read(r io.Reader, _ *url.URL, charset func(charset string, input io.Reader) (io.Reader, error)) (foundChannels []*common.Channel, err error) {
-	decoder := xml.NewDecoder(r)
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
 	decoder.CharsetReader = charset
 
 	var feed atomFeed
@@ -127,6 +138,11 @@ func (Parser) Read(r io.Reader, _ *url.URL, charset func(charset string, input i
 				Base: entry.Content.Base,
 				Text: entry.Content.Text,
 			}
+
+			// xhtml content is markup, rather than escaped text
+			if entry.Content.Type == "xhtml" {
+				i.Content.Text = strings.TrimSpace(entry.Content.InnerXML)
+			}
 		}
 
 		if len(entry.Authors) > 0 {
@@ -153,10 +169,75 @@ func (Parser) Read(r io.Reader, _ *url.URL, charset func(charset string, input i
 		ch.Items = append(ch.Items, i)
 	}
 
+	// extensions are extra, so the feed is still read if they can not be
+	if err := readExtensions(data, charset, ch); err != nil {
+		log.Printf("atom: could not read extensions: %v\n", err)
+	}
+	ch.ReadPodcasts()
+
 	foundChannels = append(foundChannels, ch)
 	return
 }
 
+// readExtensions adds the elements not in the Atom namespace, within the feed
+// and its entries, to the Extensions of ch.
+func readExtensions(data []byte, charset func(charset string, input io.Reader) (io.Reader, error), ch *common.Channel) error {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = charset
+
+	// depth is the number of Atom elements that contain the current token, entry
+	// is true when one of them is an entry
+	depth := 0
+	entry := false
+	item := -1
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			inFeed := depth == 1
+			inEntry := depth == 2 && entry && item < len(ch.Items)
+
+			if t.Name.Space != atomNamespace && (inFeed || inEntry) {
+				ext, err := common.DecodeExtension(decoder, t)
+				if err != nil {
+					return err
+				}
+
+				if inEntry {
+					ch.Items[item].Extensions = common.AddExtension(ch.Items[item].Extensions, t.Name.Space, ext)
+				} else {
+					ch.Extensions = common.AddExtension(ch.Extensions, t.Name.Space, ext)
+				}
+				continue
+			}
+
+			if inFeed && t.Name.Local == "entry" {
+				entry = true
+				item++
+			}
+			depth++
+
+		case xml.EndElement:
+			depth--
+			if depth == 1 {
+				entry = false
+			}
+			// anything after the end of the document is ignored, as by Decode
+			if depth == 0 {
+				return nil
+			}
+		}
+	}
+}
+
 // The "atom:feed" element is the document (i.e., top-level) element of an Atom
 // Feed Document, acting as a container for metadata and data associated with
 // the feed.  Its element children consist of metadata elements followed by zero
@@ -352,8 +433,9 @@ type atomCategory struct {
 // The "atom:content" element either contains or links to the content of the
 // entry.  The content of atom:content is Language-Sensitive.
 type atomContent struct {
-	Type string `xml:"type,attr"`
-	Lang string `xml:"xml lang,attr"`
-	Base string `xml:"xml base,attr"`
-	Text string `xml:",chardata"`
+	Type     string `xml:"type,attr"`
+	Lang     string `xml:"xml lang,attr"`
+	Base     string `xml:"xml base,attr"`
+	Text     string `xml:",chardata"`
+	InnerXML string `xml:",innerxml"`
 }
@@ -2,6 +2,7 @@ package atom
 
 import (
 	"os"
+	"strings"
 	"testing"
 
 	"hawx.me/code/assert"
@@ -77,3 +78,86 @@ func TestMediaExtensions(t *testing.T) {
 		}
 	}
 }
+
+func TestExtensions(t *testing.T) {
+	assert := assert.New(t)
+
+	file, _ := os.Open("testdata/extension.atom")
+	defer file.Close()
+
+	channels, err := Parser{}.Read(file, nil, nil)
+	if !assert.Nil(err) || !assert.Len(channels, 1) {
+		return
+	}
+
+	channel := channels[0]
+
+	dc := channel.Extensions["http://purl.org/dc/elements/1.1/"]
+	if assert.Len(dc["rights"], 1) {
+		assert.Equal("Some rights reserved", dc["rights"][0].Value)
+	}
+	assert.Len(channel.Extensions, 1)
+
+	if assert.Len(channel.Items, 2) {
+		item := channel.Items[0]
+
+		subjects := item.Extensions["http://purl.org/dc/elements/1.1/"]["subject"]
+		if assert.Len(subjects, 2) {
+			assert.Equal("Testing", subjects[0].Value)
+			assert.Equal("Examples", subjects[1].Value)
+		}
+
+		comments := item.Extensions["http://purl.org/rss/1.0/modules/slash/"]["comments"]
+		if assert.Len(comments, 1) {
+			assert.Equal("12", comments[0].Value)
+		}
+
+		where := item.Extensions["http://www.georss.org/georss"]["where"]
+		if assert.Len(where, 1) {
+			assert.Equal("45.256 -71.92", where[0].Childrens["point"][0].Value)
+		}
+
+		assert.Len(item.Extensions, 3)
+		assert.Nil(channel.Items[1].Extensions)
+	}
+}
+
+func TestContent(t *testing.T) {
+	assert := assert.New(t)
+
+	file, _ := os.Open("testdata/content.atom")
+	defer file.Close()
+
+	channels, err := Parser{}.Read(file, nil, nil)
+	if !assert.Nil(err) || !assert.Len(channels, 1) {
+		return
+	}
+
+	if items := channels[0].Items; assert.Len(items, 2) {
+		assert.Equal("html", items[0].Content.Type)
+		assert.Equal("<p>Some <em>html</em></p>", items[0].Content.Text)
+
+		assert.Equal("xhtml", items[1].Content.Type)
+		assert.Equal(`<div xmlns="http://www.w3.org/1999/xhtml"><p>Some <em>xhtml</em></p></div>`, items[1].Content.Text)
+	}
+}
+
+func TestExtensionsWithTrailingContent(t *testing.T) {
+	assert := assert.New(t)
+
+	channels, err := Parser{}.Read(strings.NewReader(`<feed xmlns="http://www.w3.org/2005/Atom" xmlns:dc="http://purl.org/dc/elements/1.1/">
+  <title>Test</title>
+  <entry><title>One</title><dc:creator>Someone</dc:creator></entry>
+</feed>
+</oops> <more`), nil, nil)
+	if !assert.Nil(err) || !assert.Len(channels, 1) {
+		return
+	}
+
+	if assert.Len(channels[0].Items, 1) {
+		creator := channels[0].Items[0].Extensions["http://purl.org/dc/elements/1.1/"]["creator"]
+		if assert.Len(creator, 1) {
+			assert.Equal("Someone", creator[0].Value)
+		}
+	}
+}
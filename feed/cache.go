@@ -0,0 +1,114 @@
+package feed
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxCacheDelay is the longest that caching headers can delay an update for.
+const maxCacheDelay = 24 * time.Hour
+
+// CacheHeaders are the headers of a response that affect when a feed is next
+// updated.
+type CacheHeaders struct {
+	CacheControl string
+	Expires      string
+	RetryAfter   string
+}
+
+// CacheHeaders returns the caching headers of the last response to Fetch.
+// Retry-After is only given when the status was 429 or 503.
+func (f *Feed) CacheHeaders() CacheHeaders {
+	return f.cacheHeaders
+}
+
+// readCacheHeaders records the caching headers of resp, and the time they ask
+// for the feed not to be fetched before.
+func (f *Feed) readCacheHeaders(resp *http.Response, now time.Time) {
+	f.cacheHeaders = CacheHeaders{
+		CacheControl: resp.Header.Get("Cache-Control"),
+		Expires:      resp.Header.Get("Expires"),
+	}
+
+	var wait time.Duration
+	if age, ok := maxAge(resp.Header); ok {
+		wait = age
+	} else if date, ok := expires(resp.Header); ok {
+		wait = date.Sub(now)
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		f.cacheHeaders.RetryAfter = resp.Header.Get("Retry-After")
+
+		if retry, ok := retryAfter(resp.Header, now); ok && retry > wait {
+			wait = retry
+		}
+	}
+
+	if wait > maxCacheDelay {
+		wait = maxCacheDelay
+	}
+
+	f.notBefore = time.Time{}
+	if wait > 0 {
+		f.notBefore = now.Add(wait)
+	}
+}
+
+// maxAge returns the max-age directive of the Cache-Control header, if given.
+func maxAge(header http.Header) (time.Duration, bool) {
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		parts := strings.SplitN(strings.TrimSpace(directive), "=", 2)
+		if len(parts) != 2 || !strings.EqualFold(parts[0], "max-age") {
+			continue
+		}
+
+		seconds, err := strconv.Atoi(strings.Trim(parts[1], `"`))
+		if err != nil || seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	return 0, false
+}
+
+// expires returns the date of the Expires header, if given. Invalid dates, such
+// as "0", mean the response has already expired so are returned as the zero
+// time.
+func expires(header http.Header) (time.Time, bool) {
+	value := strings.TrimSpace(header.Get("Expires"))
+	if value == "" {
+		return time.Time{}, false
+	}
+
+	date, _ := http.ParseTime(value)
+	return date, true
+}
+
+// retryAfter returns how long the Retry-After header asks for the client to
+// wait, if given. The header can either be a number of seconds or a date.
+func retryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if wait := date.Sub(now); wait > 0 {
+		return wait, true
+	}
+	return 0, true
+}
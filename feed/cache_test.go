@@ -0,0 +1,81 @@
+package feed
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMaxAge(t *testing.T) {
+	tests := map[string]time.Duration{
+		"max-age=60":              time.Minute,
+		"public, max-age=3600":    time.Hour,
+		`no-cache, MAX-AGE="120"`: 2 * time.Minute,
+		"s-maxage=60, max-age=0":  0,
+		"no-store":                -1,
+		"max-age=soon":            -1,
+		"":                        -1,
+	}
+
+	for value, expected := range tests {
+		header := http.Header{}
+		header.Set("Cache-Control", value)
+
+		maxAge, ok := maxAge(header)
+		if expected < 0 {
+			if ok {
+				t.Errorf("%q: expected no max-age, got %v", value, maxAge)
+			}
+		} else if !ok || maxAge != expected {
+			t.Errorf("%q: expected %v, got %v", value, expected, maxAge)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC)
+
+	tests := map[string]time.Duration{
+		"120":                           2 * time.Minute,
+		"Wed, 21 Oct 2015 08:28:00 GMT": time.Hour,
+		"Wed, 21 Oct 2015 06:28:00 GMT": 0,
+		"later":                         -1,
+		"":                              -1,
+	}
+
+	for value, expected := range tests {
+		header := http.Header{}
+		header.Set("Retry-After", value)
+
+		wait, ok := retryAfter(header, now)
+		if expected < 0 {
+			if ok {
+				t.Errorf("%q: expected no wait, got %v", value, wait)
+			}
+		} else if !ok || wait != expected {
+			t.Errorf("%q: expected %v, got %v", value, expected, wait)
+		}
+	}
+}
+
+func TestExpires(t *testing.T) {
+	date := time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC)
+
+	tests := map[string]time.Time{
+		"Wed, 21 Oct 2015 07:28:00 GMT": date,
+		"0":                             {},
+	}
+
+	for value, expected := range tests {
+		header := http.Header{}
+		header.Set("Expires", value)
+
+		if got, ok := expires(header); !ok || !got.Equal(expected) {
+			t.Errorf("%q: expected %v, got %v", value, expected, got)
+		}
+	}
+
+	if _, ok := expires(http.Header{}); ok {
+		t.Errorf("expected no Expires")
+	}
+}
@@ -1,8 +1,76 @@
 package common
 
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+)
+
+// An Extension is an element from a namespace that the format of the feed does
+// not define, such as "itunes:author" in an RSS feed. Extensions are stored by
+// their namespace, then by their name, for example:
+//
+//	item.Extensions["http://www.itunes.com/dtds/podcast-1.0.dtd"]["author"]
+//
+// Attrs and Childrens are keyed by their names, ignoring their namespaces.
 type Extension struct {
 	Name      string
 	Value     string
 	Attrs     map[string]string
 	Childrens map[string][]Extension
 }
+
+// DecodeExtension reads the element started by start, and the elements it
+// contains, as an Extension.
+func DecodeExtension(d *xml.Decoder, start xml.StartElement) (Extension, error) {
+	ext := Extension{
+		Name:      start.Name.Local,
+		Attrs:     map[string]string{},
+		Childrens: map[string][]Extension{},
+	}
+
+	for _, attr := range start.Attr {
+		if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+			continue
+		}
+		ext.Attrs[attr.Name.Local] = attr.Value
+	}
+
+	var value bytes.Buffer
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return ext, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			child, err := DecodeExtension(d, t)
+			if err != nil {
+				return ext, err
+			}
+			ext.Childrens[child.Name] = append(ext.Childrens[child.Name], child)
+
+		case xml.CharData:
+			value.Write(t)
+
+		case xml.EndElement:
+			ext.Value = strings.TrimSpace(value.String())
+			return ext, nil
+		}
+	}
+}
+
+// AddExtension adds ext, from the namespace space, to exts. If exts is nil a
+// new map is created and returned.
+func AddExtension(exts map[string]map[string][]Extension, space string, ext Extension) map[string]map[string][]Extension {
+	if exts == nil {
+		exts = map[string]map[string][]Extension{}
+	}
+	if exts[space] == nil {
+		exts[space] = map[string][]Extension{}
+	}
+
+	exts[space][ext.Name] = append(exts[space][ext.Name], ext)
+	return exts
+}
@@ -26,6 +26,9 @@ type Item struct {
 	Source      *Source
 	Title       string
 
+	// Podcast is set for items that are episodes of a podcast.
+	Podcast *Podcast
+
 	// Atom specific fields
 	Content      *Content
 	Contributors []string
@@ -0,0 +1,132 @@
+package common
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Namespaces of the extensions that describe podcasts.
+const (
+	ItunesNamespace  = "http://www.itunes.com/dtds/podcast-1.0.dtd"
+	PodcastNamespace = "https://podcastindex.org/namespace/1.0"
+)
+
+// Podcast describes an item that is an episode of a podcast.
+type Podcast struct {
+	// Duration is the length of the episode in seconds, or 0 if not known.
+	Duration int
+
+	// Image is the artwork for the episode, or for the podcast if the episode
+	// has none.
+	Image string
+
+	// Episode is the number of the episode, or 0 if not known.
+	Episode int
+
+	// Chapters links to the chapters of the episode.
+	Chapters *Chapters
+
+	// Transcripts link to transcripts of the episode.
+	Transcripts []Transcript
+}
+
+type Chapters struct {
+	URL  string
+	Type string
+}
+
+type Transcript struct {
+	URL      string
+	Type     string
+	Language string
+	Rel      string
+}
+
+// ReadPodcasts sets the Podcast of each item in ch from its extensions in the
+// iTunes and Podcasting 2.0 namespaces. Items without any are left alone.
+func (ch *Channel) ReadPodcasts() {
+	image := extensionAttr(ch.Extensions, ItunesNamespace, "image", "href")
+
+	for _, item := range ch.Items {
+		itunes := item.Extensions[ItunesNamespace]
+		podcast := item.Extensions[PodcastNamespace]
+		if itunes == nil && podcast == nil {
+			continue
+		}
+
+		if item.Podcast == nil {
+			item.Podcast = &Podcast{}
+		}
+
+		if v := extensionValue(item.Extensions, ItunesNamespace, "duration"); v != "" {
+			item.Podcast.Duration = ParseDuration(v)
+		}
+		if v := extensionValue(item.Extensions, ItunesNamespace, "episode"); v != "" {
+			item.Podcast.Episode, _ = strconv.Atoi(v)
+		}
+
+		item.Podcast.Image = extensionAttr(item.Extensions, ItunesNamespace, "image", "href")
+		if item.Podcast.Image == "" {
+			item.Podcast.Image = image
+		}
+
+		if chapters := podcast["chapters"]; len(chapters) > 0 {
+			item.Podcast.Chapters = &Chapters{
+				URL:  chapters[0].Attrs["url"],
+				Type: chapters[0].Attrs["type"],
+			}
+		}
+
+		for _, transcript := range podcast["transcript"] {
+			item.Podcast.Transcripts = append(item.Podcast.Transcripts, Transcript{
+				URL:      transcript.Attrs["url"],
+				Type:     transcript.Attrs["type"],
+				Language: transcript.Attrs["language"],
+				Rel:      transcript.Attrs["rel"],
+			})
+		}
+	}
+}
+
+func extensionValue(exts map[string]map[string][]Extension, space, name string) string {
+	if list := exts[space][name]; len(list) > 0 {
+		return list[0].Value
+	}
+
+	return ""
+}
+
+func extensionAttr(exts map[string]map[string][]Extension, space, name, attr string) string {
+	if list := exts[space][name]; len(list) > 0 {
+		return list[0].Attrs[attr]
+	}
+
+	return ""
+}
+
+// ParseDuration reads a duration given as "HH:MM:SS", "MM:SS" or a number of
+// seconds, returning the number of seconds or 0 if it can not be read.
+func ParseDuration(s string) int {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) > 3 {
+		return 0
+	}
+
+	seconds := 0
+	for i, part := range parts {
+		// the last part may have a fraction of a second
+		if i == len(parts)-1 {
+			if p := strings.Index(part, "."); p >= 0 {
+				part = part[:p]
+			}
+		}
+
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return 0
+		}
+		seconds = seconds*60 + n
+	}
+
+	return seconds
+}
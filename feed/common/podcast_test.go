@@ -0,0 +1,24 @@
+package common
+
+import "testing"
+
+func TestParseDuration(t *testing.T) {
+	testcases := map[string]int{
+		"1:02:03":  3723,
+		"02:03":    123,
+		"754":      754,
+		"754.5":    754,
+		" 45 ":     45,
+		"":         0,
+		"an hour":  0,
+		"1:2:3:4":  0,
+		"-5":       0,
+		"01:00:00": 3600,
+	}
+
+	for in, expected := range testcases {
+		if actual := ParseDuration(in); actual != expected {
+			t.Errorf("ParseDuration(%q) = %d, expected %d", in, actual, expected)
+		}
+	}
+}
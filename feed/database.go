@@ -1,14 +1,44 @@
 package feed
 
-import "sync"
+import (
+	"sync"
+	"time"
+)
 
-// A Database allows the Feed to keep track of items it has already seen before.
+// A Database allows the Feed to keep track of items it has already seen before,
+// and the state of its last fetch so that polling can resume after a restart.
 type Database interface {
 	Contains(string) bool
+
+	// State returns the last State saved, or the zero State if none has been.
+	State() State
+
+	// SetState saves the State.
+	SetState(State)
+}
+
+// State is the information kept about the last fetch of a feed.
+type State struct {
+	// ETag and LastModified are the values of the headers returned by the last
+	// successful fetch, they are used to make conditional requests.
+	ETag         string `json:"etag"`
+	LastModified string `json:"lastModified"`
+
+	// LastFetch is the time the feed was last requested.
+	LastFetch time.Time `json:"lastFetch"`
+
+	// TTL is the number of minutes the feed asked to be cached for, by its ttl
+	// element.
+	TTL int `json:"ttl,omitempty"`
+
+	// NotBefore is the time that the caching headers of the last response asked
+	// for the feed not to be requested before.
+	NotBefore time.Time `json:"notBefore"`
 }
 
 type database struct {
 	known map[string]struct{}
+	state State
 	sync.RWMutex
 }
 
@@ -34,3 +64,16 @@ func (d *database) Contains(key string) bool {
 	d.known[key] = struct{}{}
 	return false
 }
+
+func (d *database) State() State {
+	d.RLock()
+	defer d.RUnlock()
+
+	return d.state
+}
+
+func (d *database) SetState(state State) {
+	d.Lock()
+	d.state = state
+	d.Unlock()
+}
@@ -0,0 +1,259 @@
+// Package discover finds the feeds published by a website, so that a page such
+// as a blog's homepage can be subscribed to.
+package discover
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+	"hawx.me/code/riviera/feed"
+)
+
+// ErrNoFeeds is returned when a page links to no feeds, and is not one itself.
+var ErrNoFeeds = errors.New("no feeds found")
+
+// A Feed is a candidate feed found for a page.
+type Feed struct {
+	URL   string `json:"url"`
+	Title string `json:"title,omitempty"`
+	Type  string `json:"type,omitempty"`
+}
+
+// feedTypes are the types of link that point to feeds, in the order they are
+// preferred.
+var feedTypes = []string{
+	"application/atom+xml",
+	"application/rss+xml",
+	"application/feed+json",
+}
+
+// wellKnownPaths are tried, in order, when a page does not link to any feeds.
+var wellKnownPaths = []string{
+	"/feed",
+	"/rss",
+	"/atom.xml",
+	"/feed.xml",
+	"/rss.xml",
+	"/index.xml",
+	"/feed.json",
+}
+
+// maxSize limits how much of a page is read.
+const maxSize = 5 << 20
+
+// Discover returns the feeds for the page at uri, best first.
+//
+// If uri is a feed it is returned alone. Otherwise the feeds the page links to
+// with <link rel="alternate"> are returned, Atom being preferred to RSS and RSS
+// to JSON Feed, and feeds of comments coming last. If the page links to none,
+// the first well-known path, such as "/feed", that is a feed is returned, or
+// failing that the page itself if it is marked up as an h-feed.
+func Discover(client *http.Client, uri string) ([]Feed, error) {
+	if u, err := url.Parse(uri); err != nil || !u.IsAbs() {
+		return nil, fmt.Errorf("%s is not an absolute url", uri)
+	}
+
+	page, err := get(client, uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if !page.isHTML() {
+		if page.isFeed() {
+			return []Feed{{URL: uri, Type: page.mediaType}}, nil
+		}
+		return nil, ErrNoFeeds
+	}
+
+	return discoverPage(client, uri, page)
+}
+
+// Resolve returns the url to subscribe to for uri. If uri is a web page this is
+// the best feed found for it by Discover, otherwise it is uri itself, without
+// checking that it can be read as a feed. If the page links to no feeds uri is
+// also returned, along with ErrNoFeeds.
+func Resolve(client *http.Client, uri string) (string, error) {
+	if u, err := url.Parse(uri); err != nil || !u.IsAbs() {
+		return uri, fmt.Errorf("%s is not an absolute url", uri)
+	}
+
+	page, err := get(client, uri)
+	if err != nil {
+		return uri, err
+	}
+
+	if !page.isHTML() {
+		return uri, nil
+	}
+
+	feeds, err := discoverPage(client, uri, page)
+	if err != nil {
+		return uri, err
+	}
+
+	return feeds[0].URL, nil
+}
+
+// discoverPage returns the feeds for the web page at uri, which has been
+// fetched.
+func discoverPage(client *http.Client, uri string, page *response) ([]Feed, error) {
+	if feeds := links(page.body, page.url); len(feeds) > 0 {
+		rank(feeds)
+		return feeds, nil
+	}
+
+	for _, path := range wellKnownPaths {
+		candidate := page.url.ResolveReference(&url.URL{Path: path}).String()
+
+		found, err := get(client, candidate)
+		if err == nil && !found.isHTML() && found.isFeed() {
+			return []Feed{{URL: candidate, Type: found.mediaType}}, nil
+		}
+	}
+
+	if page.isFeed() {
+		return []Feed{{URL: uri, Type: page.mediaType}}, nil
+	}
+
+	return nil, ErrNoFeeds
+}
+
+type response struct {
+	url       *url.URL
+	mediaType string
+	body      []byte
+}
+
+func get(client *http.Client, uri string) (*response, error) {
+	resp, err := client.Get(uri)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s responded with %d", uri, resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSize))
+	if err != nil {
+		return nil, err
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "" {
+		mediaType, _, _ = mime.ParseMediaType(http.DetectContentType(body))
+	}
+
+	return &response{url: resp.Request.URL, mediaType: mediaType, body: body}, nil
+}
+
+func (r *response) isHTML() bool {
+	return r.mediaType == "text/html" || r.mediaType == "application/xhtml+xml"
+}
+
+func (r *response) isFeed() bool {
+	_, err := feed.Parse(bytes.NewReader(r.body), r.url, charset.NewReaderLabel)
+	return err == nil
+}
+
+// links returns the feeds linked to by the page, resolved against base or the
+// page's <base> element.
+func links(body []byte, base *url.URL) []Feed {
+	var feeds []Feed
+	seen := map[string]bool{}
+
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return feeds
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			if !hasAttr {
+				continue
+			}
+
+			attrs := map[string]string{}
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				attrs[string(key)] = strings.TrimSpace(string(val))
+			}
+
+			switch string(name) {
+			case "base":
+				if href, err := base.Parse(attrs["href"]); err == nil && attrs["href"] != "" {
+					base = href
+				}
+
+			case "link":
+				if !isAlternate(attrs["rel"]) || typeRank(attrs["type"]) < 0 || attrs["href"] == "" {
+					continue
+				}
+
+				href, err := base.Parse(attrs["href"])
+				if err != nil || seen[href.String()] {
+					continue
+				}
+				seen[href.String()] = true
+
+				feeds = append(feeds, Feed{
+					URL:   href.String(),
+					Title: attrs["title"],
+					Type:  strings.ToLower(attrs["type"]),
+				})
+			}
+		}
+	}
+}
+
+func isAlternate(rel string) bool {
+	for _, value := range strings.Fields(rel) {
+		if strings.EqualFold(value, "alternate") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// typeRank returns the position of the type in feedTypes, or -1 if it is not a
+// feed.
+func typeRank(t string) int {
+	t = strings.ToLower(strings.TrimSpace(t))
+	for i, feedType := range feedTypes {
+		if t == feedType {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func isComments(f Feed) bool {
+	return strings.Contains(strings.ToLower(f.Title+" "+f.URL), "comment")
+}
+
+// rank orders the feeds so that the best is first, keeping the order of the
+// page otherwise.
+func rank(feeds []Feed) {
+	sort.SliceStable(feeds, func(i, j int) bool {
+		if a, b := isComments(feeds[i]), isComments(feeds[j]); a != b {
+			return b
+		}
+
+		return typeRank(feeds[i].Type) < typeRank(feeds[j].Type)
+	})
+}
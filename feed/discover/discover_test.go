@@ -0,0 +1,132 @@
+package discover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const rssFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+  <channel>
+    <title>Blog</title>
+    <item><title>Hello</title><guid>1</guid></item>
+  </channel>
+</rss>`
+
+func TestDiscoverLinks(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<!DOCTYPE html>
+<html>
+  <head>
+    <base href="/blog/">
+    <link rel="alternate" type="application/json" href="/wp-json/wp/v2/pages/2">
+    <link rel="alternate" type="application/rss+xml" title="Comments" href="comments/feed">
+    <link rel="alternate" type="application/rss+xml" title="Posts" href="feed">
+    <link rel="stylesheet" type="text/css" href="style.css">
+    <link rel="alternate" type="application/feed+json" href="feed.json">
+    <link rel="Alternate" type="application/atom+xml" title="Atom" href="https://example.com/atom">
+    <link rel="alternate" type="application/rss+xml" href="/blog/feed">
+  </head>
+  <body></body>
+</html>`))
+	}))
+	defer s.Close()
+
+	feeds, err := Discover(http.DefaultClient, s.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, []Feed{
+		{URL: "https://example.com/atom", Title: "Atom", Type: "application/atom+xml"},
+		{URL: s.URL + "/blog/feed", Title: "Posts", Type: "application/rss+xml"},
+		{URL: s.URL + "/blog/feed.json", Type: "application/feed+json"},
+		{URL: s.URL + "/blog/comments/feed", Title: "Comments", Type: "application/rss+xml"},
+	}, feeds)
+}
+
+func TestDiscoverWellKnownPath(t *testing.T) {
+	mux := http.NewServeMux()
+	// some sites serve their homepage for any path
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body>Home</body></html>`))
+	})
+	mux.HandleFunc("/feed.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(rssFeed))
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	feeds, err := Discover(http.DefaultClient, s.URL+"/")
+	assert.Nil(t, err)
+	assert.Equal(t, []Feed{{URL: s.URL + "/feed.xml", Type: "application/rss+xml"}}, feeds)
+}
+
+func TestDiscoverFeed(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(rssFeed))
+	}))
+	defer s.Close()
+
+	feeds, err := Discover(http.DefaultClient, s.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, []Feed{{URL: s.URL, Type: "text/xml"}}, feeds)
+}
+
+func TestDiscoverNoFeeds(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`<html><body>Nothing here</body></html>`))
+	}))
+	defer s.Close()
+
+	_, err := Discover(http.DefaultClient, s.URL)
+	assert.Equal(t, ErrNoFeeds, err)
+
+	_, err = Discover(http.DefaultClient, s.URL+"/missing")
+	assert.NotNil(t, err)
+
+	_, err = Discover(http.DefaultClient, "/relative")
+	assert.NotNil(t, err)
+}
+
+func TestResolve(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<html><head><link rel="alternate" type="application/rss+xml" href="/rss"></head></html>`))
+		case "/empty":
+			w.Write([]byte(`<html><body>Nothing here</body></html>`))
+		case "/broken.xml":
+			w.Header().Set("Content-Type", "application/rss+xml")
+			w.Write([]byte(`<rss><channel>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+
+	uri, err := Resolve(http.DefaultClient, s.URL+"/")
+	assert.Nil(t, err)
+	assert.Equal(t, s.URL+"/rss", uri)
+
+	// anything other than a web page is given back as it is
+	uri, err = Resolve(http.DefaultClient, s.URL+"/broken.xml")
+	assert.Nil(t, err)
+	assert.Equal(t, s.URL+"/broken.xml", uri)
+
+	uri, err = Resolve(http.DefaultClient, s.URL+"/empty")
+	assert.Equal(t, ErrNoFeeds, err)
+	assert.Equal(t, s.URL+"/empty", uri)
+
+	uri, err = Resolve(http.DefaultClient, s.URL+"/missing")
+	assert.NotNil(t, err)
+	assert.Equal(t, s.URL+"/missing", uri)
+}
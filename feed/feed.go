@@ -29,6 +29,10 @@ type Feed struct {
 	// Custom cache timeout.
 	cacheTimeout time.Duration
 
+	// Time to live given by the feed, when longer than the cache timeout it is
+	// used instead.
+	ttl time.Duration
+
 	// Type of feed. Rss, Atom, etc
 	format string
 
@@ -51,15 +55,36 @@ type Feed struct {
 
 	// The latest value of the ETag header returned from the last fetch.
 	eTag string
+
+	// The latest value of the Last-Modified header returned from the last fetch.
+	lastModified string
+
+	// The caching headers returned from the last fetch.
+	cacheHeaders CacheHeaders
+
+	// Time before which the caching headers ask for the feed not to be fetched.
+	notBefore time.Time
+
+	// Set when the next call to Fetch should ignore the cache timeout.
+	expired bool
 }
 
-// New creates a new feed that can be polled for updates.
+// New creates a new feed that can be polled for updates. If a State has been
+// saved in the database polling continues from it.
 func New(cachetimeout time.Duration, ih ItemHandler, database Database) *Feed {
 	v := new(Feed)
 	v.cacheTimeout = cachetimeout
 	v.format = "none"
 	v.known = database
 	v.itemhandler = ih
+
+	state := database.State()
+	v.eTag = state.ETag
+	v.lastModified = state.LastModified
+	v.lastupdate = state.LastFetch
+	v.notBefore = state.NotBefore
+	v.ttl = time.Minute * time.Duration(state.TTL)
+
 	return v
 }
 
@@ -73,11 +98,15 @@ func New(cachetimeout time.Duration, ih ItemHandler, database Database) *Feed {
 // example the Google App Engine "URL Fetch" service.
 //
 // If the feed is unable to update (see CanUpdate) then no request will be made,
-// instead the result will be (status=-1, err=nil).
+// instead the result will be (status=-1, err=nil). A 304 Not Modified response
+// is successful, but nothing is read. The Cache-Control and Expires headers of
+// the response, and the Retry-After header when the status is 429 or 503, delay
+// the next update.
 func (f *Feed) Fetch(uri string, client *http.Client, charset func(charset string, input io.Reader) (io.Reader, error)) (status int, err error) {
 	if !f.CanUpdate() {
 		return -1, nil
 	}
+	defer f.saveState()
 
 	f.uri, _ = url.Parse(uri)
 
@@ -87,7 +116,9 @@ func (f *Feed) Fetch(uri string, client *http.Client, charset func(charset strin
 	}
 
 	req.Header.Set("User-Agent", userAgent)
-	req.Header.Set("If-Modified-Since", f.lastupdate.Format(time.RFC1123))
+	if f.lastModified != "" {
+		req.Header.Set("If-Modified-Since", f.lastModified)
+	}
 	if f.eTag != "" {
 		req.Header.Set("If-None-Match", f.eTag)
 	}
@@ -98,25 +129,66 @@ func (f *Feed) Fetch(uri string, client *http.Client, charset func(charset strin
 	}
 	defer resp.Body.Close()
 
+	f.readCacheHeaders(resp, time.Now().UTC())
+
+	if resp.StatusCode == http.StatusNotModified {
+		if eTag := resp.Header.Get("ETag"); eTag != "" {
+			f.eTag = eTag
+		}
+		return resp.StatusCode, nil
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		return resp.StatusCode, nil
 	}
 
 	f.eTag = resp.Header.Get("ETag")
+	f.lastModified = resp.Header.Get("Last-Modified")
 
 	return resp.StatusCode, f.load(resp.Body, charset)
 }
 
+// saveState records the state of the last fetch in the database.
+func (f *Feed) saveState() {
+	f.known.SetState(State{
+		ETag:         f.eTag,
+		LastModified: f.lastModified,
+		LastFetch:    f.lastupdate,
+		TTL:          int(f.ttl / time.Minute),
+		NotBefore:    f.notBefore,
+	})
+}
+
+// Load reads feed content that was received without calling Fetch, for
+// instance when it has been pushed by a WebSub hub. Any new items are passed to
+// the ItemHandler as usual.
+func (f *Feed) Load(r io.Reader, charset func(charset string, input io.Reader) (io.Reader, error)) error {
+	return f.load(r, charset)
+}
+
+// Channels returns the channels read by the last successful Fetch or Load.
+func (f *Feed) Channels() []*common.Channel {
+	return f.channels
+}
+
+// Format returns the format the feed was last read in, for example "rss", or
+// "none" if it has not been read.
+func (f *Feed) Format() string {
+	return f.format
+}
+
 func (f *Feed) load(r io.Reader, charset func(charset string, input io.Reader) (io.Reader, error)) (err error) {
-	f.channels, err = Parse(r, f.uri, charset)
+	var format string
+	format, f.channels, err = parse(r, f.uri, charset)
+	if format != "" {
+		f.format = format
+	}
 	if err != nil || len(f.channels) == 0 {
 		return
 	}
 
 	// reset cache timeout values according to feed specified values (TTL)
-	if f.cacheTimeout < time.Minute*time.Duration(f.channels[0].TTL) {
-		f.cacheTimeout = time.Minute * time.Duration(f.channels[0].TTL)
-	}
+	f.ttl = time.Minute * time.Duration(f.channels[0].TTL)
 
 	f.notifyListeners()
 	return
@@ -126,34 +198,44 @@ func (f *Feed) load(r io.Reader, charset func(charset string, input io.Reader) (
 // is not understood.
 var ErrUnsupportedFormat = errors.New("Unsupported feed")
 
-var parsers = []common.Parser{
-	atom.Parser{},
-	rss.Parser{},
-	rdf.Parser{},
-	jsonfeed.Parser{},
-	hfeed.Parser{},
+var parsers = []struct {
+	format string
+	parser common.Parser
+}{
+	{"atom", atom.Parser{}},
+	{"rss", rss.Parser{}},
+	{"rdf", rdf.Parser{}},
+	{"jsonfeed", jsonfeed.Parser{}},
+	{"hfeed", hfeed.Parser{}},
 }
 
 // Parse reads the content from the provided reader, returning any feed channels
 // found. If the feed is of a format not supported it will return
 // ErrUnsupportedFormat.
 func Parse(r io.Reader, rootURL *url.URL, charset func(charset string, input io.Reader) (io.Reader, error)) (chs []*common.Channel, err error) {
+	_, chs, err = parse(r, rootURL, charset)
+	return
+}
+
+// parse is Parse, but also returns the name of the format that was read.
+func parse(r io.Reader, rootURL *url.URL, charset func(charset string, input io.Reader) (io.Reader, error)) (format string, chs []*common.Channel, err error) {
 	data, _ := ioutil.ReadAll(r)
 	br := bytes.NewReader(data)
 
-	for _, parser := range parsers {
-		if parser.CanRead(br, charset) {
+	for _, p := range parsers {
+		if p.parser.CanRead(br, charset) {
 			if _, err := br.Seek(0, io.SeekStart); err != nil {
-				return nil, err
+				return "", nil, err
 			}
-			return parser.Read(br, rootURL, charset)
+			chs, err = p.parser.Read(br, rootURL, charset)
+			return p.format, chs, err
 		}
 		if _, err := br.Seek(0, io.SeekStart); err != nil {
-			return nil, err
+			return "", nil, err
 		}
 	}
 
-	return nil, ErrUnsupportedFormat
+	return "", nil, ErrUnsupportedFormat
 }
 
 func (f *Feed) notifyListeners() {
@@ -180,7 +262,13 @@ func (f *Feed) CanUpdate() bool {
 	// Make sure we are not within the specified cache-limit.
 	// This ensures we don't request data too often.
 	utc := time.Now().UTC()
-	if utc.Sub(f.lastupdate) < f.cacheTimeout {
+	if f.expired {
+		f.expired = false
+		f.lastupdate = utc
+		return true
+	}
+
+	if utc.Sub(f.lastupdate) < f.timeout() || utc.Before(f.notBefore) {
 		return false
 	}
 
@@ -208,8 +296,32 @@ func (f *Feed) CanUpdate() bool {
 	return true
 }
 
+// Expire marks the feed as out of date, so that the next call to Fetch will make
+// a request regardless of the cache timeout. This is useful when a notification
+// has been received saying that the feed has changed.
+func (f *Feed) Expire() {
+	f.expired = true
+}
+
+// timeout returns how long to wait after a fetch before the next, the longer of
+// the cache timeout and the feed's TTL.
+func (f *Feed) timeout() time.Duration {
+	if f.ttl > f.cacheTimeout {
+		return f.ttl
+	}
+
+	return f.cacheTimeout
+}
+
 // DurationTillUpdate returns the number of seconds needed to elapse before the
 // feed should update.
 func (f *Feed) DurationTillUpdate() time.Duration {
-	return f.cacheTimeout - time.Now().UTC().Sub(f.lastupdate)
+	now := time.Now().UTC()
+
+	d := f.timeout() - now.Sub(f.lastupdate)
+	if wait := f.notBefore.Sub(now); wait > d {
+		return wait
+	}
+
+	return d
 }
@@ -89,85 +89,85 @@ func Test_NewItem(t *testing.T) {
 	}
 }
 
-// func Test_ItemExtensions(t *testing.T) {
-// 	file, _ := os.Open("testdata/extension.rss")
-// 	defer file.Close()
-
-// 	itemCh := make(chan *common.Item, 1)
-// 	feed := New(1, func(_ *Feed, _ *common.Channel, newitems []*common.Item) {
-// 		itemCh <- newitems[0]
-// 	}, NewDatabase())
-
-// 	if err := feed.load(file, nil); err != nil {
-// 		t.Fatal(err)
-// 	}
-
-// 	select {
-// 	case item := <-itemCh:
-// 		edgarExtensionxbrlFiling := item.Extensions["http://www.sec.gov/Archives/edgar"]["xbrlFiling"][0].Childrens
-// 		companyExpected := "Cellular Biomedicine Group, Inc."
-// 		companyName := edgarExtensionxbrlFiling["companyName"][0]
-// 		if companyName.Value != companyExpected {
-// 			t.Errorf("Expected company to be %s but found %s", companyExpected, companyName.Value)
-// 		}
-
-// 		files := edgarExtensionxbrlFiling["xbrlFiles"][0].Childrens["xbrlFile"]
-// 		fileSizeExpected := 10
-// 		if len(files) != 10 {
-// 			t.Errorf("Expected files size to be %d but found %d", fileSizeExpected, len(files))
-// 		}
-
-// 		file := files[0]
-// 		fileExpected := "cbmg_10qa.htm"
-// 		if file.Attrs["file"] != fileExpected {
-// 			t.Errorf("Expected file to be %s but found %d", fileExpected, len(file.Attrs["file"]))
-// 		}
-// 	case <-time.After(time.Second):
-// 		t.Fatal("timeout")
-// 	}
-// }
-
-// func Test_ChannelExtensions(t *testing.T) {
-// 	file, _ := os.Open("testdata/extension.rss")
-// 	defer file.Close()
-
-// 	channelCh := make(chan *common.Channel, 1)
-// 	feed := New(1, func(_ *Feed, ch *common.Channel, _ []*common.Item) {
-// 		channelCh <- ch
-// 	}, NewDatabase())
-
-// 	if err := feed.load(file, nil); err != nil {
-// 		t.Fatal(err)
-// 	}
-
-// 	select {
-// 	case channel := <-channelCh:
-// 		itunesExtentions := channel.Extensions["http://www.itunes.com/dtds/podcast-1.0.dtd"]
-
-// 		authorExptected := "The Author"
-// 		ownerEmailExpected := "test@rss.com"
-// 		categoryExpected := "Politics"
-// 		imageExptected := "http://golang.org/doc/gopher/project.png"
-
-// 		if itunesExtentions["author"][0].Value != authorExptected {
-// 			t.Errorf("Expected author to be %s but found %s", authorExptected, itunesExtentions["author"][0].Value)
-// 		}
-
-// 		if itunesExtentions["owner"][0].Childrens["email"][0].Value != ownerEmailExpected {
-// 			t.Errorf("Expected owner email to be %s but found %s", ownerEmailExpected, itunesExtentions["owner"][0].Childrens["email"][0].Value)
-// 		}
-
-// 		if itunesExtentions["category"][0].Attrs["text"] != categoryExpected {
-// 			t.Errorf("Expected category text to be %s but found %s", categoryExpected, itunesExtentions["category"][0].Attrs["text"])
-// 		}
-
-// 		if itunesExtentions["image"][0].Attrs["href"] != imageExptected {
-// 			t.Errorf("Expected image href to be %s but found %s", imageExptected, itunesExtentions["image"][0].Attrs["href"])
-// 		}
-// 	case <-time.After(time.Second):
-// 		t.Fatal("timeout")
-// 	}
-// }
+func Test_ItemExtensions(t *testing.T) {
+	file, _ := os.Open("testdata/extension.rss")
+	defer file.Close()
+
+	itemCh := make(chan *common.Item, 1)
+	feed := New(1, func(_ *Feed, _ *common.Channel, newitems []*common.Item) {
+		itemCh <- newitems[0]
+	}, NewDatabase())
+
+	if err := feed.load(file, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case item := <-itemCh:
+		edgarExtensionxbrlFiling := item.Extensions["http://www.sec.gov/Archives/edgar"]["xbrlFiling"][0].Childrens
+		companyExpected := "Cellular Biomedicine Group, Inc."
+		companyName := edgarExtensionxbrlFiling["companyName"][0]
+		if companyName.Value != companyExpected {
+			t.Errorf("Expected company to be %s but found %s", companyExpected, companyName.Value)
+		}
+
+		files := edgarExtensionxbrlFiling["xbrlFiles"][0].Childrens["xbrlFile"]
+		fileSizeExpected := 10
+		if len(files) != 10 {
+			t.Errorf("Expected files size to be %d but found %d", fileSizeExpected, len(files))
+		}
+
+		file := files[0]
+		fileExpected := "cbmg_10qa.htm"
+		if file.Attrs["file"] != fileExpected {
+			t.Errorf("Expected file to be %s but found %s", fileExpected, file.Attrs["file"])
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func Test_ChannelExtensions(t *testing.T) {
+	file, _ := os.Open("testdata/extension.rss")
+	defer file.Close()
+
+	channelCh := make(chan *common.Channel, 1)
+	feed := New(1, func(_ *Feed, ch *common.Channel, _ []*common.Item) {
+		channelCh <- ch
+	}, NewDatabase())
+
+	if err := feed.load(file, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case channel := <-channelCh:
+		itunesExtentions := channel.Extensions["http://www.itunes.com/dtds/podcast-1.0.dtd"]
+
+		authorExptected := "The Author"
+		ownerEmailExpected := "test@rss.com"
+		categoryExpected := "Politics"
+		imageExptected := "http://golang.org/doc/gopher/project.png"
+
+		if itunesExtentions["author"][0].Value != authorExptected {
+			t.Errorf("Expected author to be %s but found %s", authorExptected, itunesExtentions["author"][0].Value)
+		}
+
+		if itunesExtentions["owner"][0].Childrens["email"][0].Value != ownerEmailExpected {
+			t.Errorf("Expected owner email to be %s but found %s", ownerEmailExpected, itunesExtentions["owner"][0].Childrens["email"][0].Value)
+		}
+
+		if itunesExtentions["category"][0].Attrs["text"] != categoryExpected {
+			t.Errorf("Expected category text to be %s but found %s", categoryExpected, itunesExtentions["category"][0].Attrs["text"])
+		}
+
+		if itunesExtentions["image"][0].Attrs["href"] != imageExptected {
+			t.Errorf("Expected image href to be %s but found %s", imageExptected, itunesExtentions["image"][0].Attrs["href"])
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+}
 
 func Test_CData(t *testing.T) {
 	file, _ := os.Open("testdata/iosBoardGameGeek.rss")
@@ -265,3 +265,172 @@ func Test_FetchWithETag(t *testing.T) {
 		t.Fatal("timeout2")
 	}
 }
+
+func Test_Expire(t *testing.T) {
+	rssServer := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			file, _ := os.Open("testdata/boing.rss")
+			defer file.Close()
+			io.Copy(w, file)
+		},
+	))
+	defer rssServer.Close()
+
+	feed := New(time.Hour, func(_ *Feed, _ *common.Channel, _ []*common.Item) {}, NewDatabase())
+
+	if code, _ := feed.Fetch(rssServer.URL, http.DefaultClient, charset.NewReaderLabel); code != http.StatusOK {
+		t.Fatalf("Expected first fetch to return %d, got %d", http.StatusOK, code)
+	}
+
+	if code, _ := feed.Fetch(rssServer.URL, http.DefaultClient, charset.NewReaderLabel); code != -1 {
+		t.Fatalf("Expected fetch within cache timeout to return -1, got %d", code)
+	}
+
+	feed.Expire()
+	if code, _ := feed.Fetch(rssServer.URL, http.DefaultClient, charset.NewReaderLabel); code != http.StatusOK {
+		t.Fatalf("Expected fetch after Expire to return %d, got %d", http.StatusOK, code)
+	}
+}
+
+func Test_StateIsResumed(t *testing.T) {
+	const (
+		eTag         = "I am an ETag"
+		lastModified = "Mon, 02 Jan 2006 15:04:05 GMT"
+	)
+
+	headers := make(chan http.Header, 1)
+	rssServer := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			headers <- r.Header
+
+			if r.Header.Get("If-None-Match") == eTag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+
+			file, _ := os.Open("testdata/boing.rss")
+			defer file.Close()
+			w.Header().Set("ETag", eTag)
+			w.Header().Set("Last-Modified", lastModified)
+			io.Copy(w, file)
+		},
+	))
+	defer rssServer.Close()
+
+	database := NewDatabase()
+
+	feed := New(time.Hour, func(_ *Feed, _ *common.Channel, _ []*common.Item) {}, database)
+	if code, _ := feed.Fetch(rssServer.URL, http.DefaultClient, charset.NewReaderLabel); code != http.StatusOK {
+		t.Fatalf("Expected first fetch to return %d, got %d", http.StatusOK, code)
+	}
+	if header := <-headers; header.Get("If-Modified-Since") != "" {
+		t.Fatalf("Expected no If-Modified-Since header, but instead got %s", header.Get("If-Modified-Since"))
+	}
+
+	state := database.State()
+	if state.ETag != eTag || state.LastModified != lastModified {
+		t.Fatalf("Expected state to be saved, got %v", state)
+	}
+
+	// a new Feed, as after a restart, continues where the last left off
+	feed = New(time.Minute, func(_ *Feed, _ *common.Channel, _ []*common.Item) {}, database)
+	if code, _ := feed.Fetch(rssServer.URL, http.DefaultClient, charset.NewReaderLabel); code != -1 {
+		t.Fatalf("Expected fetch before next fetch time to return -1, got %d", code)
+	}
+
+	feed.Expire()
+	if code, _ := feed.Fetch(rssServer.URL, http.DefaultClient, charset.NewReaderLabel); code != http.StatusNotModified {
+		t.Fatalf("Expected conditional fetch to return %d, got %d", http.StatusNotModified, code)
+	}
+	if header := <-headers; header.Get("If-Modified-Since") != lastModified {
+		t.Fatalf("Expected an If-Modified-Since header with value %s, but instead got %s", lastModified, header.Get("If-Modified-Since"))
+	}
+}
+
+func Test_StateTTL(t *testing.T) {
+	database := NewDatabase()
+	database.SetState(State{LastFetch: time.Now().UTC().Add(-30 * time.Minute), TTL: 60})
+
+	// the feed's TTL is kept after a restart
+	feed := New(time.Minute, func(_ *Feed, _ *common.Channel, _ []*common.Item) {}, database)
+	if d := feed.DurationTillUpdate(); d < 29*time.Minute || d > 30*time.Minute {
+		t.Fatalf("Expected next update in 30m, got %v", d)
+	}
+
+	// but the cache timeout is not changed by the last
+	database.SetState(State{LastFetch: time.Now().UTC().Add(-30 * time.Minute)})
+	feed = New(time.Minute, func(_ *Feed, _ *common.Channel, _ []*common.Item) {}, database)
+	if d := feed.DurationTillUpdate(); d > 0 {
+		t.Fatalf("Expected update to be due, got %v", d)
+	}
+}
+
+func Test_CacheHeaders(t *testing.T) {
+	var status int
+	var header http.Header
+
+	rssServer := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+				return
+			}
+
+			file, _ := os.Open("testdata/boing.rss")
+			defer file.Close()
+			io.Copy(w, file)
+		},
+	))
+	defer rssServer.Close()
+
+	database := NewDatabase()
+	feed := New(0, func(_ *Feed, _ *common.Channel, _ []*common.Item) {}, database)
+
+	assertNextUpdate := func(expected time.Duration) {
+		if d := feed.DurationTillUpdate(); d < expected-time.Second || d > expected {
+			t.Fatalf("Expected next update in %v, got %v", expected, d)
+		}
+	}
+
+	status, header = http.StatusOK, http.Header{"Cache-Control": {"public, max-age=3600"}, "Expires": {"0"}}
+	if code, err := feed.Fetch(rssServer.URL, http.DefaultClient, charset.NewReaderLabel); code != http.StatusOK || err != nil {
+		t.Fatalf("Expected fetch to return %d, got %d %v", http.StatusOK, code, err)
+	}
+	assertNextUpdate(time.Hour)
+	if cache := feed.CacheHeaders(); cache.CacheControl != "public, max-age=3600" || cache.Expires != "0" {
+		t.Fatalf("Expected cache headers to be recorded, got %v", cache)
+	}
+	if code, _ := feed.Fetch(rssServer.URL, http.DefaultClient, charset.NewReaderLabel); code != -1 {
+		t.Fatalf("Expected fetch before max-age to return -1, got %d", code)
+	}
+
+	feed.Expire()
+	status, header = http.StatusNotModified, http.Header{"Expires": {time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)}}
+	if code, err := feed.Fetch(rssServer.URL, http.DefaultClient, charset.NewReaderLabel); code != http.StatusNotModified || err != nil {
+		t.Fatalf("Expected fetch to return %d, got %d %v", http.StatusNotModified, code, err)
+	}
+	assertNextUpdate(time.Minute)
+
+	feed.Expire()
+	status, header = http.StatusServiceUnavailable, http.Header{"Retry-After": {"120"}}
+	if code, err := feed.Fetch(rssServer.URL, http.DefaultClient, charset.NewReaderLabel); code != http.StatusServiceUnavailable || err != nil {
+		t.Fatalf("Expected fetch to return %d, got %d %v", http.StatusServiceUnavailable, code, err)
+	}
+	assertNextUpdate(2 * time.Minute)
+	if cache := feed.CacheHeaders(); cache.RetryAfter != "120" {
+		t.Fatalf("Expected Retry-After to be recorded, got %v", cache)
+	}
+
+	// the delay is kept over a restart
+	feed = New(0, func(_ *Feed, _ *common.Channel, _ []*common.Item) {}, database)
+	assertNextUpdate(2 * time.Minute)
+
+	// but Retry-After is only for some responses
+	feed.Expire()
+	status, header = http.StatusNotFound, http.Header{"Retry-After": {"120"}}
+	feed.Fetch(rssServer.URL, http.DefaultClient, charset.NewReaderLabel)
+	assertNextUpdate(0)
+}
@@ -5,6 +5,7 @@ package jsonfeed
 
 import (
 	"encoding/json"
+	"html"
 	"io"
 	"net/url"
 
@@ -93,12 +94,29 @@ func (Parser) Read(r io.Reader, _ *url.URL, charset func(charset string, input i
 			i.Content = &common.Content{Type: "html", Text: item.ContentHTML}
 		}
 
+		// the description keeps the full content, as the summary may be used
+		if item.ContentHTML != "" {
+			i.Description = item.ContentHTML
+		} else if item.ContentText != "" {
+			i.Description = html.EscapeString(item.ContentText)
+		}
+
 		for _, attachment := range item.Attachments {
 			i.Enclosures = append(i.Enclosures, common.Enclosure{
 				URL:    attachment.URL,
 				Length: attachment.SizeInBytes,
 				Type:   attachment.MimeType,
 			})
+
+			if attachment.DurationInSeconds > 0 && i.Podcast == nil {
+				i.Podcast = &common.Podcast{
+					Duration: attachment.DurationInSeconds,
+					Image:    item.Image,
+				}
+				if i.Podcast.Image == "" {
+					i.Podcast.Image = feed.Icon
+				}
+			}
 		}
 
 		for _, tag := range item.Tags {
@@ -2,6 +2,7 @@ package jsonfeed
 
 import (
 	"os"
+	"strings"
 	"testing"
 
 	"hawx.me/code/assert"
@@ -49,6 +50,7 @@ func TestSimple(t *testing.T) {
 			assert.Equal("https://example.org/initial-post", channel.Items[1].Links[0].Href)
 			assert.Equal("alternate", channel.Items[1].Links[0].Rel)
 			assert.Equal("<p>Hello, world!</p>", channel.Items[1].Content.Text)
+			assert.Equal("<p>Hello, world!</p>", channel.Items[1].Description)
 			assert.Nil(channel.Items[1].Thumbnail)
 
 			if assert.Len(channel.Items[1].Categories, 2) {
@@ -155,6 +157,7 @@ func TestPodcast(t *testing.T) {
 			assert.Equal("http://therecord.co/chris-parrish", item.Links[0].Href)
 			assert.Equal("alternate", item.Links[0].Rel)
 			assert.Equal("Brent interviews Chris Parrish, co-host of The Record and one-half of Aged & Distilled.", item.Content.Text)
+			assert.True(strings.HasPrefix(item.Description, `Chris has worked at <a href="http://adobe.com/">Adobe</a>`))
 			assert.Equal("2014-05-09T14:04:00-07:00", item.PubDate)
 
 			if assert.Len(item.Enclosures, 1) {
@@ -163,6 +166,10 @@ func TestPodcast(t *testing.T) {
 				assert.Equal("audio/x-m4a", enclosure.Type)
 				assert.Equal(int64(89970236), enclosure.Length)
 			}
+
+			if assert.True(item.Podcast != nil) {
+				assert.Equal(6629, item.Podcast.Duration)
+			}
 		}
 	}
 }
@@ -4,8 +4,11 @@
 package rss
 
 import (
+	"bytes"
 	"encoding/xml"
 	"io"
+	"io/ioutil"
+	"log"
 	"net/url"
 	"strconv"
 	"strings"
@@ -58,7 +61,12 @@ func (Parser) CanRead(r io.Reader, charset func(charset string, input io.Reader)
 }
 
 func (Parser) Read(r io.Reader, _ *url.URL, charset func(charset string, input io.Reader) (io.Reader, error)) (foundChannels []*common.Channel, err error) {
-	decoder := xml.NewDecoder(r)
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
 	decoder.CharsetReader = charset
 
 	var feed rssFeed
@@ -215,11 +223,71 @@ func (Parser) Read(r io.Reader, _ *url.URL, charset func(charset string, input i
 		ch.Items = append(ch.Items, i)
 	}
 
+	// extensions are extra, so the feed is still read if they can not be
+	if err := readExtensions(data, charset, ch); err != nil {
+		log.Printf("rss: could not read extensions: %v\n", err)
+	}
+	ch.ReadPodcasts()
+
 	foundChannels = append(foundChannels, ch)
 
 	return
 }
 
+// readExtensions adds the elements in a namespace, within the channel and its
+// items, to the Extensions of ch. RSS elements have no namespace, so any element
+// in one is an extension.
+func readExtensions(data []byte, charset func(charset string, input io.Reader) (io.Reader, error), ch *common.Channel) error {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = charset
+
+	// path holds the names of the RSS elements that contain the current token
+	var path []string
+	item := -1
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			inChannel := len(path) == 2 && path[1] == "channel"
+			inItem := len(path) == 3 && path[2] == "item" && item < len(ch.Items)
+
+			if t.Name.Space != "" && (inItem || inChannel && t.Name.Local != "item") {
+				ext, err := common.DecodeExtension(decoder, t)
+				if err != nil {
+					return err
+				}
+
+				if inItem {
+					ch.Items[item].Extensions = common.AddExtension(ch.Items[item].Extensions, t.Name.Space, ext)
+				} else {
+					ch.Extensions = common.AddExtension(ch.Extensions, t.Name.Space, ext)
+				}
+				continue
+			}
+
+			if inChannel && t.Name.Local == "item" {
+				item++
+			}
+			path = append(path, t.Name.Local)
+
+		case xml.EndElement:
+			path = path[:len(path)-1]
+			// anything after the end of the document is ignored, as by Decode
+			if len(path) == 0 {
+				return nil
+			}
+		}
+	}
+}
+
 // At the top level, a RSS document is a <rss> element, with a mandatory
 // attribute called version, that specifies the version of RSS that the document
 // conforms to. If it conforms to this specification, the version attribute must
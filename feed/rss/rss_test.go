@@ -2,6 +2,7 @@ package rss
 
 import (
 	"os"
+	"strings"
 	"testing"
 
 	"hawx.me/code/assert"
@@ -77,3 +78,66 @@ func TestMediaExtensions(t *testing.T) {
 		}
 	}
 }
+
+func TestPodcast(t *testing.T) {
+	assert := assert.New(t)
+
+	file, _ := os.Open("testdata/podcast.rss")
+	defer file.Close()
+
+	channels, err := Parser{}.Read(file, nil, nil)
+	if !assert.Nil(err) || !assert.Len(channels, 1) {
+		return
+	}
+
+	items := channels[0].Items
+	if !assert.Len(items, 3) {
+		return
+	}
+
+	if podcast := items[0].Podcast; assert.True(podcast != nil) {
+		assert.Equal(3723, podcast.Duration)
+		assert.Equal(2, podcast.Episode)
+		assert.Equal("http://podcast.example.com/2.jpg", podcast.Image)
+
+		if assert.True(podcast.Chapters != nil) {
+			assert.Equal("http://podcast.example.com/2/chapters.json", podcast.Chapters.URL)
+			assert.Equal("application/json+chapters", podcast.Chapters.Type)
+		}
+
+		if assert.Len(podcast.Transcripts, 2) {
+			assert.Equal("http://podcast.example.com/2/transcript.vtt", podcast.Transcripts[0].URL)
+			assert.Equal("text/vtt", podcast.Transcripts[0].Type)
+			assert.Equal("en", podcast.Transcripts[0].Language)
+			assert.Equal("captions", podcast.Transcripts[1].Rel)
+		}
+	}
+
+	if podcast := items[1].Podcast; assert.True(podcast != nil) {
+		assert.Equal(754, podcast.Duration)
+		assert.Equal(0, podcast.Episode)
+		assert.Equal("http://podcast.example.com/artwork.jpg", podcast.Image)
+	}
+
+	assert.Nil(items[2].Podcast)
+}
+
+func TestExtensionsWithTrailingContent(t *testing.T) {
+	assert := assert.New(t)
+
+	channels, err := Parser{}.Read(strings.NewReader(`<rss version="2.0" xmlns:dc="http://purl.org/dc/elements/1.1/"><channel>
+  <title>Test</title>
+  <item><title>One</title><dc:creator>Someone</dc:creator></item>
+</channel></rss>
+</oops> <more`), nil, nil)
+	if !assert.Nil(err) || !assert.Len(channels, 1) {
+		return
+	}
+
+	if assert.Len(channels[0].Items, 1) {
+		creator := channels[0].Items[0].Extensions["http://purl.org/dc/elements/1.1/"]["creator"]
+		if assert.Len(creator, 1) {
+			assert.Equal("Someone", creator[0].Value)
+		}
+	}
+}
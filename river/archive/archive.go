@@ -0,0 +1,37 @@
+// Package archive defines a long-term store of the items seen in each feed.
+package archive
+
+import (
+	"time"
+
+	"hawx.me/code/riviera/river/riverjs"
+)
+
+// A Database keeps each item that has been read from a feed, so that the
+// history of a single feed can be browsed after the blocks it appeared in have
+// been truncated from the river.
+type Database interface {
+	// Add stores each item in the feed block.
+	Add(feed riverjs.Feed)
+
+	// Items returns the details of the feed along with, at most, limit items
+	// from it, newest first. The before cursor, if not empty, is a value returned
+	// from a previous call and means only items older than those returned by
+	// that call will be given. The next cursor is empty if there are no more
+	// items.
+	Items(feedURL, before string, limit int) (feed riverjs.Feed, next string, ok bool)
+
+	// Truncate removes items that fall outside of the retention policy.
+	Truncate()
+}
+
+// Retention is the policy for how long items are kept in an archive. A zero
+// value for either field means items are not removed for that reason.
+type Retention struct {
+	// MaxAge is the duration after an item was published that it will be kept.
+	MaxAge time.Duration
+
+	// MaxItems is the number of items that will be kept for each feed, the
+	// oldest being removed first.
+	MaxItems int
+}
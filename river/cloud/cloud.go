@@ -0,0 +1,303 @@
+// Package cloud implements the subscriber side of rssCloud, allowing feeds that
+// specify a <cloud> element to notify the river when they have been updated.
+//
+// See http://home.rsscloud.co/ and http://www.rssboard.org/rsscloud-interface
+package cloud
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"hawx.me/code/riviera/feed/common"
+)
+
+// RenewAfter is the period after which registrations are renewed. The spec
+// says that servers will drop registrations that are not renewed within 25
+// hours.
+const RenewAfter = 24 * time.Hour
+
+// notifyProcedure is the name of the procedure that xml-rpc clouds should call.
+const notifyProcedure = "river.feedUpdated"
+
+// ErrUnsupportedProtocol is returned when a cloud uses a protocol other than
+// http-post or xml-rpc.
+var ErrUnsupportedProtocol = errors.New("unsupported cloud protocol")
+
+// A Subscriber registers for notifications with rssCloud servers, and handles
+// the notifications that they send.
+type Subscriber struct {
+	domain string
+	port   int
+	path   string
+	client *http.Client
+
+	mu    sync.RWMutex
+	feeds map[string]*registration
+}
+
+type registration struct {
+	cloud  common.Cloud
+	notify func()
+	timer  *time.Timer
+}
+
+// New creates a Subscriber. The callback is the public URL that the Subscriber
+// is served at.
+func New(callback string) (*Subscriber, error) {
+	u, err := url.Parse(callback)
+	if err != nil {
+		return nil, err
+	}
+
+	port := 80
+	if u.Scheme == "https" {
+		port = 443
+	}
+	if p := u.Port(); p != "" {
+		if port, err = strconv.Atoi(p); err != nil {
+			return nil, err
+		}
+	}
+
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+
+	return &Subscriber{
+		domain: u.Hostname(),
+		port:   port,
+		path:   path,
+		client: &http.Client{Timeout: time.Minute},
+		feeds:  map[string]*registration{},
+	}, nil
+}
+
+// Register asks the cloud to send notifications for the feed at feedURL, notify
+// is called each time one is received. The registration is renewed every
+// RenewAfter until Unregister is called.
+func (s *Subscriber) Register(feedURL string, cloud common.Cloud, notify func()) error {
+	reg := &registration{cloud: cloud, notify: notify}
+
+	s.mu.Lock()
+	if old, ok := s.feeds[feedURL]; ok {
+		old.timer.Stop()
+	}
+	s.feeds[feedURL] = reg
+	reg.timer = time.AfterFunc(RenewAfter, func() { s.renew(feedURL, reg) })
+	s.mu.Unlock()
+
+	return s.register(feedURL, cloud)
+}
+
+// Unregister stops notifications for feedURL being handled and stops the
+// registration being renewed. rssCloud has no way to remove a registration, so
+// the cloud may still send notifications until it expires.
+func (s *Subscriber) Unregister(feedURL string) {
+	s.mu.Lock()
+	if reg, ok := s.feeds[feedURL]; ok {
+		reg.timer.Stop()
+		delete(s.feeds, feedURL)
+	}
+	s.mu.Unlock()
+}
+
+// Registered returns true if notifications are being handled for feedURL.
+func (s *Subscriber) Registered(feedURL string) bool {
+	s.mu.RLock()
+	_, ok := s.feeds[feedURL]
+	s.mu.RUnlock()
+
+	return ok
+}
+
+func (s *Subscriber) renew(feedURL string, reg *registration) {
+	s.mu.Lock()
+	if s.feeds[feedURL] != reg {
+		s.mu.Unlock()
+		return
+	}
+	reg.timer = time.AfterFunc(RenewAfter, func() { s.renew(feedURL, reg) })
+	s.mu.Unlock()
+
+	if err := s.register(feedURL, reg.cloud); err != nil {
+		log.Printf("cloud: error renewing %s: %s\n", feedURL, err)
+	}
+}
+
+func (s *Subscriber) register(feedURL string, cloud common.Cloud) error {
+	endpoint := "http://" + net.JoinHostPort(cloud.Domain, strconv.Itoa(cloud.Port)) + cloud.Path
+
+	switch strings.ToLower(cloud.Protocol) {
+	case "http-post":
+		return s.registerHTTPPost(endpoint, feedURL)
+	case "xml-rpc":
+		return s.registerXMLRPC(endpoint, cloud.RegisterProcedure, feedURL)
+	default:
+		return ErrUnsupportedProtocol
+	}
+}
+
+func (s *Subscriber) registerHTTPPost(endpoint, feedURL string) error {
+	resp, err := s.client.PostForm(endpoint, url.Values{
+		"notifyProcedure": {""},
+		"domain":          {s.domain},
+		"port":            {strconv.Itoa(s.port)},
+		"path":            {s.path},
+		"protocol":        {"http-post"},
+		"url1":            {feedURL},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("cloud %s responded with %d", endpoint, resp.StatusCode)
+	}
+
+	var result struct {
+		Success string `xml:"success,attr"`
+		Msg     string `xml:"msg,attr"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err == nil && result.Success == "false" {
+		return fmt.Errorf("cloud %s refused registration: %s", endpoint, result.Msg)
+	}
+
+	return nil
+}
+
+func (s *Subscriber) registerXMLRPC(endpoint, procedure, feedURL string) error {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString("<methodCall><methodName>")
+	xml.EscapeText(&buf, []byte(procedure))
+	buf.WriteString("</methodName><params>")
+	writeParam(&buf, "string", notifyProcedure)
+	writeParam(&buf, "i4", strconv.Itoa(s.port))
+	writeParam(&buf, "string", s.path)
+	writeParam(&buf, "string", "xml-rpc")
+	buf.WriteString("<param><value><array><data><value><string>")
+	xml.EscapeText(&buf, []byte(feedURL))
+	buf.WriteString("</string></value></data></array></value></param>")
+	buf.WriteString("</params></methodCall>")
+
+	resp, err := s.client.Post(endpoint, "text/xml", &buf)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("cloud %s responded with %d", endpoint, resp.StatusCode)
+	}
+
+	var result struct {
+		Fault *struct {
+			Value xmlrpcValue `xml:"value"`
+		} `xml:"fault"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if result.Fault != nil {
+		return fmt.Errorf("cloud %s refused registration: %s", endpoint, result.Fault.Value.String())
+	}
+
+	return nil
+}
+
+func writeParam(w *bytes.Buffer, kind, value string) {
+	fmt.Fprintf(w, "<param><value><%s>", kind)
+	xml.EscapeText(w, []byte(value))
+	fmt.Fprintf(w, "</%s></value></param>", kind)
+}
+
+// ServeHTTP handles the challenge and notification requests made by clouds.
+func (s *Subscriber) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		// When the domain is given on registration the cloud will check that we
+		// want notifications by sending a challenge that must be echoed.
+		if !s.Registered(r.FormValue("url")) {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, r.FormValue("challenge"))
+
+	case "POST":
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "text/xml") {
+			s.notifyXMLRPC(w, r)
+		} else {
+			s.notify(r.FormValue("url"))
+		}
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Subscriber) notifyXMLRPC(w http.ResponseWriter, r *http.Request) {
+	var call struct {
+		MethodName string `xml:"methodName"`
+		Params     []struct {
+			Value xmlrpcValue `xml:"value"`
+		} `xml:"params>param"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&call); err != nil || len(call.Params) == 0 {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	s.notify(call.Params[0].Value.String())
+
+	w.Header().Set("Content-Type", "text/xml")
+	io.WriteString(w, xml.Header+"<methodResponse><params><param><value><boolean>1</boolean></value></param></params></methodResponse>")
+}
+
+func (s *Subscriber) notify(feedURL string) {
+	s.mu.RLock()
+	reg, ok := s.feeds[feedURL]
+	s.mu.RUnlock()
+
+	if !ok {
+		log.Printf("cloud: ignoring notification for %s\n", feedURL)
+		return
+	}
+
+	go reg.notify()
+}
+
+// xmlrpcValue reads an xml-rpc value which may have its contents either
+// wrapped in a type element or given directly.
+type xmlrpcValue struct {
+	Text   string `xml:",chardata"`
+	Str    string `xml:"string"`
+	Struct []struct {
+		Name  string      `xml:"name"`
+		Value xmlrpcValue `xml:"value"`
+	} `xml:"struct>member"`
+}
+
+func (v xmlrpcValue) String() string {
+	if v.Str != "" {
+		return v.Str
+	}
+	for _, member := range v.Struct {
+		if member.Name == "faultString" {
+			return member.Value.String()
+		}
+	}
+	return strings.TrimSpace(v.Text)
+}
@@ -0,0 +1,139 @@
+package cloud_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"hawx.me/code/riviera/feed/common"
+	"hawx.me/code/riviera/river/cloud"
+)
+
+func cloudFor(s *httptest.Server, protocol string) common.Cloud {
+	u, _ := url.Parse(s.URL)
+	port, _ := strconv.Atoi(u.Port())
+
+	return common.Cloud{
+		Domain:            u.Hostname(),
+		Port:              port,
+		Path:              "/rsscloud/pleaseNotify",
+		RegisterProcedure: "rssCloud.pleaseNotify",
+		Protocol:          protocol,
+	}
+}
+
+func TestSubscriberHTTPPost(t *testing.T) {
+	assert := assert.New(t)
+
+	var subscriber *cloud.Subscriber
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subscriber.ServeHTTP(w, r)
+	}))
+	defer callback.Close()
+
+	subscriber, _ = cloud.New(callback.URL + "/rsscloud")
+
+	challenged := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		assert.Equal("/rsscloud/pleaseNotify", r.URL.Path)
+		assert.Equal("http-post", r.PostForm.Get("protocol"))
+		assert.Equal("/rsscloud", r.PostForm.Get("path"))
+		assert.Equal("http://example.com/feed", r.PostForm.Get("url1"))
+
+		resp, err := http.Get("http://" + r.PostForm.Get("domain") + ":" + r.PostForm.Get("port") + r.PostForm.Get("path") +
+			"?url=" + url.QueryEscape(r.PostForm.Get("url1")) + "&challenge=xyz")
+		if err == nil {
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			challenged <- string(body)
+		}
+
+		w.Write([]byte(`<?xml version="1.0"?><notifyResult success="true" msg="Registration worked."/>`))
+	}))
+	defer server.Close()
+
+	notified := make(chan struct{}, 1)
+	err := subscriber.Register("http://example.com/feed", cloudFor(server, "http-post"), func() {
+		notified <- struct{}{}
+	})
+	assert.Nil(err)
+	assert.True(subscriber.Registered("http://example.com/feed"))
+	assert.Equal("xyz", <-challenged)
+
+	resp, err := http.PostForm(callback.URL+"/rsscloud", url.Values{"url": {"http://example.com/feed"}})
+	assert.Nil(err)
+	resp.Body.Close()
+
+	select {
+	case <-notified:
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+
+	subscriber.Unregister("http://example.com/feed")
+	assert.False(subscriber.Registered("http://example.com/feed"))
+}
+
+func TestSubscriberXMLRPC(t *testing.T) {
+	assert := assert.New(t)
+
+	var subscriber *cloud.Subscriber
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subscriber.ServeHTTP(w, r)
+	}))
+	defer callback.Close()
+
+	subscriber, _ = cloud.New(callback.URL + "/rsscloud")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.True(strings.Contains(string(body), "<methodName>rssCloud.pleaseNotify</methodName>"))
+		assert.True(strings.Contains(string(body), "<string>http://example.com/feed</string>"))
+
+		w.Write([]byte(`<?xml version="1.0"?><methodResponse><params><param><value><boolean>1</boolean></value></param></params></methodResponse>`))
+	}))
+	defer server.Close()
+
+	notified := make(chan struct{}, 1)
+	err := subscriber.Register("http://example.com/feed", cloudFor(server, "xml-rpc"), func() {
+		notified <- struct{}{}
+	})
+	assert.Nil(err)
+
+	resp, err := http.Post(callback.URL+"/rsscloud", "text/xml", strings.NewReader(`<?xml version="1.0"?>
+<methodCall>
+  <methodName>river.feedUpdated</methodName>
+  <params><param><value>http://example.com/feed</value></param></params>
+</methodCall>`))
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	select {
+	case <-notified:
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func TestSubscriberWhenRefused(t *testing.T) {
+	subscriber, _ := cloud.New("http://localhost/rsscloud")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<?xml version="1.0"?><notifyResult success="false" msg="Could not reach you."/>`))
+	}))
+	defer server.Close()
+
+	err := subscriber.Register("http://example.com/feed", cloudFor(server, "http-post"), func() {})
+	assert.NotNil(t, err)
+
+	err = subscriber.Register("http://example.com/feed", cloudFor(server, "soap"), func() {})
+	assert.Equal(t, cloud.ErrUnsupportedProtocol, err)
+}
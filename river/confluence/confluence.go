@@ -4,11 +4,16 @@ package confluence
 import (
 	"log"
 	"net/http"
+	"sort"
 	"sync"
 	"time"
 
+	"hawx.me/code/riviera/river/archive"
+	"hawx.me/code/riviera/river/dedup"
 	"hawx.me/code/riviera/river/events"
+	"hawx.me/code/riviera/river/metrics"
 	"hawx.me/code/riviera/river/riverjs"
+	"hawx.me/code/riviera/river/search"
 	"hawx.me/code/riviera/river/tributary"
 )
 
@@ -18,9 +23,22 @@ type Confluence interface {
 	// Latest returns the newest items from all managed Tributaries.
 	Latest() []riverjs.Feed
 
+	// Filter returns the newest items, as Latest, but only from the feeds that
+	// include returns true for, given the URI they are subscribed at.
+	Filter(include func(uri string) bool) []riverjs.Feed
+
 	// Log returns the events that have been triggered by the Tributaries.
 	Log() []events.Event
 
+	// Search returns the items that have been received from the Tributaries that
+	// match the query.
+	Search(query search.Query) []search.Result
+
+	// Archive returns the details of a feed, along with items that have been
+	// archived from it. The ok value will be false if the feed is not known or
+	// the Confluence is not archiving.
+	Archive(feedURL, before string, limit int) (feed riverjs.Feed, next string, ok bool)
+
 	// Add causes the Confluence to aggregate a new Tributary. If a Tributary with
 	// the same name is already managed by the Confluence no action will be taken.
 	Add(stream tributary.Tributary)
@@ -29,31 +47,87 @@ type Confluence interface {
 	// managed by the Confluence.
 	Remove(uri string) bool
 
+	// Health returns a summary of the events of each managed Tributary.
+	Health() []events.Health
+
+	// Pause stops the named Tributary, without removing it.
+	Pause(uri string) bool
+
+	// Resume starts the named Tributary again after it was paused.
+	Resume(uri string) bool
+
+	// Revive starts the named Tributary again after it was found to be dead.
+	Revive(uri string) bool
+
 	// Close stops the Confluence and all managed Tributaries.
 	Close() error
 }
 
 type confluence struct {
 	store   Database
+	index   search.Database
+	archive archive.Database
 	cutoff  time.Duration
+	dead    time.Duration
 	mu      sync.Mutex
 	streams map[string]tributary.Tributary
+	health  map[string]*events.Health
 	feeds   chan riverjs.Feed
 	events  chan events.Event
 	evs     *events.Events
+	moved   func(from, to string)
+	died    func(uri string)
+	dedup   func(uri string) bool
+	metrics *metrics.River
 	quit    chan struct{}
+
+	// pending are the calls to died and moved waiting to be made, they are
+	// made in order by a single goroutine so that run is not held up by them.
+	pendingMu sync.Mutex
+	pending   []func()
 }
 
-// New creates a new Confluence writing to the store. The cutoff specifies the
-// minimum duration an item should be returned by Latest for, but is not
-// guaranteed to be followed exactly (e.g. with a cutoff of 1 hour an item which
-// is 2 hours old may be returned by Latest, but an item that is 5 minutes old
-// must be returned by Latest). The event log size is set by logLength.
-func New(store Database, cutoff time.Duration, logLength int) Confluence {
+// New creates a new Confluence writing to the store, and adding items to the
+// search index and, if not nil, the archive. The cutoff specifies the minimum
+// duration an item should be returned by Latest for, but is not guaranteed to
+// be followed exactly (e.g. with a cutoff of 1 hour an item which is 2 hours old
+// may be returned by Latest, but an item that is 5 minutes old must be returned
+// by Latest). The event log size is set by logLength.
+//
+// A Tributary is stopped and marked as dead when its feed has gone, or has
+// failed for longer than dead, if dead is not zero; then died is called, if not
+// nil. When a Tributary reports that its feed has moved, moved is called, if not
+// nil, to replace it. Both are called in order on a separate goroutine, so may
+// take their time.
+//
+// If dedup is not nil, items that Latest returns from the feeds it returns
+// true for are merged when they are the same story, see dedup.Dedup. Items are
+// merged after being filtered, so that a story is kept in every set of feeds it
+// was posted to.
+//
+// If m is not nil the fetches, new items and truncations are recorded in it.
+func New(store Database, index search.Database, archive archive.Database, cutoff time.Duration, logLength int, dead time.Duration, died func(uri string), moved func(from, to string), dedup func(uri string) bool, m *metrics.River) Confluence {
+	period := cutoff
+	if period < 0 {
+		period = -period
+	}
+
 	go func() {
-		for _ = range time.Tick(cutoff) {
+		for _ = range time.Tick(period) {
 			log.Println("truncating feed data")
+			start := time.Now()
 			store.Truncate(cutoff)
+			if m != nil {
+				m.TruncateDuration.Observe(time.Since(start).Seconds(), "river")
+			}
+
+			if archive != nil {
+				start = time.Now()
+				archive.Truncate()
+				if m != nil {
+					m.TruncateDuration.Observe(time.Since(start).Seconds(), "archive")
+				}
+			}
 			log.Println("done truncating")
 		}
 	}()
@@ -62,35 +136,81 @@ func New(store Database, cutoff time.Duration, logLength int) Confluence {
 
 	c := &confluence{
 		store:   store,
+		index:   index,
+		archive: archive,
 		cutoff:  cutoff,
+		dead:    dead,
 		streams: map[string]tributary.Tributary{},
+		health:  map[string]*events.Health{},
 		feeds:   make(chan riverjs.Feed),
 		events:  make(chan events.Event),
 		evs:     evs,
+		moved:   moved,
+		died:    died,
+		dedup:   dedup,
+		metrics: m,
 		quit:    make(chan struct{}),
 	}
 
+	if m != nil {
+		m.Tributaries.SetFunc(c.countRunning)
+	}
+
 	go c.run()
 	return c
 }
 
 func (c *confluence) Latest() []riverjs.Feed {
-	return c.store.Latest(c.cutoff)
+	return c.Filter(nil)
+}
+
+func (c *confluence) Filter(include func(uri string) bool) []riverjs.Feed {
+	latest := c.store.Latest(c.cutoff)
+
+	if include != nil {
+		filtered := []riverjs.Feed{}
+		for _, feed := range latest {
+			if include(feed.SubscriptionURI()) {
+				filtered = append(filtered, feed)
+			}
+		}
+		latest = filtered
+	}
+
+	if c.dedup != nil {
+		latest = dedup.Dedup(latest, c.dedup)
+	}
+
+	return latest
 }
 
 func (c *confluence) Log() []events.Event {
 	return c.evs.List()
 }
 
+func (c *confluence) Search(query search.Query) []search.Result {
+	return c.index.Search(query)
+}
+
+func (c *confluence) Archive(feedURL, before string, limit int) (riverjs.Feed, string, bool) {
+	if c.archive == nil {
+		return riverjs.Feed{}, "", false
+	}
+
+	return c.archive.Items(feedURL, before, limit)
+}
+
 func (c *confluence) Add(stream tributary.Tributary) {
 	name := stream.Name()
 	c.mu.Lock()
 
 	if _, exists := c.streams[name]; exists {
+		c.mu.Unlock()
 		return
 	}
 
 	c.streams[name] = stream
+	c.health[name] = &events.Health{URI: name}
 	c.mu.Unlock()
 
 	stream.Feeds(c.feeds)
@@ -102,18 +222,43 @@ loop:
 	for {
 		select {
 		case feed := <-c.feeds:
+			if c.metrics != nil {
+				c.metrics.Items.Add(float64(len(feed.Items)), feed.SubscriptionURI())
+			}
 			c.store.Add(feed)
+			c.index.Add(feed)
+			if c.archive != nil {
+				c.archive.Add(feed)
+			}
 
 		case event := <-c.events:
-			if event.Code == http.StatusGone {
-				c.Remove(event.URI)
+			c.record(event)
+
+			c.mu.Lock()
+			dead := false
+			// fetching the page of an item does not change the health of the feed
+			if health, ok := c.health[event.URI]; ok && event.Page == "" {
+				health.Add(event)
+				dead = !health.Dead && (event.Code == http.StatusGone ||
+					c.dead > 0 && health.Failures > 1 && event.At.Sub(health.FailingSince) >= c.dead)
 			}
+			c.mu.Unlock()
+
 			c.evs.Prepend(event)
+			if dead {
+				c.kill(event.URI)
+			} else if event.MovedTo != "" && c.moved != nil {
+				c.queue(func() { c.moved(event.URI, event.MovedTo) })
+			}
 
 		case <-c.quit:
-			for _, trib := range c.streams {
-				trib.Stop()
+			c.mu.Lock()
+			for name, trib := range c.streams {
+				if c.running(name) {
+					trib.Stop()
+				}
 			}
+			c.mu.Unlock()
 			break loop
 		}
 	}
@@ -126,17 +271,196 @@ func (c *confluence) Remove(uri string) bool {
 	defer c.mu.Unlock()
 
 	if stream, exists := c.streams[uri]; exists {
-		stream.Stop()
+		if c.running(uri) {
+			stream.Stop()
+		}
 		delete(c.streams, uri)
+		delete(c.health, uri)
+		if c.metrics != nil {
+			c.metrics.Items.Delete(uri)
+		}
 		return true
 	}
 
 	return false
 }
 
+func (c *confluence) Health() []events.Health {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	list := make([]events.Health, 0, len(c.health))
+	for _, health := range c.health {
+		list = append(list, *health)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].URI < list[j].URI })
+
+	return list
+}
+
+func (c *confluence) Pause(uri string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stream, exists := c.streams[uri]
+	if !exists || c.health[uri].Paused {
+		return false
+	}
+
+	if c.running(uri) {
+		stream.Stop()
+	}
+	c.health[uri].Paused = true
+	return true
+}
+
+// Resume and Revive start the Tributary after releasing mu, as starting waits
+// for a fetch in progress, which may be waiting to send its event to run.
+
+func (c *confluence) Resume(uri string) bool {
+	c.mu.Lock()
+	stream, exists := c.streams[uri]
+	if !exists || !c.health[uri].Paused {
+		c.mu.Unlock()
+		return false
+	}
+
+	c.health[uri].Paused = false
+	start := c.running(uri)
+	c.mu.Unlock()
+
+	if start {
+		stream.Start()
+	}
+	return true
+}
+
+func (c *confluence) Revive(uri string) bool {
+	c.mu.Lock()
+	stream, exists := c.streams[uri]
+	if !exists || !c.health[uri].Dead {
+		c.mu.Unlock()
+		return false
+	}
+
+	health := c.health[uri]
+	health.Dead = false
+	health.Failures = 0
+	health.FailingSince = time.Time{}
+	start := c.running(uri)
+	c.mu.Unlock()
+
+	if start {
+		stream.Start()
+	}
+	return true
+}
+
+// kill stops the named Tributary as its feed is dead.
+func (c *confluence) kill(uri string) {
+	c.mu.Lock()
+	stream, exists := c.streams[uri]
+	if !exists {
+		c.mu.Unlock()
+		return
+	}
+
+	if c.running(uri) {
+		stream.Stop()
+	}
+	c.health[uri].Dead = true
+	c.mu.Unlock()
+
+	log.Printf("%s is dead\n", uri)
+	if c.died != nil {
+		c.queue(func() { c.died(uri) })
+	}
+}
+
+// queue calls f after any calls already queued, without waiting for it.
+func (c *confluence) queue(f func()) {
+	c.pendingMu.Lock()
+	c.pending = append(c.pending, f)
+	first := len(c.pending) == 1
+	c.pendingMu.Unlock()
+
+	if first {
+		go c.callPending()
+	}
+}
+
+// callPending makes the queued calls until there are none left.
+func (c *confluence) callPending() {
+	for {
+		c.pendingMu.Lock()
+		f := c.pending[0]
+		c.pendingMu.Unlock()
+
+		f()
+
+		c.pendingMu.Lock()
+		c.pending = c.pending[1:]
+		empty := len(c.pending) == 0
+		c.pendingMu.Unlock()
+
+		if empty {
+			return
+		}
+	}
+}
+
+// record adds the fetch that event describes to the metrics, if any. Events
+// for fetches that did not make a request are not recorded. The time the event
+// waited to be received is recorded for every event, as the channels are not
+// buffered this is how far behind run is.
+func (c *confluence) record(event events.Event) {
+	if c.metrics == nil {
+		return
+	}
+
+	if !event.At.IsZero() {
+		c.metrics.EventWait.Observe(time.Since(event.At).Seconds())
+	}
+
+	if event.Page != "" {
+		c.metrics.Extractions.Inc(event.Status())
+		return
+	}
+
+	if event.Code != -1 || event.Error != "" {
+		c.metrics.Fetches.Inc(event.Status())
+		c.metrics.FetchDuration.Observe(event.Duration.Seconds())
+	}
+}
+
+// countRunning returns the number of Tributaries that are fetching.
+func (c *confluence) countRunning() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := 0
+	for uri := range c.streams {
+		if c.running(uri) {
+			n++
+		}
+	}
+	return float64(n)
+}
+
+// running returns true if the named Tributary should be fetching, that is it is
+// neither paused or dead. It must be called with mu held.
+func (c *confluence) running(uri string) bool {
+	health := c.health[uri]
+	return !health.Paused && !health.Dead
+}
+
 func (c *confluence) Close() error {
 	c.quit <- struct{}{}
 	<-c.quit
 
+	if c.metrics != nil {
+		c.metrics.Tributaries.Delete()
+	}
+
 	return nil
 }
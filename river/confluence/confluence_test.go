@@ -1,6 +1,7 @@
 package confluence_test
 
 import (
+	"strconv"
 	"testing"
 	"time"
 
@@ -8,12 +9,14 @@ import (
 	"hawx.me/code/riviera/river/confluence"
 	"hawx.me/code/riviera/river/data/memdata"
 	"hawx.me/code/riviera/river/events"
+	"hawx.me/code/riviera/river/metrics"
 	"hawx.me/code/riviera/river/riverjs"
 )
 
 func TestConfluence(t *testing.T) {
 	db, _ := memdata.Open().Confluence()
-	c := confluence.New(db, -time.Minute, 3)
+	index, _ := memdata.Open().Search()
+	c := confluence.New(db, index, nil, -time.Minute, 3, 0, nil, nil, nil, nil)
 
 	assert.Empty(t, c.Latest())
 }
@@ -60,7 +63,8 @@ func (d *dummyTrib) Stop() {
 
 func TestConfluenceWithTributary(t *testing.T) {
 	db, _ := memdata.Open().Confluence()
-	c := confluence.New(db, -time.Minute, 3)
+	index, _ := memdata.Open().Search()
+	c := confluence.New(db, index, nil, -time.Minute, 3, 0, nil, nil, nil, nil)
 
 	now := time.Now().Local().Round(time.Second)
 
@@ -94,7 +98,8 @@ func TestConfluenceWithTributary(t *testing.T) {
 
 func TestConfluenceWithTributaryWhenTooOld(t *testing.T) {
 	db, _ := memdata.Open().Confluence()
-	c := confluence.New(db, -time.Minute, 3)
+	index, _ := memdata.Open().Search()
+	c := confluence.New(db, index, nil, -time.Minute, 3, 0, nil, nil, nil, nil)
 
 	feed := riverjs.Feed{
 		FeedTitle:      "hey",
@@ -107,3 +112,297 @@ func TestConfluenceWithTributaryWhenTooOld(t *testing.T) {
 
 	assert.Empty(t, c.Latest())
 }
+
+func TestConfluenceHealthAndPause(t *testing.T) {
+	assert := assert.New(t)
+
+	db, _ := memdata.Open().Confluence()
+	index, _ := memdata.Open().Search()
+	c := confluence.New(db, index, nil, -time.Minute, 3, 0, nil, nil, nil, nil)
+
+	trib := newDummyTrib(riverjs.Feed{}, "dummy4")
+	c.Add(trib)
+	c.Add(trib)
+	trib.Start()
+
+	assert.Equal([]events.Health{{URI: "dummy4"}}, c.Health())
+
+	now := time.Now()
+	trib.events <- events.Event{URI: "dummy4", Code: 500, At: now}
+	trib.events <- events.Event{URI: "unknown", Code: 500, At: now}
+	trib.events <- events.Event{URI: "dummy4", Page: "http://page", Code: 500, At: now.Add(time.Second)}
+	time.Sleep(time.Millisecond)
+
+	if health := c.Health(); assert.Len(health, 1) {
+		assert.Equal(1, health[0].Failures)
+		assert.Equal(now, health[0].LastFailure)
+	}
+
+	assert.True(c.Pause("dummy4"))
+	assert.True(trib.stopped)
+	assert.True(c.Health()[0].Paused)
+	assert.False(c.Pause("dummy4"))
+
+	assert.True(c.Resume("dummy4"))
+	assert.False(trib.stopped)
+	assert.False(c.Health()[0].Paused)
+	assert.False(c.Resume("dummy4"))
+
+	c.Remove("dummy4")
+	assert.Empty(c.Health())
+}
+
+// fetchingTrib sends events and a feed when started, as a Tributary that must
+// wait for a fetch in progress to finish does.
+type fetchingTrib struct{ *dummyTrib }
+
+func (d fetchingTrib) Start() {
+	d.stopped = false
+	d.events <- events.Event{URI: d.name, Code: 200, At: time.Now()}
+	d.push()
+}
+
+func TestConfluenceStartWhileFetching(t *testing.T) {
+	assert := assert.New(t)
+
+	db, _ := memdata.Open().Confluence()
+	index, _ := memdata.Open().Search()
+	c := confluence.New(db, index, nil, -time.Minute, 3, 0, nil, nil, nil, nil)
+
+	trib := fetchingTrib{newDummyTrib(riverjs.Feed{}, "dummy-fetching")}
+	c.Add(trib)
+	trib.Start()
+
+	started := func(start func(string) bool) bool {
+		done := make(chan bool)
+		go func() { done <- start("dummy-fetching") }()
+
+		select {
+		case ok := <-done:
+			return ok
+		case <-time.After(time.Second):
+			t.Fatal("timed out starting tributary")
+			return false
+		}
+	}
+
+	assert.True(c.Pause("dummy-fetching"))
+	assert.True(started(c.Resume))
+
+	trib.events <- events.Event{URI: "dummy-fetching", Code: 410, At: time.Now()}
+	time.Sleep(time.Millisecond)
+	assert.True(started(c.Revive))
+}
+
+func TestConfluenceCallsMoved(t *testing.T) {
+	db, _ := memdata.Open().Confluence()
+	index, _ := memdata.Open().Search()
+
+	moves := make(chan [2]string, 1)
+	release := make(chan struct{})
+	defer close(release)
+
+	c := confluence.New(db, index, nil, -time.Minute, 3, 0, nil, func(from, to string) {
+		moves <- [2]string{from, to}
+		<-release
+	}, nil, nil)
+
+	trib := newDummyTrib(riverjs.Feed{}, "dummy5")
+	c.Add(trib)
+	trib.Start()
+
+	trib.events <- events.Event{URI: "dummy5", Code: 200}
+	trib.events <- events.Event{URI: "dummy5", Code: 200, MovedTo: "dummy6"}
+
+	select {
+	case move := <-moves:
+		assert.Equal(t, [2]string{"dummy5", "dummy6"}, move)
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+
+	// feeds are still read while the move is made
+	select {
+	case trib.feeds <- riverjs.Feed{}:
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+
+	if log := c.Log(); assert.Len(t, log, 2) {
+		assert.Equal(t, "dummy6", log[0].MovedTo)
+	}
+}
+
+func TestConfluenceMarksDead(t *testing.T) {
+	assert := assert.New(t)
+
+	db, _ := memdata.Open().Confluence()
+	index, _ := memdata.Open().Search()
+
+	died := make(chan string, 2)
+	c := confluence.New(db, index, nil, -time.Minute, 3, time.Hour, func(uri string) {
+		died <- uri
+	}, nil, nil, nil)
+
+	gone := newDummyTrib(riverjs.Feed{}, "dummy7")
+	c.Add(gone)
+	gone.Start()
+
+	failing := newDummyTrib(riverjs.Feed{}, "dummy8")
+	c.Add(failing)
+	failing.Start()
+
+	now := time.Now()
+	gone.events <- events.Event{URI: "dummy7", Code: 410, At: now}
+	failing.events <- events.Event{URI: "dummy8", Code: 500, At: now.Add(-2 * time.Hour)}
+	failing.events <- events.Event{URI: "dummy8", Code: 200, At: now.Add(-time.Hour)}
+	failing.events <- events.Event{URI: "dummy8", Code: 500, At: now.Add(-time.Hour)}
+	failing.events <- events.Event{URI: "dummy8", Code: 500, At: now.Add(-time.Minute)}
+
+	select {
+	case uri := <-died:
+		assert.Equal("dummy7", uri)
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+	assert.True(gone.stopped)
+	assert.False(failing.stopped)
+
+	failing.events <- events.Event{URI: "dummy8", Code: 500, At: now}
+	select {
+	case uri := <-died:
+		assert.Equal("dummy8", uri)
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+	assert.True(failing.stopped)
+
+	if health := c.Health(); assert.Len(health, 2) {
+		assert.True(health[0].Dead)
+		assert.True(health[1].Dead)
+	}
+
+	// paused feeds stay stopped when revived
+	assert.True(c.Pause("dummy8"))
+	assert.True(c.Revive("dummy8"))
+	assert.True(failing.stopped)
+	assert.True(c.Resume("dummy8"))
+	assert.False(failing.stopped)
+
+	assert.True(c.Revive("dummy7"))
+	assert.False(gone.stopped)
+	assert.False(c.Revive("dummy7"))
+
+	if health := c.Health(); assert.Len(health, 2) {
+		assert.False(health[0].Dead)
+		assert.Equal(0, health[0].Failures)
+	}
+}
+
+func TestConfluenceDedup(t *testing.T) {
+	assert := assert.New(t)
+
+	db, _ := memdata.Open().Confluence()
+	index, _ := memdata.Open().Search()
+	c := confluence.New(db, index, nil, -time.Minute, 3, 0, nil, nil, func(uri string) bool {
+		return uri != "http://c"
+	}, nil)
+
+	now := time.Now()
+	feeds := []riverjs.Feed{
+		{FeedURL: "http://a", WhenLastUpdate: riverjs.Time(now.Add(-2 * time.Second)), Items: []riverjs.Item{
+			{Title: "Story", Link: "http://example.com/story"},
+		}},
+		{FeedURL: "http://b", WhenLastUpdate: riverjs.Time(now.Add(-time.Second)), Items: []riverjs.Item{
+			{Title: "Story", Link: "https://example.com/story?utm_source=b"},
+		}},
+		{FeedURL: "http://c", WhenLastUpdate: riverjs.Time(now), Items: []riverjs.Item{
+			{Title: "Story", Link: "http://example.com/story"},
+		}},
+	}
+	for i, feed := range feeds {
+		trib := newDummyTrib(feed, "dummy-dedup"+strconv.Itoa(i))
+		c.Add(trib)
+		trib.Start()
+	}
+
+	latest := c.Latest()
+	if assert.Len(latest, 2) {
+		assert.Equal("http://c", latest[0].FeedURL)
+		assert.Nil(latest[0].Items[0].AlsoIn)
+
+		assert.Equal("http://a", latest[1].FeedURL)
+		assert.Equal([]riverjs.Source{
+			{FeedURL: "http://b", Link: "https://example.com/story?utm_source=b"},
+		}, latest[1].Items[0].AlsoIn)
+	}
+}
+
+func TestConfluenceFilterDedup(t *testing.T) {
+	assert := assert.New(t)
+
+	db, _ := memdata.Open().Confluence()
+	index, _ := memdata.Open().Search()
+	c := confluence.New(db, index, nil, -time.Minute, 3, 0, nil, nil, func(string) bool {
+		return true
+	}, nil)
+
+	now := time.Now()
+	feeds := []riverjs.Feed{
+		{URI: "http://a", FeedURL: "http://a/feed", WhenLastUpdate: riverjs.Time(now.Add(-time.Second)), Items: []riverjs.Item{
+			{Title: "Story", Link: "http://example.com/story"},
+		}},
+		{URI: "http://b", FeedURL: "http://b/feed", WhenLastUpdate: riverjs.Time(now), Items: []riverjs.Item{
+			{Title: "Story", Link: "http://example.com/story"},
+		}},
+	}
+	for i, feed := range feeds {
+		trib := newDummyTrib(feed, "dummy-filter"+strconv.Itoa(i))
+		c.Add(trib)
+		trib.Start()
+	}
+
+	if latest := c.Latest(); assert.Len(latest, 1) {
+		assert.Equal("http://a", latest[0].URI)
+	}
+
+	filtered := c.Filter(func(uri string) bool { return uri == "http://b" })
+	if assert.Len(filtered, 1) {
+		assert.Equal("http://b", filtered[0].URI)
+		if assert.Len(filtered[0].Items, 1) {
+			assert.Nil(filtered[0].Items[0].AlsoIn)
+		}
+	}
+}
+
+func TestConfluenceMetrics(t *testing.T) {
+	assert := assert.New(t)
+
+	db, _ := memdata.Open().Confluence()
+	index, _ := memdata.Open().Search()
+	m := metrics.NewRiver(metrics.NewRegistry())
+	c := confluence.New(db, index, nil, -time.Minute, 3, 0, nil, nil, nil, m)
+
+	trib := newDummyTrib(riverjs.Feed{URI: "dummy9", FeedURL: "http://a", Items: []riverjs.Item{{ID: "1"}, {ID: "2"}}}, "dummy9")
+	c.Add(trib)
+	trib.Start()
+
+	trib.events <- events.Event{URI: "dummy9", Code: 200, Duration: time.Second, At: time.Now()}
+	trib.events <- events.Event{URI: "dummy9", Code: -1}
+	trib.events <- events.Event{URI: "dummy9", Code: 404, Page: "http://a/1"}
+	// the next event is only received once the last has been recorded
+	trib.events <- events.Event{URI: "dummy9", Code: -1}
+
+	assert.Equal(float64(2), m.Items.Value("dummy9"))
+	assert.Equal(float64(1), m.Fetches.Value("ok"))
+	assert.Equal(uint64(1), m.FetchDuration.Count())
+	assert.Equal(float64(1), m.Extractions.Value("error"))
+	assert.Equal(float64(1), m.Tributaries.Value())
+	assert.Equal(uint64(1), m.EventWait.Count())
+
+	c.Remove("dummy9")
+	assert.Equal(float64(0), m.Items.Value("dummy9"))
+
+	c.Close()
+	assert.Equal(float64(0), m.Tributaries.Value())
+}
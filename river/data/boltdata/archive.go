@@ -0,0 +1,149 @@
+package boltdata
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"hawx.me/code/riviera/river/archive"
+	"hawx.me/code/riviera/river/riverjs"
+)
+
+// An archiveDatabase keeps individual items. The archive bucket contains a
+// nested bucket for each feed, with items keyed by their publish date then ID
+// so that they can be read in order. The details of each feed are kept in the
+// archive.feeds bucket.
+type archiveDatabase struct {
+	db        *bolt.DB
+	retention archive.Retention
+}
+
+var (
+	archiveBucketName      = []byte("archive")
+	archiveFeedsBucketName = []byte("archive.feeds")
+)
+
+func newArchiveDatabase(db *bolt.DB, retention archive.Retention) (archive.Database, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(archiveBucketName); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(archiveFeedsBucketName)
+		return err
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("bucket: %s", err)
+	}
+
+	return &archiveDatabase{db: db, retention: retention}, nil
+}
+
+func archiveKey(item riverjs.Item) []byte {
+	return []byte(item.PubDate.UTC().Format(time.RFC3339) + " " + item.ID)
+}
+
+func (d *archiveDatabase) Add(feed riverjs.Feed) {
+	d.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(archiveBucketName).CreateBucketIfNotExists([]byte(feed.FeedURL))
+		if err != nil {
+			return err
+		}
+
+		for _, item := range feed.Items {
+			value, _ := json.Marshal(item)
+			if err := b.Put(archiveKey(item), value); err != nil {
+				return err
+			}
+		}
+
+		details := feed
+		details.Items = nil
+		value, _ := json.Marshal(details)
+
+		return tx.Bucket(archiveFeedsBucketName).Put([]byte(feed.FeedURL), value)
+	})
+}
+
+func (d *archiveDatabase) Items(feedURL, before string, limit int) (feed riverjs.Feed, next string, ok bool) {
+	d.db.View(func(tx *bolt.Tx) error {
+		details := tx.Bucket(archiveFeedsBucketName).Get([]byte(feedURL))
+		b := tx.Bucket(archiveBucketName).Bucket([]byte(feedURL))
+		if details == nil || b == nil {
+			return nil
+		}
+
+		ok = true
+		json.Unmarshal(details, &feed)
+		feed.Items = []riverjs.Item{}
+
+		c := b.Cursor()
+
+		var k, v []byte
+		if before == "" {
+			k, v = c.Last()
+		} else {
+			// Seek finds the first key >= before, which will be the last item
+			// returned previously, or the next newest if it has been removed.
+			c.Seek([]byte(before))
+			k, v = c.Prev()
+		}
+
+		for ; k != nil && len(feed.Items) < limit; k, v = c.Prev() {
+			var item riverjs.Item
+			json.Unmarshal(v, &item)
+			feed.Items = append(feed.Items, item)
+			next = string(k)
+		}
+
+		if k == nil {
+			next = ""
+		}
+		return nil
+	})
+
+	return
+}
+
+func (d *archiveDatabase) Truncate() {
+	d.db.Update(func(tx *bolt.Tx) error {
+		oldest := []byte(time.Now().Add(-d.retention.MaxAge).UTC().Format(time.RFC3339))
+
+		var names [][]byte
+		tx.Bucket(archiveBucketName).ForEach(func(name, _ []byte) error {
+			names = append(names, name)
+			return nil
+		})
+
+		for _, name := range names {
+			b := tx.Bucket(archiveBucketName).Bucket(name)
+			c := b.Cursor()
+
+			if d.retention.MaxAge > 0 {
+				for k, _ := c.First(); k != nil && bytes.Compare(k, oldest) < 0; k, _ = c.First() {
+					if err := c.Delete(); err != nil {
+						return err
+					}
+				}
+			}
+
+			if d.retention.MaxItems > 0 {
+				count := 0
+				for k, _ := c.First(); k != nil; k, _ = c.Next() {
+					count++
+				}
+
+				for ; count > d.retention.MaxItems; count-- {
+					c.First()
+					if err := c.Delete(); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,101 @@
+package boltdata
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"hawx.me/code/riviera/river/archive"
+	"hawx.me/code/riviera/river/data"
+	"hawx.me/code/riviera/river/riverjs"
+)
+
+func itemIDs(feed riverjs.Feed) []string {
+	ids := []string{}
+	for _, item := range feed.Items {
+		ids = append(ids, item.ID)
+	}
+	return ids
+}
+
+func TestArchive(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "riviera-bolt-test")
+	defer os.RemoveAll(dir)
+
+	store, err := Open(dir + "/test.db")
+	assert.Nil(err)
+
+	db, err := store.(data.Archiver).Archive(archive.Retention{})
+	assert.Nil(err)
+
+	_, _, ok := db.Items("http://cool", "", 10)
+	assert.False(ok)
+
+	now := time.Now().Round(time.Second)
+
+	db.Add(riverjs.Feed{FeedURL: "http://cool", FeedTitle: "Cool", Items: []riverjs.Item{
+		{ID: "1", PubDate: riverjs.Time(now.Add(-3 * time.Hour))},
+		{ID: "2", PubDate: riverjs.Time(now.Add(-2 * time.Hour))},
+	}})
+	db.Add(riverjs.Feed{FeedURL: "http://cool", FeedTitle: "Cooler", Items: []riverjs.Item{
+		{ID: "3", PubDate: riverjs.Time(now.Add(-time.Hour))},
+	}})
+	db.Add(riverjs.Feed{FeedURL: "http://what", FeedTitle: "What", Items: []riverjs.Item{
+		{ID: "4", PubDate: riverjs.Time(now)},
+	}})
+
+	feed, next, ok := db.Items("http://cool", "", 2)
+	if assert.True(ok) {
+		assert.Equal("Cooler", feed.FeedTitle)
+		assert.Equal([]string{"3", "2"}, itemIDs(feed))
+		assert.NotEmpty(next)
+	}
+
+	feed, next, ok = db.Items("http://cool", next, 2)
+	if assert.True(ok) {
+		assert.Equal([]string{"1"}, itemIDs(feed))
+		assert.Empty(next)
+	}
+
+	feed, next, _ = db.Items("http://cool", "", 3)
+	assert.Equal([]string{"3", "2", "1"}, itemIDs(feed))
+	assert.Empty(next)
+}
+
+func TestArchiveTruncate(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "riviera-bolt-test")
+	defer os.RemoveAll(dir)
+
+	store, err := Open(dir + "/test.db")
+	assert.Nil(err)
+
+	db, err := store.(data.Archiver).Archive(archive.Retention{MaxAge: 24 * time.Hour, MaxItems: 2})
+	assert.Nil(err)
+
+	now := time.Now().Round(time.Second)
+
+	db.Add(riverjs.Feed{FeedURL: "http://cool", Items: []riverjs.Item{
+		{ID: "1", PubDate: riverjs.Time(now.Add(-48 * time.Hour))},
+		{ID: "2", PubDate: riverjs.Time(now.Add(-3 * time.Hour))},
+		{ID: "3", PubDate: riverjs.Time(now.Add(-2 * time.Hour))},
+		{ID: "4", PubDate: riverjs.Time(now.Add(-time.Hour))},
+	}})
+	db.Add(riverjs.Feed{FeedURL: "http://what", Items: []riverjs.Item{
+		{ID: "5", PubDate: riverjs.Time(now.Add(-48 * time.Hour))},
+		{ID: "6", PubDate: riverjs.Time(now)},
+	}})
+
+	db.Truncate()
+
+	feed, _, _ := db.Items("http://cool", "", 10)
+	assert.Equal([]string{"4", "3"}, itemIDs(feed))
+
+	feed, _, _ = db.Items("http://what", "", 10)
+	assert.Equal([]string{"6"}, itemIDs(feed))
+}
@@ -4,8 +4,11 @@ package boltdata
 import (
 	"github.com/boltdb/bolt"
 	"hawx.me/code/riviera/feed"
+	"hawx.me/code/riviera/river/archive"
 	"hawx.me/code/riviera/river/confluence"
 	"hawx.me/code/riviera/river/data"
+	"hawx.me/code/riviera/river/readstate"
+	"hawx.me/code/riviera/river/search"
 )
 
 type database struct {
@@ -26,10 +29,36 @@ func (d *database) Confluence() (confluence.Database, error) {
 	return newConfluenceDatabase(d.db)
 }
 
+func (d *database) Archive(retention archive.Retention) (archive.Database, error) {
+	return newArchiveDatabase(d.db, retention)
+}
+
+func (d *database) Search() (search.Database, error) {
+	return newSearchDatabase(d.db)
+}
+
+func (d *database) ReadState() (readstate.Database, error) {
+	return newReadDatabase(d.db)
+}
+
 func (d *database) Feed(name string) (feed.Database, error) {
 	return newFeedDatabase(d.db, name)
 }
 
+func (d *database) MoveFeed(from, to string) error {
+	return moveFeed(d.db, from, to)
+}
+
+func (d *database) Size() (int64, error) {
+	var size int64
+	err := d.db.View(func(tx *bolt.Tx) error {
+		size = tx.Size()
+		return nil
+	})
+
+	return size, err
+}
+
 func (d *database) Close() error {
 	return d.db.Close()
 }
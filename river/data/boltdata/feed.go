@@ -1,6 +1,7 @@
 package boltdata
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"github.com/boltdb/bolt"
@@ -13,10 +14,19 @@ type feedDatabase struct {
 	name []byte
 }
 
-var in = []byte("in")
+var (
+	in = []byte("in")
+
+	// feedStateBucketName is the bucket containing the fetch state of each feed,
+	// keyed by name.
+	feedStateBucketName = []byte("feed.state")
+)
 
 func newFeedDatabase(db *bolt.DB, name string) (feed.Database, error) {
 	err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(feedStateBucketName); err != nil {
+			return err
+		}
 		_, err := tx.CreateBucketIfNotExists([]byte(name))
 		return err
 	})
@@ -32,8 +42,9 @@ func (d *feedDatabase) Contains(key string) bool {
 	ok := false
 
 	d.db.View(func(tx *bolt.Tx) error {
+		// the bucket will be missing if the feed has been moved
 		b := tx.Bucket(d.name)
-		if b.Get([]byte(key)) != nil {
+		if b != nil && b.Get([]byte(key)) != nil {
 			ok = true
 		}
 		return nil
@@ -45,8 +56,72 @@ func (d *feedDatabase) Contains(key string) bool {
 
 	d.db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket(d.name)
+		if b == nil {
+			return nil
+		}
 		return b.Put([]byte(key), in)
 	})
 
 	return false
 }
+
+func (d *feedDatabase) State() (state feed.State) {
+	d.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(feedStateBucketName).Get(d.name); v != nil {
+			return json.Unmarshal(v, &state)
+		}
+		return nil
+	})
+
+	return
+}
+
+func (d *feedDatabase) SetState(state feed.State) {
+	d.db.Update(func(tx *bolt.Tx) error {
+		value, err := json.Marshal(state)
+		if err != nil {
+			return err
+		}
+
+		return tx.Bucket(feedStateBucketName).Put(d.name, value)
+	})
+}
+
+// moveFeed copies the known items of the feed bucket from into the feed bucket
+// to, along with its state if to has none, then deletes from.
+func moveFeed(db *bolt.DB, from, to string) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		old := tx.Bucket([]byte(from))
+		if old == nil {
+			return nil
+		}
+
+		b, err := tx.CreateBucketIfNotExists([]byte(to))
+		if err != nil {
+			return err
+		}
+		if err := old.ForEach(func(k, v []byte) error {
+			return b.Put(k, v)
+		}); err != nil {
+			return err
+		}
+		if err := tx.DeleteBucket([]byte(from)); err != nil {
+			return err
+		}
+
+		states, err := tx.CreateBucketIfNotExists(feedStateBucketName)
+		if err != nil {
+			return err
+		}
+		if state := states.Get([]byte(from)); state != nil {
+			if states.Get([]byte(to)) == nil {
+				if err := states.Put([]byte(to), append([]byte{}, state...)); err != nil {
+					return err
+				}
+			}
+			return states.Delete([]byte(from))
+		}
+
+		return nil
+	})
+}
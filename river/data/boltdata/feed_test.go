@@ -4,8 +4,10 @@ import (
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"hawx.me/code/riviera/feed"
 )
 
 func TestBucket(t *testing.T) {
@@ -31,3 +33,77 @@ func TestBucket(t *testing.T) {
 	assert.False(bucket2.Contains(key))
 	assert.True(bucket2.Contains(key))
 }
+
+func TestBucketState(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "riviera-bolt-test")
+	defer os.RemoveAll(dir)
+
+	assert := assert.New(t)
+
+	db, err := Open(dir + "/test.db")
+	assert.Nil(err)
+
+	bucket, err := db.Feed("test")
+	assert.Nil(err)
+
+	assert.Equal(feed.State{}, bucket.State())
+
+	now := time.Now().UTC().Round(time.Second)
+	state := feed.State{
+		ETag:         "abc",
+		LastModified: "Mon, 02 Jan 2006 15:04:05 GMT",
+		LastFetch:    now,
+		TTL:          60,
+	}
+	bucket.SetState(state)
+
+	// survives reopening
+	db.Close()
+	db, err = Open(dir + "/test.db")
+	assert.Nil(err)
+	defer db.Close()
+
+	bucket, _ = db.Feed("test")
+	assert.Equal(state, bucket.State())
+
+	bucket2, _ := db.Feed("test2")
+	assert.Equal(feed.State{}, bucket2.State())
+}
+
+func TestMoveFeed(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "riviera-bolt-test")
+	defer os.RemoveAll(dir)
+
+	assert := assert.New(t)
+
+	db, err := Open(dir + "/test.db")
+	assert.Nil(err)
+
+	old, _ := db.Feed("http://old")
+	old.Contains("1")
+	old.SetState(feed.State{ETag: "abc"})
+
+	existing, _ := db.Feed("http://existing")
+	existing.Contains("2")
+
+	assert.Nil(db.MoveFeed("http://old", "http://new"))
+	assert.Nil(db.MoveFeed("http://missing", "http://new"))
+
+	moved, _ := db.Feed("http://new")
+	assert.True(moved.Contains("1"))
+	assert.Equal(feed.State{ETag: "abc"}, moved.State())
+
+	// the old feed is no longer known, and is safe to use
+	assert.False(old.Contains("1"))
+	reopened, _ := db.Feed("http://old")
+	assert.False(reopened.Contains("1"))
+	assert.Equal(feed.State{}, reopened.State())
+
+	// moving into a known feed merges
+	moved.Contains("3")
+	assert.Nil(db.MoveFeed("http://new", "http://existing"))
+	assert.True(existing.Contains("1"))
+	assert.True(existing.Contains("2"))
+	assert.True(existing.Contains("3"))
+	assert.Equal(feed.State{ETag: "abc"}, existing.State())
+}
@@ -0,0 +1,116 @@
+package boltdata
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"hawx.me/code/riviera/river/readstate"
+)
+
+// A readDatabase records read items in the read bucket, with the time they were
+// marked as the value. The high-water mark is kept in the read.mark bucket.
+type readDatabase struct {
+	db *bolt.DB
+}
+
+var (
+	readBucketName     = []byte("read")
+	readMarkBucketName = []byte("read.mark")
+	readMarkKey        = []byte("mark")
+)
+
+func newReadDatabase(db *bolt.DB) (readstate.Database, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(readBucketName); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(readMarkBucketName)
+		return err
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("bucket: %s", err)
+	}
+
+	return &readDatabase{db}, nil
+}
+
+func (d *readDatabase) MarkRead(keys ...string) {
+	d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(readBucketName)
+		now := []byte(time.Now().UTC().Format(time.RFC3339))
+
+		for _, key := range keys {
+			if err := b.Put([]byte(key), now); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (d *readDatabase) Read(key string) (ok bool) {
+	d.db.View(func(tx *bolt.Tx) error {
+		ok = tx.Bucket(readBucketName).Get([]byte(key)) != nil
+		return nil
+	})
+
+	return
+}
+
+func (d *readDatabase) Mark() (mark time.Time) {
+	d.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(readMarkBucketName).Get(readMarkKey); v != nil {
+			return mark.UnmarshalText(v)
+		}
+		return nil
+	})
+
+	return
+}
+
+func (d *readDatabase) SetMark(t time.Time) {
+	d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(readMarkBucketName)
+
+		var mark time.Time
+		if v := b.Get(readMarkKey); v != nil {
+			mark.UnmarshalText(v)
+		}
+		if !t.After(mark) {
+			return nil
+		}
+
+		value, err := t.MarshalText()
+		if err != nil {
+			return err
+		}
+		return b.Put(readMarkKey, value)
+	})
+}
+
+func (d *readDatabase) Truncate(cutoff time.Duration) {
+	d.db.Update(func(tx *bolt.Tx) error {
+		max := time.Now().UTC().Add(cutoff).Format(time.RFC3339)
+
+		b := tx.Bucket(readBucketName)
+
+		var old [][]byte
+		b.ForEach(func(k, v []byte) error {
+			if string(v) < max {
+				old = append(old, k)
+			}
+			return nil
+		})
+
+		for _, k := range old {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,43 @@
+package boltdata
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadState(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "riviera-bolt-test")
+	defer os.RemoveAll(dir)
+
+	store, err := Open(dir + "/test.db")
+	assert.Nil(err)
+
+	db, err := store.ReadState()
+	assert.Nil(err)
+
+	assert.False(db.Read("http://cool 1"))
+	db.MarkRead("http://cool 1", "http://cool 2")
+	assert.True(db.Read("http://cool 1"))
+	assert.True(db.Read("http://cool 2"))
+	assert.False(db.Read("http://cool 3"))
+
+	now := time.Now().Round(time.Second)
+	assert.True(db.Mark().IsZero())
+	db.SetMark(now)
+	assert.True(now.Equal(db.Mark()))
+	db.SetMark(now.Add(-time.Hour))
+	assert.True(now.Equal(db.Mark()))
+
+	db.Truncate(-time.Minute)
+	assert.True(db.Read("http://cool 1"))
+
+	db.Truncate(time.Minute)
+	assert.False(db.Read("http://cool 1"))
+	assert.False(db.Read("http://cool 2"))
+}
@@ -0,0 +1,122 @@
+package boltdata
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+	"hawx.me/code/riviera/river/riverjs"
+	"hawx.me/code/riviera/river/search"
+)
+
+// A searchDatabase persists an inverted index of items. The documents bucket
+// maps a document ID to the Document, and the postings bucket contains a nested
+// bucket for each term mapping document IDs to the positions of the term.
+type searchDatabase struct {
+	db *bolt.DB
+}
+
+var (
+	documentsBucketName = []byte("search.documents")
+	postingsBucketName  = []byte("search.postings")
+)
+
+func newSearchDatabase(db *bolt.DB) (search.Database, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(documentsBucketName); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(postingsBucketName)
+		return err
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("bucket: %s", err)
+	}
+
+	return &searchDatabase{db}, nil
+}
+
+func (d *searchDatabase) Add(feed riverjs.Feed) {
+	docs, terms := search.Documents(feed)
+
+	d.db.Update(func(tx *bolt.Tx) error {
+		documents := tx.Bucket(documentsBucketName)
+		postings := tx.Bucket(postingsBucketName)
+
+		for i, doc := range docs {
+			id := []byte(doc.ID)
+			if documents.Get(id) != nil {
+				continue
+			}
+
+			value, _ := json.Marshal(doc)
+			if err := documents.Put(id, value); err != nil {
+				return err
+			}
+
+			for term, positions := range terms[i] {
+				b, err := postings.CreateBucketIfNotExists([]byte(term))
+				if err != nil {
+					return err
+				}
+
+				value, _ := json.Marshal(positions)
+				if err := b.Put(id, value); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+func (d *searchDatabase) Search(query search.Query) []search.Result {
+	var results []search.Result
+
+	d.db.View(func(tx *bolt.Tx) error {
+		results = search.Run(searchIndex{tx}, query)
+		return nil
+	})
+
+	return results
+}
+
+// searchIndex provides a search.Index within a transaction.
+type searchIndex struct {
+	tx *bolt.Tx
+}
+
+func (i searchIndex) Postings(term string) map[string][]int {
+	postings := map[string][]int{}
+
+	b := i.tx.Bucket(postingsBucketName).Bucket([]byte(term))
+	if b == nil {
+		return postings
+	}
+
+	b.ForEach(func(k, v []byte) error {
+		var positions []int
+		json.Unmarshal(v, &positions)
+		postings[string(k)] = positions
+		return nil
+	})
+
+	return postings
+}
+
+func (i searchIndex) Document(id string) (search.Document, bool) {
+	var doc search.Document
+
+	v := i.tx.Bucket(documentsBucketName).Get([]byte(id))
+	if v == nil {
+		return doc, false
+	}
+
+	return doc, json.Unmarshal(v, &doc) == nil
+}
+
+func (i searchIndex) Count() int {
+	return i.tx.Bucket(documentsBucketName).Stats().KeyN
+}
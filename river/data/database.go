@@ -4,7 +4,10 @@ package data
 
 import (
 	"hawx.me/code/riviera/feed"
+	"hawx.me/code/riviera/river/archive"
 	"hawx.me/code/riviera/river/confluence"
+	"hawx.me/code/riviera/river/readstate"
+	"hawx.me/code/riviera/river/search"
 )
 
 // Database is a key-value store with data arranged in buckets.
@@ -12,9 +15,33 @@ type Database interface {
 	// Feed returns a database for storing known items from a named feed.
 	Feed(name string) (feed.Database, error)
 
+	// MoveFeed moves the known items and state of the feed named from to the
+	// feed named to. Items already known for to are kept.
+	MoveFeed(from, to string) error
+
 	// Confluence returns a database for storing past rivers.
 	Confluence() (confluence.Database, error)
 
+	// Search returns a database for indexing and searching past items.
+	Search() (search.Database, error)
+
+	// ReadState returns a database for recording which items have been read.
+	ReadState() (readstate.Database, error)
+
 	// Close releases all database resources.
 	Close() error
 }
+
+// An Archiver is a Database that is also able to keep a long-term archive of
+// items.
+type Archiver interface {
+	// Archive returns a database for keeping items, removing those that fall
+	// outside of the retention policy when truncated.
+	Archive(retention archive.Retention) (archive.Database, error)
+}
+
+// A Sizer is a Database that is able to report how large it is.
+type Sizer interface {
+	// Size returns the size of the database in bytes.
+	Size() (int64, error)
+}
@@ -2,24 +2,65 @@
 package memdata
 
 import (
+	"sync"
+
 	"hawx.me/code/riviera/feed"
 	"hawx.me/code/riviera/river/confluence"
 	"hawx.me/code/riviera/river/data"
+	"hawx.me/code/riviera/river/readstate"
+	"hawx.me/code/riviera/river/search"
 )
 
-type database struct{}
+type database struct {
+	feeds map[string]*feedDatabase
+	mu    sync.Mutex
+}
 
 // Open a new in-memory database.
 func Open() data.Database {
-	return &database{}
+	return &database{feeds: map[string]*feedDatabase{}}
 }
 
 func (*database) Confluence() (confluence.Database, error) {
 	return newConfluenceDatabase()
 }
 
-func (*database) Feed(name string) (feed.Database, error) {
-	return newFeedDatabase()
+func (*database) Search() (search.Database, error) {
+	return newSearchDatabase()
+}
+
+func (*database) ReadState() (readstate.Database, error) {
+	return newReadDatabase()
+}
+
+func (db *database) Feed(name string) (feed.Database, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.feeds[name]; !ok {
+		db.feeds[name] = newFeedDatabase()
+	}
+
+	return db.feeds[name], nil
+}
+
+func (db *database) MoveFeed(from, to string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	old, ok := db.feeds[from]
+	if !ok {
+		return nil
+	}
+	delete(db.feeds, from)
+
+	if _, ok := db.feeds[to]; !ok {
+		db.feeds[to] = old
+		return nil
+	}
+
+	db.feeds[to].merge(old)
+	return nil
 }
 
 func (db *database) Close() error {
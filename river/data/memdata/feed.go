@@ -8,12 +8,13 @@ import (
 
 type feedDatabase struct {
 	known map[string]struct{}
+	state feed.State
 	sync.RWMutex
 }
 
-// NewDatabase returns an empty in-memory database for item keys.
-func newFeedDatabase() (feed.Database, error) {
-	return &feedDatabase{known: map[string]struct{}{}}, nil
+// newFeedDatabase returns an empty in-memory database for item keys.
+func newFeedDatabase() *feedDatabase {
+	return &feedDatabase{known: map[string]struct{}{}}
 }
 
 // Contains checks the database for the Key of a feed item and returns true if
@@ -33,3 +34,31 @@ func (d *feedDatabase) Contains(key string) bool {
 	d.known[key] = struct{}{}
 	return false
 }
+
+func (d *feedDatabase) State() feed.State {
+	d.RLock()
+	defer d.RUnlock()
+
+	return d.state
+}
+
+func (d *feedDatabase) SetState(state feed.State) {
+	d.Lock()
+	d.state = state
+	d.Unlock()
+}
+
+// merge adds the keys known by other, and its state if none has been set.
+func (d *feedDatabase) merge(other *feedDatabase) {
+	other.RLock()
+	defer other.RUnlock()
+	d.Lock()
+	defer d.Unlock()
+
+	for key := range other.known {
+		d.known[key] = struct{}{}
+	}
+	if d.state == (feed.State{}) {
+		d.state = other.state
+	}
+}
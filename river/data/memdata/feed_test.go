@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"hawx.me/code/riviera/feed"
 )
 
 func TestBucket(t *testing.T) {
@@ -23,3 +24,31 @@ func TestBucket(t *testing.T) {
 	assert.False(bucket2.Contains(key))
 	assert.True(bucket2.Contains(key))
 }
+
+func TestMoveFeed(t *testing.T) {
+	assert := assert.New(t)
+	db := Open()
+
+	old, _ := db.Feed("http://old")
+	old.Contains("1")
+	old.SetState(feed.State{ETag: "abc"})
+
+	existing, _ := db.Feed("http://existing")
+	existing.Contains("2")
+
+	assert.Nil(db.MoveFeed("http://old", "http://new"))
+	assert.Nil(db.MoveFeed("http://missing", "http://new"))
+
+	moved, _ := db.Feed("http://new")
+	assert.True(moved.Contains("1"))
+	assert.Equal(feed.State{ETag: "abc"}, moved.State())
+
+	reopened, _ := db.Feed("http://old")
+	assert.False(reopened.Contains("1"))
+
+	// moving into a known feed merges
+	assert.Nil(db.MoveFeed("http://new", "http://existing"))
+	assert.True(existing.Contains("1"))
+	assert.True(existing.Contains("2"))
+	assert.Equal(feed.State{ETag: "abc"}, existing.State())
+}
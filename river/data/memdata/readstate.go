@@ -0,0 +1,65 @@
+package memdata
+
+import (
+	"sync"
+	"time"
+
+	"hawx.me/code/riviera/river/readstate"
+)
+
+type readDatabase struct {
+	mu   sync.RWMutex
+	read map[string]time.Time
+	mark time.Time
+}
+
+func newReadDatabase() (readstate.Database, error) {
+	return &readDatabase{read: map[string]time.Time{}}, nil
+}
+
+func (d *readDatabase) MarkRead(keys ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	for _, key := range keys {
+		d.read[key] = now
+	}
+}
+
+func (d *readDatabase) Read(key string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	_, ok := d.read[key]
+	return ok
+}
+
+func (d *readDatabase) Mark() time.Time {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.mark
+}
+
+func (d *readDatabase) SetMark(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if t.After(d.mark) {
+		d.mark = t
+	}
+}
+
+func (d *readDatabase) Truncate(cutoff time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	max := time.Now().Add(cutoff)
+
+	for key, at := range d.read {
+		if at.Before(max) {
+			delete(d.read, key)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package memdata
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadState(t *testing.T) {
+	assert := assert.New(t)
+
+	db, err := Open().ReadState()
+	assert.Nil(err)
+
+	assert.False(db.Read("http://cool 1"))
+	db.MarkRead("http://cool 1", "http://cool 2")
+	assert.True(db.Read("http://cool 1"))
+	assert.True(db.Read("http://cool 2"))
+	assert.False(db.Read("http://cool 3"))
+
+	now := time.Now().Round(time.Second)
+	assert.True(db.Mark().IsZero())
+	db.SetMark(now)
+	assert.Equal(now, db.Mark())
+	db.SetMark(now.Add(-time.Hour))
+	assert.Equal(now, db.Mark())
+
+	db.Truncate(time.Minute)
+	assert.False(db.Read("http://cool 1"))
+}
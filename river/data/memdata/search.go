@@ -0,0 +1,61 @@
+package memdata
+
+import (
+	"sync"
+
+	"hawx.me/code/riviera/river/riverjs"
+	"hawx.me/code/riviera/river/search"
+)
+
+type searchDatabase struct {
+	mu       sync.RWMutex
+	docs     map[string]search.Document
+	postings map[string]map[string][]int
+}
+
+func newSearchDatabase() (search.Database, error) {
+	return &searchDatabase{
+		docs:     map[string]search.Document{},
+		postings: map[string]map[string][]int{},
+	}, nil
+}
+
+func (d *searchDatabase) Add(feed riverjs.Feed) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	docs, terms := search.Documents(feed)
+	for i, doc := range docs {
+		if _, exists := d.docs[doc.ID]; exists {
+			continue
+		}
+		d.docs[doc.ID] = doc
+
+		for term, positions := range terms[i] {
+			if _, ok := d.postings[term]; !ok {
+				d.postings[term] = map[string][]int{}
+			}
+			d.postings[term][doc.ID] = positions
+		}
+	}
+}
+
+func (d *searchDatabase) Search(query search.Query) []search.Result {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return search.Run(d, query)
+}
+
+func (d *searchDatabase) Postings(term string) map[string][]int {
+	return d.postings[term]
+}
+
+func (d *searchDatabase) Document(id string) (search.Document, bool) {
+	doc, ok := d.docs[id]
+	return doc, ok
+}
+
+func (d *searchDatabase) Count() int {
+	return len(d.docs)
+}
@@ -0,0 +1,53 @@
+package memdata
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"hawx.me/code/riviera/river/riverjs"
+	"hawx.me/code/riviera/river/search"
+)
+
+func TestSearch(t *testing.T) {
+	assert := assert.New(t)
+
+	db, err := Open().Search()
+	assert.Nil(err)
+
+	day := time.Date(2020, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	db.Add(riverjs.Feed{FeedURL: "http://cool", FeedTitle: "Cool", Items: []riverjs.Item{
+		{ID: "1", Title: "Go is fast", Body: "A post about the go programming language", PubDate: riverjs.Time(day)},
+		{ID: "2", Title: "Rust", Body: "Fast and safe, like go", PubDate: riverjs.Time(day.Add(-48 * time.Hour))},
+	}})
+	db.Add(riverjs.Feed{FeedURL: "http://what", FeedTitle: "What", Items: []riverjs.Item{
+		{ID: "3", Title: "Programming", Body: "The language is fast to learn", PubDate: riverjs.Time(day.Add(-24 * time.Hour))},
+	}})
+
+	ids := func(results []search.Result) []string {
+		l := []string{}
+		for _, result := range results {
+			l = append(l, result.Item.ID)
+		}
+		return l
+	}
+
+	// title matches rank higher
+	assert.Equal([]string{"1", "2"}, ids(db.Search(search.ParseQuery("go fast"))))
+
+	// phrases must appear in order
+	assert.Equal([]string{"1"}, ids(db.Search(search.ParseQuery(`"programming language"`))))
+	assert.Equal([]string{}, ids(db.Search(search.ParseQuery(`"language programming"`))))
+
+	// filters
+	assert.Equal([]string{"3"}, ids(db.Search(search.Query{Terms: []string{"fast"}, Feed: "what"})))
+	assert.Equal([]string{"1", "3"}, ids(db.Search(search.Query{Terms: []string{"fast"}, Since: day.Add(-36 * time.Hour)})))
+	assert.Equal([]string{"2"}, ids(db.Search(search.Query{Terms: []string{"fast"}, Until: day.Add(-36 * time.Hour)})))
+
+	// adding again does not duplicate
+	db.Add(riverjs.Feed{FeedURL: "http://what", FeedTitle: "What", Items: []riverjs.Item{
+		{ID: "3", Title: "Programming", Body: "The language is fast to learn", PubDate: riverjs.Time(day.Add(-24 * time.Hour))},
+	}})
+	assert.Len(db.Search(search.ParseQuery("learn")), 1)
+}
@@ -0,0 +1,267 @@
+// Package dedup merges items that are the same story posted in more than one
+// feed, so that it is shown once in the river.
+//
+// Items are the same story when their links are the same, once normalised by
+// CanonicalLink, or when they are from different feeds and their titles are
+// near-duplicates: they share most of their words, ignoring case and
+// punctuation. Titles are not compared within a feed, as the items of a series
+// are often titled alike.
+package dedup
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"unicode"
+
+	"hawx.me/code/riviera/river/mapping"
+	"hawx.me/code/riviera/river/riverjs"
+)
+
+// minWords is the number of words a title must have to be compared, shorter
+// titles such as "Links" or "Weekly update" are too common to match on.
+const minWords = 4
+
+// similarity is the proportion of their words two titles must share to be
+// near-duplicates.
+const similarity = 0.8
+
+// redirectParams are query parameters that redirecting links use to hold the
+// address they redirect to.
+var redirectParams = []string{"url", "u", "q", "target", "dest", "destination", "redirect", "to", "link"}
+
+// Dedup returns feeds with the items that repeat a story already seen removed,
+// the item kept instead lists the feed of each removed item in AlsoIn. Only
+// items from feeds that enabled returns true for, given the URI they are
+// subscribed at, are merged.
+//
+// The feeds are expected newest first, as returned by confluence.Database, so
+// the earliest posting of a story is kept. Feeds left without items are
+// removed. The feeds given are not changed.
+func Dedup(feeds []riverjs.Feed, enabled func(uri string) bool) []riverjs.Feed {
+	var (
+		result = make([]riverjs.Feed, len(feeds))
+		keep   = make([][]bool, len(feeds))
+
+		checked = map[string]bool{}
+		links   = map[string]position{}
+		words   = map[position][]string{}
+
+		// index is used to find titles that share a word, so that every title
+		// does not need to be compared
+		index = map[string][]position{}
+	)
+
+	for i := len(feeds) - 1; i >= 0; i-- {
+		result[i] = feeds[i]
+		result[i].Items = append([]riverjs.Item{}, feeds[i].Items...)
+		keep[i] = make([]bool, len(feeds[i].Items))
+		for j := range keep[i] {
+			keep[i][j] = true
+		}
+
+		uri := feeds[i].SubscriptionURI()
+		on, ok := checked[uri]
+		if !ok {
+			on = enabled(uri)
+			checked[uri] = on
+		}
+		if !on {
+			continue
+		}
+
+		for j := len(feeds[i].Items) - 1; j >= 0; j-- {
+			item := feeds[i].Items[j]
+			current := position{i, j}
+
+			var keys []string
+			for _, link := range []string{item.Link, item.PermaLink} {
+				if key := CanonicalLink(link); key != "" {
+					keys = append(keys, key)
+				}
+			}
+			titleWords := Words(item.Title)
+
+			original, found := current, false
+			for _, key := range keys {
+				if original, found = links[key]; found {
+					break
+				}
+			}
+			if !found && len(titleWords) >= minWords {
+				original, found = nearDuplicate(titleWords, index, words, func(p position) bool {
+					return feeds[p.feed].SubscriptionURI() != uri
+				})
+			}
+
+			if found {
+				link := item.Link
+				if link == "" {
+					link = item.PermaLink
+				}
+				addSource(&result[original.feed].Items[original.item], feeds[original.feed].FeedURL, riverjs.Source{
+					FeedURL:    feeds[i].FeedURL,
+					WebsiteURL: feeds[i].WebsiteURL,
+					FeedTitle:  feeds[i].FeedTitle,
+					Link:       link,
+				})
+				keep[i][j] = false
+			} else {
+				original = current
+				if len(titleWords) >= minWords {
+					words[current] = titleWords
+					for _, word := range titleWords {
+						index[word] = append(index[word], current)
+					}
+				}
+			}
+
+			// the links of duplicates are remembered too, so that later items
+			// linking to any of them are found
+			for _, key := range keys {
+				if _, ok := links[key]; !ok {
+					links[key] = original
+				}
+			}
+		}
+	}
+
+	deduped := []riverjs.Feed{}
+	for i, feed := range result {
+		items := []riverjs.Item{}
+		for j, item := range feed.Items {
+			if keep[i][j] {
+				items = append(items, item)
+			}
+		}
+
+		if len(items) > 0 {
+			feed.Items = items
+			deduped = append(deduped, feed)
+		}
+	}
+
+	return deduped
+}
+
+// addSource lists source in the AlsoIn of item, which is from the feed at
+// feedURL, unless the feed is already listed.
+func addSource(item *riverjs.Item, feedURL string, source riverjs.Source) {
+	if source.FeedURL == feedURL {
+		return
+	}
+	for _, other := range item.AlsoIn {
+		if other.FeedURL == source.FeedURL {
+			return
+		}
+	}
+
+	item.AlsoIn = append(item.AlsoIn, source)
+}
+
+// position is the index of an item, and of the feed it is in.
+type position struct{ feed, item int }
+
+// nearDuplicate finds the first title seen, at a position that other returns
+// true for, that is a near-duplicate of the title with words.
+func nearDuplicate(words []string, index map[string][]position, seen map[position][]string, other func(position) bool) (position, bool) {
+	shared := map[position]int{}
+	for _, word := range words {
+		for _, p := range index[word] {
+			shared[p]++
+		}
+	}
+
+	var candidates []position
+	for p, n := range shared {
+		if !other(p) {
+			continue
+		}
+		if 2*float64(n)/float64(len(words)+len(seen[p])) >= similarity {
+			candidates = append(candidates, p)
+		}
+	}
+	if len(candidates) == 0 {
+		return position{}, false
+	}
+
+	// prefer the earliest, which is in the last feed
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].feed != candidates[j].feed {
+			return candidates[i].feed > candidates[j].feed
+		}
+		return candidates[i].item > candidates[j].item
+	})
+
+	return candidates[0], true
+}
+
+// Words returns the distinct words of title, lowercased and without
+// punctuation, in the order they first appear.
+func Words(title string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	var words []string
+	seen := map[string]bool{}
+	for _, field := range fields {
+		if !seen[field] {
+			seen[field] = true
+			words = append(words, field)
+		}
+	}
+
+	return words
+}
+
+// CanonicalLink returns link normalised so that links to the same page are
+// equal: the scheme, "www." prefix, default port, fragment, trailing slash and
+// mapping.DefaultTrackingParams are removed, and the remaining query
+// parameters are sorted. Links that redirect to another address given in a
+// query parameter, as aggregators often use, are replaced by that address. It
+// returns an empty string if link is not an http or https URL.
+func CanonicalLink(link string) string {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+
+	query := u.Query()
+	for _, param := range redirectParams {
+		if target := query.Get(param); target != "" && target != link {
+			if canonical := CanonicalLink(target); canonical != "" {
+				return canonical
+			}
+		}
+	}
+
+	for key := range query {
+		if isTracking(key) {
+			query.Del(key)
+		}
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		host += ":" + port
+	}
+
+	canonical := host + strings.TrimSuffix(u.EscapedPath(), "/")
+	if len(query) > 0 {
+		// Encode sorts by key
+		canonical += "?" + query.Encode()
+	}
+
+	return canonical
+}
+
+func isTracking(key string) bool {
+	for _, name := range mapping.DefaultTrackingParams {
+		if key == name || (strings.HasSuffix(name, "*") && strings.HasPrefix(key, strings.TrimSuffix(name, "*"))) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,132 @@
+package dedup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"hawx.me/code/riviera/river/riverjs"
+)
+
+func TestCanonicalLink(t *testing.T) {
+	testcases := []struct {
+		link, expected string
+	}{
+		{"http://example.com/post", "example.com/post"},
+		{"https://www.Example.com/post/", "example.com/post"},
+		{"http://example.com:80/post#comments", "example.com/post"},
+		{"http://example.com:8080/post", "example.com:8080/post"},
+		{"http://example.com/post?utm_source=rss&utm_medium=feed&fbclid=1", "example.com/post"},
+		{"http://example.com/post?b=2&a=1&gclid=x", "example.com/post?a=1&b=2"},
+		{"https://aggregator.com/r?url=https%3A%2F%2Fexample.com%2Fpost%3Futm_source%3Dagg", "example.com/post"},
+		{"https://www.google.com/search?q=example", "google.com/search?q=example"},
+		{"mailto:me@example.com", ""},
+		{"/relative", ""},
+		{"", ""},
+	}
+
+	for _, tc := range testcases {
+		assert.Equal(t, tc.expected, CanonicalLink(tc.link), tc.link)
+	}
+}
+
+func TestWords(t *testing.T) {
+	assert.Equal(t, []string{"go", "1", "22", "is", "released"}, Words("Go 1.22 is released! Go"))
+	assert.Nil(t, Words(" -- "))
+}
+
+func TestDedup(t *testing.T) {
+	assert := assert.New(t)
+
+	// newest first
+	feeds := []riverjs.Feed{
+		{FeedURL: "http://aggregator", FeedTitle: "Aggregator", Items: []riverjs.Item{
+			{Title: "Something else entirely happened today", Link: "http://other.com/news"},
+			{Title: "Go 1.22 is released", Link: "https://aggregator.com/r?url=http%3A%2F%2Fgo.dev%2Fblog%2Fgo1.22"},
+		}},
+		{FeedURL: "http://news", FeedTitle: "News", WebsiteURL: "http://news.com", Items: []riverjs.Item{
+			{Title: "Go 1.22 is released - News", Link: "http://news.com/go-1-22"},
+		}},
+		{FeedURL: "http://go", FeedTitle: "Go", Items: []riverjs.Item{
+			{Title: "Go 1.22 is released", Link: "https://go.dev/blog/go1.22?utm_source=rss"},
+			{Title: "Links", Link: "https://go.dev/blog/links"},
+		}},
+	}
+
+	deduped := Dedup(feeds, func(string) bool { return true })
+
+	if assert.Len(deduped, 2) {
+		assert.Equal("http://aggregator", deduped[0].FeedURL)
+		if assert.Len(deduped[0].Items, 1) {
+			assert.Equal("http://other.com/news", deduped[0].Items[0].Link)
+		}
+
+		assert.Equal("http://go", deduped[1].FeedURL)
+		if assert.Len(deduped[1].Items, 2) {
+			assert.Equal([]riverjs.Source{
+				{FeedURL: "http://news", FeedTitle: "News", WebsiteURL: "http://news.com", Link: "http://news.com/go-1-22"},
+				{FeedURL: "http://aggregator", FeedTitle: "Aggregator", Link: "https://aggregator.com/r?url=http%3A%2F%2Fgo.dev%2Fblog%2Fgo1.22"},
+			}, deduped[1].Items[0].AlsoIn)
+			assert.Nil(deduped[1].Items[1].AlsoIn)
+		}
+	}
+
+	// the feeds given are not changed
+	assert.Len(feeds[0].Items, 2)
+	assert.Nil(feeds[2].Items[0].AlsoIn)
+}
+
+func TestDedupWhenDisabled(t *testing.T) {
+	feeds := []riverjs.Feed{
+		{FeedURL: "http://a", Items: []riverjs.Item{{Title: "Short", Link: "http://example.com/post"}}},
+		{FeedURL: "http://b", Items: []riverjs.Item{{Title: "Short", Link: "http://example.com/post"}}},
+		{FeedURL: "http://c", Items: []riverjs.Item{{Title: "Short", Link: "http://example.com/post"}}},
+	}
+
+	deduped := Dedup(feeds, func(feedURL string) bool { return feedURL != "http://a" })
+
+	if assert.Len(t, deduped, 2) {
+		assert.Equal(t, "http://a", deduped[0].FeedURL)
+		assert.Equal(t, "http://c", deduped[1].FeedURL)
+		assert.Equal(t, []riverjs.Source{{FeedURL: "http://b", Link: "http://example.com/post"}}, deduped[1].Items[0].AlsoIn)
+	}
+}
+
+func TestDedupSameFeed(t *testing.T) {
+	feeds := []riverjs.Feed{
+		{FeedURL: "http://a", Items: []riverjs.Item{{Title: "Updated", Link: "http://example.com/post"}}},
+		{FeedURL: "http://a", Items: []riverjs.Item{{Title: "Original", Link: "http://example.com/post"}}},
+	}
+
+	deduped := Dedup(feeds, func(string) bool { return true })
+
+	if assert.Len(t, deduped, 1) {
+		assert.Equal(t, "Original", deduped[0].Items[0].Title)
+		assert.Nil(t, deduped[0].Items[0].AlsoIn)
+	}
+}
+
+func TestDedupSeriesInFeed(t *testing.T) {
+	assert := assert.New(t)
+
+	feeds := []riverjs.Feed{
+		{FeedURL: "http://podcast", Items: []riverjs.Item{
+			{Title: "Episode 103: Talk about Go tools", Link: "http://podcast.com/103"},
+		}},
+		{FeedURL: "http://podcast", Items: []riverjs.Item{
+			{Title: "Episode 102: Talk about Go tools", Link: "http://podcast.com/102"},
+			{Title: "Episode 101: Talk about Go tools", Link: "http://podcast.com/101"},
+		}},
+	}
+
+	deduped := Dedup(feeds, func(string) bool { return true })
+
+	if assert.Len(deduped, 2) {
+		if assert.Len(deduped[0].Items, 1) {
+			assert.Equal("http://podcast.com/103", deduped[0].Items[0].Link)
+		}
+		if assert.Len(deduped[1].Items, 2) {
+			assert.Equal("http://podcast.com/102", deduped[1].Items[0].Link)
+			assert.Equal("http://podcast.com/101", deduped[1].Items[1].Link)
+		}
+	}
+}
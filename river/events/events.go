@@ -1,13 +1,102 @@
 // Package events keeps track of the results of fetching feeds.
 package events
 
-import "time"
+import (
+	"net/http"
+	"time"
+)
 
 // An Event keeps track of the results of fetching a feed.
 type Event struct {
 	At   time.Time `json:"at"`
 	URI  string    `json:"uri"`
 	Code int       `json:"code"`
+
+	// Error is the reason the feed could not be fetched or read, if any.
+	Error string `json:"error,omitempty"`
+
+	// Duration is the time taken to fetch and read the feed.
+	Duration time.Duration `json:"duration"`
+
+	// Bytes is the size of the response body read.
+	Bytes int64 `json:"bytes"`
+
+	// Format is the format the feed was read in, for example "rss".
+	Format string `json:"format,omitempty"`
+
+	// NewItems is the number of items found that had not been seen before.
+	NewItems int `json:"newItems"`
+
+	// RedirectTo is the location the request was redirected to, if it was.
+	RedirectTo string `json:"redirectTo,omitempty"`
+
+	// Page is the page fetched to extract the article of an item in the feed,
+	// if the event is for that rather than the feed itself.
+	Page string `json:"page,omitempty"`
+
+	// MovedTo is the location the feed has moved to, set once it has been
+	// permanently redirected there enough times in a row.
+	MovedTo string `json:"movedTo,omitempty"`
+
+	// CacheControl, Expires and RetryAfter are the caching headers of the last
+	// response, as they can delay when the feed is next fetched.
+	CacheControl string `json:"cacheControl,omitempty"`
+	Expires      string `json:"expires,omitempty"`
+	RetryAfter   string `json:"retryAfter,omitempty"`
+
+	// Next is the earliest time the feed will be fetched again.
+	Next time.Time `json:"next"`
+}
+
+// Status returns a class for the result of the Event: "ok" when the feed was
+// fetched, or had not been modified; "redirect"; "error" when the request was
+// refused; "fault" when the server failed or the feed could not be read; or
+// "unknown" when no request was made.
+func (e Event) Status() string {
+	switch {
+	case e.Error != "" || e.Code >= 500:
+		return "fault"
+	case e.Code >= 400:
+		return "error"
+	case e.Code == http.StatusNotModified || (e.Code >= 200 && e.Code < 300):
+		return "ok"
+	case e.Code >= 300:
+		return "redirect"
+	default:
+		return "unknown"
+	}
+}
+
+// A Filter selects Events, fields that are not set match every Event.
+type Filter struct {
+	// URI is the feed the Event is for.
+	URI string
+
+	// Status is the class of the Event's result, as returned by Status.
+	Status string
+
+	// Since and Until limit the time the Event happened, Until is exclusive.
+	Since, Until time.Time
+}
+
+// Match returns true if the Event is selected by the Filter.
+func (f Filter) Match(e Event) bool {
+	return (f.URI == "" || e.URI == f.URI) &&
+		(f.Status == "" || e.Status() == f.Status) &&
+		(f.Since.IsZero() || !e.At.Before(f.Since)) &&
+		(f.Until.IsZero() || e.At.Before(f.Until))
+}
+
+// Apply returns the Events selected by the Filter, keeping their order.
+func (f Filter) Apply(evs []Event) []Event {
+	matched := []Event{}
+	for _, e := range evs {
+		if f.Match(e) {
+			matched = append(matched, e)
+		}
+	}
+
+	return matched
 }
 
 // Events is a list of Event objects.
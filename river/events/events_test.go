@@ -2,6 +2,7 @@ package events
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -31,3 +32,38 @@ func TestEvents(t *testing.T) {
 	evs.Prepend(ev[3])
 	assert.Equal(t, []Event{ev[3], ev[2], ev[1]}, evs.List())
 }
+
+func TestEventStatus(t *testing.T) {
+	tests := map[string]Event{
+		"ok":       {Code: 200},
+		"redirect": {Code: 302},
+		"error":    {Code: 404},
+		"fault":    {Code: 503},
+		"unknown":  {Code: -1},
+	}
+
+	for expected, ev := range tests {
+		assert.Equal(t, expected, ev.Status())
+	}
+
+	assert.Equal(t, "ok", Event{Code: 304}.Status())
+	assert.Equal(t, "fault", Event{Code: -1, Error: "timeout"}.Status())
+	assert.Equal(t, "fault", Event{Code: 200, Error: "Unsupported feed"}.Status())
+}
+
+func TestFilter(t *testing.T) {
+	now := time.Date(2020, 1, 2, 12, 0, 0, 0, time.UTC)
+
+	evs := []Event{
+		{URI: "a", Code: 200, At: now},
+		{URI: "b", Code: 500, At: now.Add(-time.Hour)},
+		{URI: "a", Code: 404, At: now.Add(-24 * time.Hour)},
+	}
+
+	assert.Equal(t, evs, Filter{}.Apply(evs))
+	assert.Equal(t, []Event{evs[0], evs[2]}, Filter{URI: "a"}.Apply(evs))
+	assert.Equal(t, []Event{evs[1]}, Filter{Status: "fault"}.Apply(evs))
+	assert.Equal(t, []Event{evs[0], evs[1]}, Filter{Since: now.Add(-time.Hour)}.Apply(evs))
+	assert.Equal(t, []Event{evs[2]}, Filter{Until: now.Add(-time.Hour)}.Apply(evs))
+	assert.Equal(t, []Event{}, Filter{URI: "b", Status: "ok"}.Apply(evs))
+}
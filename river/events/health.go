@@ -0,0 +1,86 @@
+package events
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Health summarises the Events for a single feed.
+type Health struct {
+	URI string `json:"uri"`
+
+	// LastSuccess and LastFailure are the times of the latest Events with a
+	// Status of "ok", and of "error" or "fault". LastError describes the failure.
+	LastSuccess time.Time `json:"lastSuccess"`
+	LastFailure time.Time `json:"lastFailure"`
+	LastError   string    `json:"lastError,omitempty"`
+
+	// Failures is the number of failures since the last success, and
+	// FailingSince the time of the first of them.
+	Failures     int       `json:"failures"`
+	FailingSince time.Time `json:"failingSince"`
+
+	// ItemsPerDay is the average number of new items found each day, not
+	// counting those found by the first successful fetch.
+	ItemsPerDay float64 `json:"itemsPerDay"`
+
+	// Interval is the time between the latest Event and the next fetch.
+	Interval time.Duration `json:"interval"`
+
+	// LastRedirect is the location the feed was last redirected to.
+	LastRedirect string `json:"lastRedirect,omitempty"`
+
+	// Paused is true when the feed is not being fetched.
+	Paused bool `json:"paused"`
+
+	// Dead is true when the feed has gone, or failed for so long it is no
+	// longer being fetched.
+	Dead bool `json:"dead"`
+
+	since time.Time
+	items int
+}
+
+// Add updates the Health with an Event for the feed.
+func (h *Health) Add(ev Event) {
+	switch ev.Status() {
+	case "ok":
+		h.LastSuccess = ev.At
+		h.Failures = 0
+		h.FailingSince = time.Time{}
+
+		if h.since.IsZero() {
+			h.since = ev.At
+		} else {
+			h.items += ev.NewItems
+		}
+
+	case "error", "fault":
+		h.LastFailure = ev.At
+		if h.Failures == 0 {
+			h.FailingSince = ev.At
+		}
+		h.Failures++
+
+		h.LastError = ev.Error
+		if h.LastError == "" {
+			h.LastError = strconv.Itoa(ev.Code) + " " + http.StatusText(ev.Code)
+		}
+	}
+
+	if ev.RedirectTo != "" {
+		h.LastRedirect = ev.RedirectTo
+	}
+	if !ev.Next.IsZero() {
+		h.Interval = ev.Next.Sub(ev.At)
+	}
+
+	if !h.since.IsZero() {
+		days := ev.At.Sub(h.since).Hours() / 24
+		if days < 1 {
+			days = 1
+		}
+		h.ItemsPerDay = float64(h.items) / days
+	}
+}
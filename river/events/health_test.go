@@ -0,0 +1,46 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealth(t *testing.T) {
+	assert := assert.New(t)
+
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	h := Health{URI: "http://a"}
+
+	h.Add(Event{Code: -1, Error: "timeout", At: start})
+	assert.Equal(start, h.LastFailure)
+	assert.Equal("timeout", h.LastError)
+	assert.Equal(1, h.Failures)
+
+	h.Add(Event{Code: 404, At: start.Add(time.Hour)})
+	assert.Equal("404 Not Found", h.LastError)
+	assert.Equal(2, h.Failures)
+	assert.Equal(start, h.FailingSince)
+
+	// the first items found are not counted
+	h.Add(Event{Code: 200, NewItems: 20, At: start.Add(2 * time.Hour), Next: start.Add(3 * time.Hour)})
+	assert.Equal(start.Add(2*time.Hour), h.LastSuccess)
+	assert.Equal(0, h.Failures)
+	assert.True(h.FailingSince.IsZero())
+	assert.Equal(time.Hour, h.Interval)
+	assert.Equal(float64(0), h.ItemsPerDay)
+
+	h.Add(Event{Code: 304, At: start.Add(3 * time.Hour), RedirectTo: "http://b"})
+	h.Add(Event{Code: 200, NewItems: 3, At: start.Add(4 * time.Hour)})
+	assert.Equal(float64(3), h.ItemsPerDay)
+	assert.Equal("http://b", h.LastRedirect)
+
+	h.Add(Event{Code: 200, NewItems: 3, At: start.Add(74 * time.Hour)})
+	assert.Equal(float64(2), h.ItemsPerDay)
+
+	// skipped fetches change nothing
+	h.Add(Event{Code: -1, At: start.Add(75 * time.Hour)})
+	assert.Equal(0, h.Failures)
+	assert.Equal(start.Add(74*time.Hour), h.LastSuccess)
+}
@@ -0,0 +1,313 @@
+// Package extract fetches the pages that items link to, and extracts their
+// article so that feeds which only publish a teaser can be read in full.
+package extract
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html/charset"
+	"hawx.me/code/riviera/river/events"
+	"hawx.me/code/riviera/river/riverjs"
+)
+
+// maxSize limits how much of a page is read.
+const maxSize = 5 << 20
+
+// Options change the behaviour of an Extractor.
+type Options struct {
+	// Enabled returns true if the items of the feed at uri should have their
+	// articles extracted. If nil no feeds are.
+	Enabled func(uri string) bool
+
+	// Interval is the time to wait between requests to the same host.
+	Interval time.Duration
+
+	// Concurrency is the number of pages fetched at once.
+	Concurrency int
+
+	// CacheSize is the number of pages to remember the result of, so that they
+	// are not fetched again.
+	CacheSize int
+}
+
+// DefaultOptions are used for any Options not given.
+var DefaultOptions = Options{
+	Interval:    2 * time.Second,
+	Concurrency: 2,
+	CacheSize:   1000,
+}
+
+// An Extractor fetches the pages linked to by items, limiting how often each
+// host is requested and remembering the articles found.
+type Extractor struct {
+	client   *http.Client
+	enabled  func(uri string) bool
+	interval time.Duration
+	slots    chan struct{}
+
+	mu    sync.Mutex
+	next  map[string]time.Time
+	cache *cache
+}
+
+// New returns an Extractor that fetches pages with client.
+func New(client *http.Client, options Options) *Extractor {
+	if options.Interval == 0 {
+		options.Interval = DefaultOptions.Interval
+	}
+	if options.Concurrency <= 0 {
+		options.Concurrency = DefaultOptions.Concurrency
+	}
+	if options.CacheSize <= 0 {
+		options.CacheSize = DefaultOptions.CacheSize
+	}
+
+	return &Extractor{
+		client:   client,
+		enabled:  options.Enabled,
+		interval: options.Interval,
+		slots:    make(chan struct{}, options.Concurrency),
+		next:     map[string]time.Time{},
+		cache:    newCache(options.CacheSize),
+	}
+}
+
+// Enabled returns true if articles should be extracted for the feed at uri.
+func (e *Extractor) Enabled(uri string) bool {
+	return e.enabled != nil && e.enabled(uri)
+}
+
+// Extract sets the Content of each item in the feed to the article found on the
+// page it links to. Items where no article can be found are left as they are.
+// An Event, for the feed named uri, is sent to evs for each page fetched. Once
+// stop is closed no more pages are fetched, and no more Events sent.
+func (e *Extractor) Extract(uri string, feed *riverjs.Feed, evs chan<- events.Event, stop <-chan struct{}) {
+	for i, item := range feed.Items {
+		link := item.Link
+		if link == "" {
+			link = item.PermaLink
+		}
+		if link == "" {
+			continue
+		}
+
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		article, event, fetched := e.article(link, stop)
+		if article != "" {
+			feed.Items[i].Content = article
+		}
+
+		if fetched {
+			event.URI = uri
+			select {
+			case evs <- event:
+			case <-stop:
+				return
+			}
+		}
+	}
+}
+
+// article returns the article at link, either from the cache or by fetching
+// the page, in which case the Event for the request is returned. If stop is
+// closed while waiting to fetch the page nothing is returned.
+func (e *Extractor) article(link string, stop <-chan struct{}) (article string, event events.Event, fetched bool) {
+	if article, ok := e.cache.get(link); ok {
+		return article, event, false
+	}
+
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", event, false
+	}
+
+	// the slot is only taken once the host can be requested, so that waiting on
+	// one host does not hold up others
+	if !e.wait(u.Host, stop) {
+		return "", event, false
+	}
+	select {
+	case e.slots <- struct{}{}:
+	case <-stop:
+		return "", event, false
+	}
+
+	start := time.Now()
+	article, code, bytes, err := e.fetch(u)
+	<-e.slots
+
+	event = events.Event{
+		At:       time.Now().UTC(),
+		Page:     link,
+		Code:     code,
+		Duration: time.Since(start),
+		Bytes:    bytes,
+	}
+	if err != nil {
+		log.Printf("could not extract article from %s: %s\n", link, err)
+		event.Error = err.Error()
+	}
+
+	// failures that will happen again are cached too, so that broken pages are
+	// not requested again
+	if err == nil || definite(code, err) {
+		e.cache.add(link, article)
+	}
+	return article, event, true
+}
+
+// definite returns true if the failure to extract an article, err, from a page
+// that responded with code would happen again if the page were requested
+// again. Other failures, such as timeouts and server errors, may pass.
+func definite(code int, err error) bool {
+	if err == ErrNoArticle {
+		return true
+	}
+	if _, ok := err.(notPageError); ok {
+		return true
+	}
+
+	return code >= 400 && code < 500 &&
+		code != http.StatusRequestTimeout && code != http.StatusTooManyRequests
+}
+
+// notPageError is returned when the response is not an HTML page.
+type notPageError string
+
+func (e notPageError) Error() string {
+	return "not a page: " + string(e)
+}
+
+// wait blocks until host can next be requested, it returns false if stop is
+// closed first.
+func (e *Extractor) wait(host string, stop <-chan struct{}) bool {
+	e.mu.Lock()
+	now := time.Now()
+	at := e.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	e.next[host] = at.Add(e.interval)
+	e.mu.Unlock()
+
+	timer := time.NewTimer(at.Sub(now))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+func (e *Extractor) fetch(u *url.URL) (article string, code int, n int64, err error) {
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	req.Header.Set("User-Agent", "riviera golang")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	defer resp.Body.Close()
+
+	counter := &countingReader{r: io.LimitReader(resp.Body, maxSize)}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", resp.StatusCode, 0, fmt.Errorf("responded with %d", resp.StatusCode)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType != "" && mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return "", resp.StatusCode, 0, notPageError(mediaType)
+	}
+
+	body, err := charset.NewReader(counter, contentType)
+	if err != nil {
+		return "", resp.StatusCode, counter.n, err
+	}
+
+	article, err = Readability(body, resp.Request.URL)
+	return article, resp.StatusCode, counter.n, err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// cache keeps the most recently used articles, up to a size.
+type cache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	items map[string]*list.Element
+}
+
+type cacheEntry struct {
+	link    string
+	article string
+}
+
+func newCache(size int) *cache {
+	return &cache{
+		size:  size,
+		order: list.New(),
+		items: map[string]*list.Element{},
+	}
+}
+
+func (c *cache) get(link string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[link]
+	if !ok {
+		return "", false
+	}
+
+	c.order.MoveToFront(el)
+	return el.Value.(*cacheEntry).article, true
+}
+
+func (c *cache) add(link, article string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[link]; ok {
+		el.Value.(*cacheEntry).article = article
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.items[link] = c.order.PushFront(&cacheEntry{link: link, article: article})
+
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).link)
+	}
+}
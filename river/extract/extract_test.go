@@ -0,0 +1,249 @@
+package extract
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"hawx.me/code/riviera/river/events"
+	"hawx.me/code/riviera/river/riverjs"
+)
+
+func TestExtractor(t *testing.T) {
+	assert := assert.New(t)
+
+	var mu sync.Mutex
+	requests := map[string]int{}
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/post":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(page))
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("png"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+
+	extractor := New(http.DefaultClient, Options{
+		Enabled:  func(uri string) bool { return uri == "http://feed" },
+		Interval: time.Millisecond,
+	})
+
+	assert.True(extractor.Enabled("http://feed"))
+	assert.False(extractor.Enabled("http://other"))
+
+	feed := riverjs.Feed{Items: []riverjs.Item{
+		{Title: "post", Link: s.URL + "/post"},
+		{Title: "missing", Link: s.URL + "/missing", Content: "<p>kept</p>"},
+		{Title: "image", PermaLink: s.URL + "/image"},
+		{Title: "no link"},
+	}}
+
+	evs := make(chan events.Event, 10)
+	extractor.Extract("http://feed", &feed, evs, nil)
+	close(evs)
+
+	assert.Contains(feed.Items[0].Content, "This is the first paragraph")
+	assert.Equal("<p>kept</p>", feed.Items[1].Content)
+	assert.Equal("", feed.Items[2].Content)
+	assert.Equal("", feed.Items[3].Content)
+
+	var received []events.Event
+	for event := range evs {
+		received = append(received, event)
+	}
+
+	if assert.Len(received, 3) {
+		assert.Equal("http://feed", received[0].URI)
+		assert.Equal(s.URL+"/post", received[0].Page)
+		assert.Equal(http.StatusOK, received[0].Code)
+		assert.Equal(int64(len(page)), received[0].Bytes)
+		assert.Equal("", received[0].Error)
+
+		assert.Equal(s.URL+"/missing", received[1].Page)
+		assert.Equal(http.StatusNotFound, received[1].Code)
+		assert.NotEqual("", received[1].Error)
+
+		assert.Equal(s.URL+"/image", received[2].Page)
+		assert.NotEqual("", received[2].Error)
+	}
+
+	// pages already fetched are not fetched again
+	again := riverjs.Feed{Items: []riverjs.Item{
+		{Title: "post", Link: s.URL + "/post"},
+		{Title: "missing", Link: s.URL + "/missing"},
+	}}
+
+	evs = make(chan events.Event, 10)
+	extractor.Extract("http://feed", &again, evs, nil)
+	close(evs)
+
+	assert.Contains(again.Items[0].Content, "This is the first paragraph")
+	assert.Len(evs, 0)
+
+	mu.Lock()
+	assert.Equal(map[string]int{"/post": 1, "/missing": 1, "/image": 1}, requests)
+	mu.Unlock()
+}
+
+func TestExtractorWaitsBetweenRequestsToHost(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(page))
+	}))
+	defer s.Close()
+
+	extractor := New(http.DefaultClient, Options{Interval: 50 * time.Millisecond})
+
+	feed := riverjs.Feed{Items: []riverjs.Item{
+		{Link: s.URL + "/1"},
+		{Link: s.URL + "/2"},
+		{Link: s.URL + "/3"},
+	}}
+
+	start := time.Now()
+	extractor.Extract("http://feed", &feed, make(chan events.Event, 10), nil)
+
+	assert.True(t, time.Since(start) >= 100*time.Millisecond)
+}
+
+func TestExtractorDoesNotHoldUpOtherHostsWhileWaiting(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(page))
+	})
+	a := httptest.NewServer(handler)
+	defer a.Close()
+	b := httptest.NewServer(handler)
+	defer b.Close()
+
+	extractor := New(http.DefaultClient, Options{Interval: 500 * time.Millisecond, Concurrency: 1})
+
+	// the second page from a waits for the interval to pass
+	go extractor.Extract("http://a", &riverjs.Feed{Items: []riverjs.Item{
+		{Link: a.URL + "/1"},
+		{Link: a.URL + "/2"},
+	}}, make(chan events.Event, 10), nil)
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	extractor.Extract("http://b", &riverjs.Feed{Items: []riverjs.Item{
+		{Link: b.URL + "/1"},
+	}}, make(chan events.Event, 10), nil)
+
+	assert.True(t, time.Since(start) < 250*time.Millisecond)
+}
+
+func TestExtractorStops(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(page))
+	}))
+	defer s.Close()
+
+	extractor := New(http.DefaultClient, Options{Interval: time.Millisecond})
+
+	feed := riverjs.Feed{Items: []riverjs.Item{
+		{Link: s.URL + "/1"},
+		{Link: s.URL + "/2"},
+	}}
+
+	// nothing is reading evs, so only the first page is fetched
+	stop := make(chan struct{})
+	time.AfterFunc(50*time.Millisecond, func() { close(stop) })
+	extractor.Extract("http://feed", &feed, make(chan events.Event), stop)
+
+	assert.Contains(t, feed.Items[0].Content, "This is the first paragraph")
+	assert.Equal(t, "", feed.Items[1].Content)
+}
+
+func TestExtractorStopsWhileWaiting(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(page))
+	}))
+	defer s.Close()
+
+	extractor := New(http.DefaultClient, Options{Interval: time.Hour})
+
+	feed := riverjs.Feed{Items: []riverjs.Item{
+		{Link: s.URL + "/1"},
+		{Link: s.URL + "/2"},
+	}}
+
+	stop := make(chan struct{})
+	time.AfterFunc(50*time.Millisecond, func() { close(stop) })
+
+	start := time.Now()
+	extractor.Extract("http://feed", &feed, make(chan events.Event, 10), stop)
+
+	assert.True(t, time.Since(start) < time.Second)
+	assert.Contains(t, feed.Items[0].Content, "This is the first paragraph")
+	assert.Equal(t, "", feed.Items[1].Content)
+}
+
+func TestExtractorRetriesServerErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	failing := true
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(page))
+	}))
+	defer s.Close()
+
+	extractor := New(http.DefaultClient, Options{Interval: time.Millisecond})
+
+	feed := riverjs.Feed{Items: []riverjs.Item{{Link: s.URL + "/post"}}}
+	evs := make(chan events.Event, 10)
+	extractor.Extract("http://feed", &feed, evs, nil)
+
+	assert.Equal("", feed.Items[0].Content)
+	if assert.Len(evs, 1) {
+		assert.Equal(http.StatusServiceUnavailable, (<-evs).Code)
+	}
+
+	failing = false
+	feed = riverjs.Feed{Items: []riverjs.Item{{Link: s.URL + "/post"}}}
+	extractor.Extract("http://feed", &feed, evs, nil)
+
+	assert.Contains(feed.Items[0].Content, "This is the first paragraph")
+	assert.Len(evs, 1)
+}
+
+func TestCache(t *testing.T) {
+	assert := assert.New(t)
+
+	c := newCache(2)
+	c.add("a", "1")
+	c.add("b", "2")
+
+	v, ok := c.get("a")
+	assert.True(ok)
+	assert.Equal("1", v)
+
+	// b is the least recently used so is removed
+	c.add("c", "3")
+
+	_, ok = c.get("b")
+	assert.False(ok)
+
+	v, ok = c.get("a")
+	assert.True(ok)
+	assert.Equal("1", v)
+
+	v, ok = c.get("c")
+	assert.True(ok)
+	assert.Equal("3", v)
+}
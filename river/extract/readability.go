@@ -0,0 +1,279 @@
+package extract
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"hawx.me/code/riviera/river/safehtml"
+)
+
+// ErrNoArticle is returned when no article can be found in a page.
+var ErrNoArticle = errors.New("no article found")
+
+var (
+	unlikely = regexp.MustCompile(`(?i)banner|breadcrumb|combx|comment|community|cookie|disqus|extra|footer|gdpr|header|legend|menu|modal|nav|pager|pagination|popup|related|remark|replies|rss|share|shoutbox|sidebar|skyscraper|social|sponsor|subscribe|supplemental|widget`)
+	maybe    = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow`)
+	positive = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|post|story|text|blog`)
+	negative = regexp.MustCompile(`(?i)-ad-|ad-break|agegate|comment|com-|contact|footer|footnote|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget`)
+)
+
+// removedTags are dropped from the page before it is scored.
+var removedTags = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Noscript: true,
+	atom.Iframe:   true,
+	atom.Form:     true,
+	atom.Nav:      true,
+	atom.Aside:    true,
+	atom.Footer:   true,
+	atom.Button:   true,
+	atom.Select:   true,
+	atom.Svg:      true,
+}
+
+// minLength is the number of characters of text an article must have.
+const minLength = 250
+
+// Readability returns the main article of the HTML page as sanitized HTML,
+// with addresses resolved against base. It is a simplified version of the
+// algorithm used by Arc90's Readability: paragraphs of text score the
+// elements that contain them, with the names of elements suggesting whether
+// they are likely to hold the article, and the best scoring element is taken
+// along with any siblings that score well.
+func Readability(r io.Reader, base *url.URL) (string, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return "", err
+	}
+
+	prune(doc)
+
+	scores := map[*html.Node]float64{}
+	var candidates []*html.Node
+
+	walk(doc, func(n *html.Node) {
+		if n.DataAtom != atom.P && n.DataAtom != atom.Pre && n.DataAtom != atom.Td {
+			return
+		}
+
+		text := textOf(n)
+		if len(text) < 25 {
+			return
+		}
+
+		score := 1 + float64(strings.Count(text, ",")) + minFloat(float64(len(text))/100, 3)
+
+		for i, ancestor := 0, n.Parent; i < 2 && ancestor != nil && ancestor.Type == html.ElementNode; i, ancestor = i+1, ancestor.Parent {
+			if _, ok := scores[ancestor]; !ok {
+				scores[ancestor] = initialScore(ancestor)
+				candidates = append(candidates, ancestor)
+			}
+
+			if i == 0 {
+				scores[ancestor] += score
+			} else {
+				scores[ancestor] += score / 2
+			}
+		}
+	})
+
+	var top *html.Node
+	for _, candidate := range candidates {
+		scores[candidate] *= 1 - linkDensity(candidate)
+
+		if top == nil || scores[candidate] > scores[top] {
+			top = candidate
+		}
+	}
+
+	if top == nil {
+		return "", ErrNoArticle
+	}
+
+	var buf bytes.Buffer
+	if top.Parent == nil || top.DataAtom == atom.Body {
+		html.Render(&buf, top)
+	} else {
+		threshold := maxFloat(10, scores[top]*0.2)
+
+		for sibling := top.Parent.FirstChild; sibling != nil; sibling = sibling.NextSibling {
+			if sibling == top || includeSibling(sibling, scores, threshold) {
+				html.Render(&buf, sibling)
+			}
+		}
+	}
+
+	article := safehtml.Sanitize(buf.String(), base)
+	if len(textOfHTML(article)) < minLength {
+		return "", ErrNoArticle
+	}
+
+	return article, nil
+}
+
+// prune removes the elements that are unlikely to be part of the article.
+func prune(n *html.Node) {
+	for child := n.FirstChild; child != nil; {
+		next := child.NextSibling
+
+		switch {
+		case child.Type == html.CommentNode:
+			n.RemoveChild(child)
+
+		case child.Type == html.ElementNode && (removedTags[child.DataAtom] || isUnlikely(child)):
+			n.RemoveChild(child)
+
+		default:
+			prune(child)
+		}
+
+		child = next
+	}
+}
+
+func isUnlikely(n *html.Node) bool {
+	if n.DataAtom == atom.Body || n.DataAtom == atom.Article || n.DataAtom == atom.Main {
+		return false
+	}
+
+	names := classAndID(n)
+	return names != "" && unlikely.MatchString(names) && !maybe.MatchString(names)
+}
+
+func initialScore(n *html.Node) float64 {
+	var score float64
+
+	switch n.DataAtom {
+	case atom.Article, atom.Main:
+		score = 10
+	case atom.Div:
+		score = 5
+	case atom.Pre, atom.Td, atom.Blockquote:
+		score = 3
+	case atom.Address, atom.Ol, atom.Ul, atom.Dl, atom.Dd, atom.Dt, atom.Li:
+		score = -3
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Th:
+		score = -5
+	}
+
+	names := classAndID(n)
+	if negative.MatchString(names) {
+		score -= 25
+	}
+	if positive.MatchString(names) {
+		score += 25
+	}
+
+	return score
+}
+
+// includeSibling returns true if the sibling of the top candidate looks to be
+// part of the article too.
+func includeSibling(n *html.Node, scores map[*html.Node]float64, threshold float64) bool {
+	if score, ok := scores[n]; ok && score >= threshold {
+		return true
+	}
+
+	if n.Type != html.ElementNode || n.DataAtom != atom.P {
+		return false
+	}
+
+	text := textOf(n)
+	density := linkDensity(n)
+
+	return (len(text) > 80 && density < 0.25) ||
+		(len(text) > 0 && density == 0 && strings.Contains(text, ". "))
+}
+
+// linkDensity returns the proportion of the text of n that is within links.
+func linkDensity(n *html.Node) float64 {
+	length := len(textOf(n))
+	if length == 0 {
+		return 0
+	}
+
+	linked := 0
+	walk(n, func(c *html.Node) {
+		if c.DataAtom == atom.A {
+			linked += len(textOf(c))
+		}
+	})
+
+	return float64(linked) / float64(length)
+}
+
+func classAndID(n *html.Node) string {
+	var names []string
+	for _, attr := range n.Attr {
+		if attr.Key == "class" || attr.Key == "id" {
+			names = append(names, attr.Val)
+		}
+	}
+
+	return strings.Join(names, " ")
+}
+
+// walk calls fn for each element within n, including n.
+func walk(n *html.Node, fn func(*html.Node)) {
+	if n.Type == html.ElementNode {
+		fn(n)
+	}
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		walk(child, fn)
+	}
+}
+
+// textOf returns the text within n, with whitespace collapsed.
+func textOf(n *html.Node) string {
+	var buf bytes.Buffer
+
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			buf.WriteString(n.Data)
+			buf.WriteByte(' ')
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			collect(child)
+		}
+	}
+	collect(n)
+
+	return strings.Join(strings.Fields(buf.String()), " ")
+}
+
+func textOfHTML(s string) string {
+	nodes, err := html.ParseFragment(strings.NewReader(s), &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div})
+	if err != nil {
+		return ""
+	}
+
+	var text []string
+	for _, n := range nodes {
+		text = append(text, textOf(n))
+	}
+
+	return strings.Join(text, " ")
+}
+
+func minFloat(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxFloat(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
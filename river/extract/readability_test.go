@@ -0,0 +1,61 @@
+package extract
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const page = `<!DOCTYPE html>
+<html>
+<head><title>A post</title><script>var tracking = true;</script></head>
+<body>
+  <div id="header"><a href="/">Home</a> <a href="/about">About</a></div>
+  <nav><a href="/archive">Archive</a></nav>
+  <div class="sidebar">
+    <p>Subscribe to the newsletter, it is the best newsletter, with news, letters and more.</p>
+  </div>
+  <div class="post-content">
+    <h1>A post</h1>
+    <p>This is the first paragraph of the article, it has a few words, some commas, and goes on for a while.</p>
+    <p>This is the second paragraph, which also goes on, and on, so that it looks like the body of the text.</p>
+    <p>And a third paragraph with an <a href="/other">internal link</a> and an image, <img src="/cat.png" alt="cat">, to finish.</p>
+    <script>alert("hi")</script>
+  </div>
+  <div class="comments">
+    <p>First! This comment is long enough to be scored as a paragraph of text, but should not be.</p>
+  </div>
+  <div id="footer"><p>Copyright, all rights reserved, and so on and so forth.</p></div>
+</body>
+</html>`
+
+func TestReadability(t *testing.T) {
+	assert := assert.New(t)
+
+	base, _ := url.Parse("http://example.com/posts/1")
+	article, err := Readability(strings.NewReader(page), base)
+	assert.Nil(err)
+
+	assert.Contains(article, "This is the first paragraph")
+	assert.Contains(article, "This is the second paragraph")
+	assert.Contains(article, `<a href="http://example.com/other" rel="noopener noreferrer">internal link</a>`)
+	assert.Contains(article, `<img src="http://example.com/cat.png" alt="cat"/>`)
+
+	assert.NotContains(article, "Home")
+	assert.NotContains(article, "Archive")
+	assert.NotContains(article, "newsletter")
+	assert.NotContains(article, "First!")
+	assert.NotContains(article, "Copyright")
+	assert.NotContains(article, "alert")
+	assert.NotContains(article, "tracking")
+}
+
+func TestReadabilityWhenNoArticle(t *testing.T) {
+	_, err := Readability(strings.NewReader(`<html><body><p>Too short.</p></body></html>`), nil)
+	assert.Equal(t, ErrNoArticle, err)
+
+	_, err = Readability(strings.NewReader(`<html><body><ul><li><a href="/a">A</a></li></ul></body></html>`), nil)
+	assert.Equal(t, ErrNoArticle, err)
+}
@@ -1,30 +1,582 @@
 package river
 
 import (
+	"bytes"
 	"encoding/json"
 	"html/template"
 	"log"
 	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"hawx.me/code/riviera/river/events"
+	"hawx.me/code/riviera/river/readstate"
+	"hawx.me/code/riviera/river/riverjs"
+	"hawx.me/code/riviera/river/search"
+	"hawx.me/code/riviera/river/syndication"
+	"hawx.me/code/riviera/subscriptions"
 )
 
-func List(feeds River, templates *template.Template) http.Handler {
+// dateFormat is the format of dates given as parameters to handlers.
+const dateFormat = "2006-01-02"
+
+type listItem struct {
+	riverjs.Item
+	Key  string
+	Read bool
+}
+
+type listFeed struct {
+	riverjs.Feed
+	Items []listItem
+}
+
+// List serves the latest river as a page. Passing "unread=1" hides items that
+// have been marked as read, "new=1" shows only the blocks that arrived since the
+// page was last looked at, and "folder" shows only the blocks from feeds in
+// that folder of subs.
+func List(feeds River, subs subscriptions.List, templates *template.Template) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		river, err := feeds.Latest()
+		folder := r.FormValue("folder")
+
+		river, err := latestIn(feeds, subs, folder)
 		if err != nil {
 			log.Println("/", err)
 			return
 		}
 
-		if err := templates.ExecuteTemplate(w, "list.gotmpl", river); err != nil {
+		var (
+			unread  = r.FormValue("unread") == "1"
+			onlyNew = r.FormValue("new") == "1"
+			mark    = feeds.Mark()
+			newest  time.Time
+			blocks  = []listFeed{}
+		)
+
+		for _, feed := range river.UpdatedFeeds.UpdatedFeeds {
+			if feed.WhenLastUpdate.After(newest) {
+				newest = feed.WhenLastUpdate.Time
+			}
+			if onlyNew && !feed.WhenLastUpdate.After(mark) {
+				continue
+			}
+
+			block := listFeed{Feed: feed, Items: []listItem{}}
+			for _, item := range feed.Items {
+				key := readstate.Key(feed.FeedURL, item.ID)
+				read := feeds.Read(key)
+				if unread && read {
+					continue
+				}
+
+				block.Items = append(block.Items, listItem{Item: item, Key: key, Read: read})
+			}
+
+			if len(block.Items) > 0 {
+				blocks = append(blocks, block)
+			}
+		}
+
+		// only part of the river has been looked at when showing a folder
+		if folder == "" {
+			feeds.SetMark(newest)
+		}
+
+		if err := templates.ExecuteTemplate(w, "list.gotmpl", &struct {
+			Feeds   []listFeed
+			Unread  bool
+			New     bool
+			Mark    riverjs.RssTime
+			Folder  string
+			Folders []string
+		}{
+			Feeds:   blocks,
+			Unread:  unread,
+			New:     onlyNew,
+			Mark:    riverjs.Time(mark),
+			Folder:  folder,
+			Folders: subscriptions.Folders(subs),
+		}); err != nil {
 			log.Println("/", err)
 		}
 	})
 }
 
+type podcastEpisode struct {
+	riverjs.Item
+	Feed  riverjs.Feed
+	Key   string
+	Read  bool
+	Audio *riverjs.Enclosure
+}
+
+// Artwork returns the image to show for the episode.
+func (e podcastEpisode) Artwork() string {
+	if e.Podcast != nil && e.Podcast.Image != "" {
+		return e.Podcast.Image
+	}
+	if e.Thumbnail != nil {
+		return e.Thumbnail.URL
+	}
+
+	return ""
+}
+
+// Podcasts serves the items in the latest river that can be listened to as a
+// page, newest first, each with a player. Passing "folder" shows only the
+// episodes from feeds in that folder of subs.
+func Podcasts(feeds River, subs subscriptions.List, templates *template.Template) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		folder := r.FormValue("folder")
+
+		river, err := latestIn(feeds, subs, folder)
+		if err != nil {
+			log.Println("/podcasts", err)
+			return
+		}
+
+		episodes := []podcastEpisode{}
+		for _, feed := range river.UpdatedFeeds.UpdatedFeeds {
+			for _, item := range feed.Items {
+				audio := item.Audio()
+				if audio == nil {
+					continue
+				}
+
+				key := readstate.Key(feed.FeedURL, item.ID)
+				episodes = append(episodes, podcastEpisode{
+					Item:  item,
+					Feed:  feed,
+					Key:   key,
+					Read:  feeds.Read(key),
+					Audio: audio,
+				})
+			}
+		}
+
+		sort.SliceStable(episodes, func(i, j int) bool {
+			return episodes[i].PubDate.After(episodes[j].PubDate.Time)
+		})
+
+		if err := templates.ExecuteTemplate(w, "podcasts.gotmpl", struct {
+			Episodes []podcastEpisode
+			Folder   string
+			Folders  []string
+		}{
+			Episodes: episodes,
+			Folder:   folder,
+			Folders:  subscriptions.Folders(subs),
+		}); err != nil {
+			log.Println("/podcasts", err)
+		}
+	})
+}
+
+// latestIn returns the current river, or if folder is not empty only the blocks
+// from the feeds in that folder of subs.
+func latestIn(feeds River, subs subscriptions.List, folder string) (riverjs.River, error) {
+	if folder == "" {
+		return feeds.Latest()
+	}
+
+	inFolder := map[string]bool{}
+	for _, sub := range subs.List() {
+		if sub.InFolder(folder) {
+			inFolder[sub.URI] = true
+		}
+	}
+
+	return feeds.Filter(func(uri string) bool { return inFolder[uri] })
+}
+
+// Read marks items as read. The items are given as "item" parameters, each
+// being a key as returned by readstate.Key, or if "all=1" is given every item
+// in the latest river is marked. The client is then redirected back to the page
+// it came from.
+func Read(feeds River) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		r.ParseForm()
+		keys := r.PostForm["item"]
+
+		if r.PostForm.Get("all") == "1" {
+			river, err := feeds.Latest()
+			if err != nil {
+				log.Println("/read:", err)
+				return
+			}
+
+			for _, feed := range river.UpdatedFeeds.UpdatedFeeds {
+				for _, item := range feed.Items {
+					keys = append(keys, readstate.Key(feed.FeedURL, item.ID))
+				}
+			}
+		}
+
+		feeds.MarkRead(keys...)
+
+		redirect := r.Referer()
+		if redirect == "" {
+			redirect = "/"
+		}
+		http.Redirect(w, r, redirect, http.StatusSeeOther)
+	})
+}
+
+// Riverjs serves the latest river as a riverjs document. If the path requested
+// ends in ".js" the document is instead wrapped in the onGetRiverStream
+// callback, as riverjs clients expect.
+func Riverjs(feeds River) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		latest, err := feeds.Latest()
+		if err != nil {
+			log.Println(r.URL.Path, err)
+			return
+		}
+
+		if !strings.HasSuffix(r.URL.Path, ".js") {
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(latest); err != nil {
+				log.Println("/river:", err)
+			}
+			return
+		}
+
+		var buf bytes.Buffer
+		if err := json.NewEncoder(&buf).Encode(latest); err != nil {
+			log.Println("/river.js:", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/javascript")
+		w.Write([]byte("onGetRiverStream("))
+		w.Write(bytes.TrimSpace(buf.Bytes()))
+		w.Write([]byte(")"))
+	})
+}
+
+// Syndicate serves the latest river as a feed: as Atom if the path requested
+// ends in ".atom", as RSS if it ends in ".rss", or as JSON Feed if it ends in
+// ".json". The "folder" parameter limits the feed to the blocks from feeds in
+// that folder of subs.
+func Syndicate(feeds River, subs subscriptions.List) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		folder := r.FormValue("folder")
+
+		river, err := latestIn(feeds, subs, folder)
+		if err != nil {
+			log.Println(r.URL.Path+":", err)
+			return
+		}
+
+		channel := syndication.Channel{
+			Title:   "Riviera",
+			Link:    absoluteURL(r, "/"),
+			Self:    absoluteURL(r, r.URL.RequestURI()),
+			Updated: river.Metadata.WhenGMT.Time,
+		}
+		if folder != "" {
+			channel.Title += ": " + folder
+			channel.Link = absoluteURL(r, "/?"+url.Values{"folder": {folder}}.Encode())
+		}
+
+		var blocks []riverjs.Feed
+		for _, feed := range river.UpdatedFeeds.UpdatedFeeds {
+			if len(blocks) == 0 || feed.WhenLastUpdate.After(channel.Updated) {
+				channel.Updated = feed.WhenLastUpdate.Time
+			}
+			blocks = append(blocks, feed)
+		}
+
+		switch {
+		case strings.HasSuffix(r.URL.Path, ".atom"):
+			w.Header().Set("Content-Type", "application/atom+xml")
+			err = syndication.Atom(w, channel, blocks)
+		case strings.HasSuffix(r.URL.Path, ".rss"):
+			w.Header().Set("Content-Type", "application/rss+xml")
+			err = syndication.RSS(w, channel, blocks)
+		case strings.HasSuffix(r.URL.Path, ".json"):
+			w.Header().Set("Content-Type", "application/feed+json")
+			err = syndication.JSONFeed(w, channel, blocks)
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		if err != nil {
+			log.Println(r.URL.Path+":", err)
+		}
+	})
+}
+
+// absoluteURL returns the URL of path on the host the request was made to.
+func absoluteURL(r *http.Request, path string) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+
+	return scheme + "://" + r.Host + path
+}
+
+// Search serves the results of a search over past items. The query is given by
+// the "q" parameter, and can be filtered with the "feed", "since" and "until"
+// parameters, dates being given as YYYY-MM-DD. If the path requested ends in
+// ".json" the results are served as JSON instead of a page.
+func Search(feeds River, templates *template.Template) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := search.ParseQuery(r.FormValue("q"))
+		query.Feed = r.FormValue("feed")
+		query.Limit = 50
+
+		if since, err := time.Parse(dateFormat, r.FormValue("since")); err == nil {
+			query.Since = since
+		}
+		if until, err := time.Parse(dateFormat, r.FormValue("until")); err == nil {
+			query.Until = until.Add(24 * time.Hour)
+		}
+
+		results := feeds.Search(query)
+
+		if strings.HasSuffix(r.URL.Path, ".json") {
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(results); err != nil {
+				log.Println("/search.json:", err)
+			}
+			return
+		}
+
+		if err := templates.ExecuteTemplate(w, "search.gotmpl", struct {
+			Q, Feed, Since, Until string
+			Results               []search.Result
+		}{
+			Q:       r.FormValue("q"),
+			Feed:    r.FormValue("feed"),
+			Since:   r.FormValue("since"),
+			Until:   r.FormValue("until"),
+			Results: results,
+		}); err != nil {
+			log.Println("/search:", err)
+		}
+	})
+}
+
+// Feed serves a page of archived items for the feed with the URL given after
+// "/feed/" in the path, for example "/feed/http://example.com/feed". Older
+// items are paged through using the "before" parameter.
+func Feed(feeds River, templates *template.Template) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		feedURL := strings.TrimPrefix(r.URL.Path, "/feed/")
+
+		// http.ServeMux cleans paths, so the "//" following the scheme will have
+		// been reduced to a single slash.
+		if i := strings.Index(feedURL, ":/"); i > 0 && !strings.HasPrefix(feedURL[i:], "://") {
+			feedURL = feedURL[:i] + "://" + feedURL[i+2:]
+		}
+
+		feed, next, ok := feeds.Archive(feedURL, r.FormValue("before"), 50)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		if err := templates.ExecuteTemplate(w, "feed.gotmpl", struct {
+			Feed riverjs.Feed
+			Path string
+			Next string
+		}{
+			Feed: feed,
+			Path: r.URL.EscapedPath(),
+			Next: next,
+		}); err != nil {
+			log.Println("/feed:", err)
+		}
+	})
+}
+
+type feedRow struct {
+	Sub    subscriptions.Subscription
+	Health events.Health
+}
+
+// Dead returns true if the feed is no longer fetched, as it was found to be
+// dead or is commented out of the subscriptions.
+func (r feedRow) Dead() bool {
+	return r.Sub.Dead || r.Health.Dead
+}
+
+// feedSorts are the orders that Feeds can be sorted in.
+var feedSorts = map[string]func(a, b feedRow) bool{
+	"title": func(a, b feedRow) bool {
+		return strings.ToLower(a.Sub.FeedTitle) < strings.ToLower(b.Sub.FeedTitle)
+	},
+	"success":  func(a, b feedRow) bool { return a.Health.LastSuccess.Before(b.Health.LastSuccess) },
+	"failure":  func(a, b feedRow) bool { return a.Health.LastFailure.Before(b.Health.LastFailure) },
+	"failures": func(a, b feedRow) bool { return a.Health.Failures < b.Health.Failures },
+	"items":    func(a, b feedRow) bool { return a.Health.ItemsPerDay < b.Health.ItemsPerDay },
+	"interval": func(a, b feedRow) bool { return a.Health.Interval < b.Health.Interval },
+}
+
+// Feeds serves a page listing each of subs along with the health of the feed.
+// The list is ordered by the "sort" parameter, one of "title", "success",
+// "failure", "failures", "items" or "interval", and reversed by "desc=1".
+//
+// POSTing a "url" with an "action" of "pause" or "resume" stops or restarts
+// fetching the feed, "revive" fetches a dead feed again, and "remove"
+// unsubscribes using editor, which can be nil if the subscriptions can not be
+// changed. The client is then redirected back to the page it came from.
+func Feeds(feeds River, subs subscriptions.List, editor *subscriptions.Editor, templates *template.Template) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			uri := r.PostFormValue("url")
+
+			switch r.PostFormValue("action") {
+			case "pause":
+				feeds.Pause(uri)
+			case "resume":
+				feeds.Resume(uri)
+			case "revive":
+				if editor != nil {
+					if sub, ok := editor.Subscriptions().Get(uri); ok && sub.Dead && sub.Include == "" {
+						if _, err := editor.Update(uri, func(sub *subscriptions.Subscription) { sub.Dead = false }); err != nil {
+							log.Println("/feeds:", err)
+							http.Error(w, err.Error(), http.StatusBadRequest)
+							return
+						}
+					}
+				}
+				feeds.Revive(uri)
+			case "remove":
+				if editor == nil {
+					http.Error(w, "subscriptions can not be changed", http.StatusMethodNotAllowed)
+					return
+				}
+				if err := editor.Remove(uri); err != nil {
+					log.Println("/feeds:", err)
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			default:
+				http.Error(w, "unknown action", http.StatusBadRequest)
+				return
+			}
+
+			redirect := r.Referer()
+			if redirect == "" {
+				redirect = "/feeds"
+			}
+			http.Redirect(w, r, redirect, http.StatusSeeOther)
+			return
+		}
+
+		health := map[string]events.Health{}
+		for _, h := range feeds.Health() {
+			health[h.URI] = h
+		}
+
+		rows := []feedRow{}
+		for _, sub := range subs.List() {
+			h, ok := health[sub.URI]
+			if !ok {
+				h = events.Health{URI: sub.URI}
+			}
+			h.Interval = h.Interval.Round(time.Minute)
+
+			rows = append(rows, feedRow{Sub: sub, Health: h})
+		}
+
+		sortBy := r.FormValue("sort")
+		less, ok := feedSorts[sortBy]
+		if !ok {
+			sortBy, less = "title", feedSorts["title"]
+		}
+		desc := r.FormValue("desc") == "1"
+
+		sort.SliceStable(rows, func(i, j int) bool {
+			if desc {
+				return less(rows[j], rows[i])
+			}
+			return less(rows[i], rows[j])
+		})
+
+		if err := templates.ExecuteTemplate(w, "feeds.gotmpl", struct {
+			Feeds     []feedRow
+			Sort      string
+			Desc      bool
+			CanRemove bool
+		}{
+			Feeds:     rows,
+			Sort:      sortBy,
+			Desc:      desc,
+			CanRemove: editor != nil,
+		}); err != nil {
+			log.Println("/feeds:", err)
+		}
+	})
+}
+
+type logDay struct {
+	Header string
+	Items  []events.Event
+}
+
+// Log serves the fetch events as a page, grouped by day. The events can be
+// filtered with the "feed" parameter, "status" given as the class returned by
+// events.Event.Status, and the "since" and "until" parameters, dates being given
+// as YYYY-MM-DD. If the path requested ends in ".json" the events are served as
+// JSON instead of a page.
 func Log(feeds River, templates *template.Template) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(feeds.Log()); err != nil {
+		filter := events.Filter{
+			URI:    r.FormValue("feed"),
+			Status: r.FormValue("status"),
+		}
+		if since, err := time.Parse(dateFormat, r.FormValue("since")); err == nil {
+			filter.Since = since
+		}
+		if until, err := time.Parse(dateFormat, r.FormValue("until")); err == nil {
+			filter.Until = until.Add(24 * time.Hour)
+		}
+
+		evs := filter.Apply(feeds.Log())
+
+		if strings.HasSuffix(r.URL.Path, ".json") {
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(evs); err != nil {
+				log.Println("/log.json:", err)
+			}
+			return
+		}
+
+		days := []logDay{}
+		for _, ev := range evs {
+			ev.Duration = ev.Duration.Round(time.Millisecond)
+
+			header := ev.At.Local().Format("Monday, 2 January 2006")
+			if len(days) == 0 || days[len(days)-1].Header != header {
+				days = append(days, logDay{Header: header})
+			}
+			days[len(days)-1].Items = append(days[len(days)-1].Items, ev)
+		}
+
+		if err := templates.ExecuteTemplate(w, "log.gotmpl", struct {
+			Feed, Status, Since, Until string
+			Statuses                   []string
+			Days                       []logDay
+		}{
+			Feed:     r.FormValue("feed"),
+			Status:   r.FormValue("status"),
+			Since:    r.FormValue("since"),
+			Until:    r.FormValue("until"),
+			Statuses: []string{"ok", "redirect", "error", "fault", "unknown"},
+			Days:     days,
+		}); err != nil {
 			log.Println("/log:", err)
 		}
 	})
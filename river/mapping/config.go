@@ -0,0 +1,190 @@
+package mapping
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"hawx.me/code/riviera/feed/common"
+	"hawx.me/code/riviera/river/riverjs"
+)
+
+// A Config is a list of Rules, read from a JSON file, that build the Mapping
+// for each feed. For example,
+//
+//	{
+//	  "rules": [
+//	    {"stripTracking": true, "maxAgeDays": 30},
+//	    {"folder": "News", "exclude": ["sponsored", "/^ad:/i"], "dedup": true},
+//	    {"feed": "https://example.com/feed", "include": ["golang"],
+//	     "rewriteTitle": [{"match": "^\\[Example\\] ", "replace": ""}]}
+//	  ]
+//	}
+type Config struct {
+	Rules []Rule `json:"rules"`
+}
+
+// A Rule applies filters to the items of some feeds.
+type Rule struct {
+	// Feed and Folder, if given, limit the rule to the feed with the URL, or to
+	// the feeds in the folder or its subfolders. If neither is given the rule
+	// applies to every feed.
+	Feed   string `json:"feed,omitempty"`
+	Folder string `json:"folder,omitempty"`
+
+	// Include, if given, drops items that do not match any of the patterns.
+	// Exclude drops items that match any of the patterns. See ParsePattern for
+	// the format of each.
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+
+	// RewriteTitle changes the titles of items.
+	RewriteTitle []Rewrite `json:"rewriteTitle,omitempty"`
+
+	// StripParams are the query parameters to remove from the links of items,
+	// StripTracking removes DefaultTrackingParams.
+	StripParams   []string `json:"stripParams,omitempty"`
+	StripTracking bool     `json:"stripTracking,omitempty"`
+
+	// MaxAgeDays, if given, drops items published more than the number of days
+	// ago.
+	MaxAgeDays int `json:"maxAgeDays,omitempty"`
+
+	// Dedup, if given, turns merging items that are the same story as items in
+	// other feeds on or off, see Config.Dedup.
+	Dedup *bool `json:"dedup,omitempty"`
+
+	filters []Filter
+}
+
+// A Rewrite replaces the text that matches a regular expression.
+type Rewrite struct {
+	Match   string `json:"match"`
+	Replace string `json:"replace"`
+}
+
+// LoadConfig reads the Config from the JSON file at path.
+func LoadConfig(path string) (*Config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var config Config
+	if err := json.NewDecoder(file).Decode(&config); err != nil {
+		return nil, fmt.Errorf("could not read %s: %v", path, err)
+	}
+
+	for i := range config.Rules {
+		if err := config.Rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("rule %d of %s: %v", i+1, path, err)
+		}
+	}
+
+	return &config, nil
+}
+
+// compile checks the rule, and creates the filters it applies.
+func (r *Rule) compile() error {
+	r.filters = nil
+
+	if len(r.Exclude) > 0 {
+		patterns, err := parsePatterns(r.Exclude)
+		if err != nil {
+			return err
+		}
+		r.filters = append(r.filters, Exclude(patterns...))
+	}
+
+	if len(r.Include) > 0 {
+		patterns, err := parsePatterns(r.Include)
+		if err != nil {
+			return err
+		}
+		r.filters = append(r.filters, Include(patterns...))
+	}
+
+	if r.MaxAgeDays > 0 {
+		r.filters = append(r.filters, MaxAge(time.Duration(r.MaxAgeDays)*24*time.Hour))
+	}
+
+	for _, rewrite := range r.RewriteTitle {
+		re, err := regexp.Compile(rewrite.Match)
+		if err != nil {
+			return err
+		}
+		r.filters = append(r.filters, RewriteTitle(re, rewrite.Replace))
+	}
+
+	params := r.StripParams
+	if r.StripTracking {
+		params = append(append([]string{}, params...), DefaultTrackingParams...)
+	}
+	if len(params) > 0 {
+		r.filters = append(r.filters, StripParams(params...))
+	}
+
+	return nil
+}
+
+func parsePatterns(list []string) ([]Pattern, error) {
+	patterns := make([]Pattern, len(list))
+	for i, s := range list {
+		pattern, err := ParsePattern(s)
+		if err != nil {
+			return nil, err
+		}
+		patterns[i] = pattern
+	}
+
+	return patterns, nil
+}
+
+// applies returns true if the rule should be used for the feed.
+func (r *Rule) applies(uri, folder string) bool {
+	if r.Feed != "" && r.Feed != uri {
+		return false
+	}
+	if r.Folder != "" && folder != r.Folder && !strings.HasPrefix(folder, r.Folder+"/") {
+		return false
+	}
+
+	return true
+}
+
+// Mapping returns a Mapping for the feed at uri that maps items with m, then
+// applies the filters of each Rule for the feed, in order. The folder of the
+// feed is found by calling folder for each item, so that the rules follow the
+// feed when it is moved.
+func (c *Config) Mapping(m Mapping, uri string, folder func() string) Mapping {
+	return func(item *common.Item) *riverjs.Item {
+		current := folder()
+
+		var filters []Filter
+		for i := range c.Rules {
+			if c.Rules[i].applies(uri, current) {
+				filters = append(filters, c.Rules[i].filters...)
+			}
+		}
+
+		return Chain(m, filters...)(item)
+	}
+}
+
+// Dedup returns true if the items of the feed at uri, in folder, should be
+// merged with the same story posted in other feeds. This is the value given by
+// the last Rule for the feed that sets it, or def if none do.
+func (c *Config) Dedup(uri, folder string, def bool) bool {
+	dedup := def
+	for i := range c.Rules {
+		if c.Rules[i].Dedup != nil && c.Rules[i].applies(uri, folder) {
+			dedup = *c.Rules[i].Dedup
+		}
+	}
+
+	return dedup
+}
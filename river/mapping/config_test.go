@@ -0,0 +1,95 @@
+package mapping
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"hawx.me/code/riviera/feed/common"
+)
+
+func writeConfig(t *testing.T, dir, content string) string {
+	path := filepath.Join(dir, "mapping.json")
+	assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestConfig(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "riviera-mapping-test")
+	defer os.RemoveAll(dir)
+
+	path := writeConfig(t, dir, `{
+  "rules": [
+    {"stripTracking": true},
+    {"folder": "News", "exclude": ["sponsored"]},
+    {"feed": "http://example.com/feed", "include": ["/^go/i"],
+     "rewriteTitle": [{"match": "^Go: ", "replace": ""}]}
+  ]
+}`)
+
+	config, err := LoadConfig(path)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	folder := "News/World"
+	other := config.Mapping(DefaultMapping, "http://example.org/feed", func() string { return folder })
+	example := config.Mapping(DefaultMapping, "http://example.com/feed", func() string { return "" })
+
+	item := other(&common.Item{
+		Title: "Hello",
+		Links: []common.Link{{Href: "http://example.org/hello?utm_source=rss"}},
+	})
+	if assert.NotNil(t, item) {
+		assert.Equal(t, "http://example.org/hello", item.Link)
+	}
+
+	assert.Nil(t, other(&common.Item{Title: "A Sponsored post"}))
+
+	folder = "Blogs"
+	assert.NotNil(t, other(&common.Item{Title: "A Sponsored post"}))
+
+	assert.Nil(t, example(&common.Item{Title: "Rust: what is new"}))
+	item = example(&common.Item{Title: "Go: what is new"})
+	if assert.NotNil(t, item) {
+		assert.Equal(t, "what is new", item.Title)
+	}
+}
+
+func TestConfigWithInvalidRule(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "riviera-mapping-test")
+	defer os.RemoveAll(dir)
+
+	path := writeConfig(t, dir, `{"rules": [{}, {"exclude": ["/(/"]}]}`)
+
+	_, err := LoadConfig(path)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "rule 2")
+	}
+}
+
+func TestConfigDedup(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "riviera-mapping-test")
+	defer os.RemoveAll(dir)
+
+	path := writeConfig(t, dir, `{
+  "rules": [
+    {"folder": "News", "dedup": true},
+    {"feed": "http://example.com/feed", "dedup": false},
+    {"folder": "Blogs", "stripTracking": true}
+  ]
+}`)
+
+	config, err := LoadConfig(path)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	assert.True(t, config.Dedup("http://example.org/feed", "News/World", false))
+	assert.False(t, config.Dedup("http://example.com/feed", "News", false))
+	assert.False(t, config.Dedup("http://example.org/feed", "Blogs", false))
+	assert.True(t, config.Dedup("http://example.org/feed", "Blogs", true))
+	assert.False(t, config.Dedup("http://example.com/feed", "", true))
+}
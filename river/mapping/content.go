@@ -0,0 +1,71 @@
+package mapping
+
+import (
+	"html"
+	"net/url"
+	"strings"
+
+	"hawx.me/code/riviera/feed/common"
+	"hawx.me/code/riviera/river/riverjs"
+	"hawx.me/code/riviera/river/safehtml"
+)
+
+// contentNamespace is the namespace of the RSS content module, which gives the
+// full content of an item in <content:encoded>.
+const contentNamespace = "http://purl.org/rss/1.0/modules/content/"
+
+// FullContent returns a Mapping that maps items with m, then sets the Content of
+// the item to its full content as sanitized HTML, with addresses resolved
+// against the link of the item.
+func FullContent(m Mapping) Mapping {
+	return func(item *common.Item) *riverjs.Item {
+		i := m(item)
+		if i == nil {
+			return nil
+		}
+
+		content := findContent(item)
+		if content == "" {
+			return i
+		}
+
+		var base *url.URL
+		if i.Link != "" {
+			base, _ = url.Parse(i.Link)
+		}
+		if item.Content != nil && item.Content.Base != "" {
+			if contentBase, err := url.Parse(item.Content.Base); err == nil {
+				if base != nil {
+					contentBase = base.ResolveReference(contentBase)
+				}
+				base = contentBase
+			}
+		}
+
+		i.Content = safehtml.Sanitize(content, base)
+		return i
+	}
+}
+
+// findContent returns the fullest HTML content available for the item, in
+// order: RSS's <content:encoded>, Atom's html or xhtml <content>, the
+// description, then any text content escaped.
+func findContent(item *common.Item) string {
+	if list := item.Extensions[contentNamespace]["encoded"]; len(list) > 0 && list[0].Value != "" {
+		return list[0].Value
+	}
+
+	if item.Content != nil && (item.Content.Type == "html" || item.Content.Type == "xhtml") {
+		return item.Content.Text
+	}
+
+	if strings.TrimSpace(item.Description) != "" {
+		return item.Description
+	}
+
+	if item.Content != nil && item.Content.Text != "" {
+		return "<p>" + strings.Replace(html.EscapeString(item.Content.Text), "\n\n", "</p><p>", -1) + "</p>"
+	}
+
+	return ""
+}
@@ -0,0 +1,74 @@
+package mapping
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"hawx.me/code/riviera/feed/common"
+	"hawx.me/code/riviera/river/riverjs"
+)
+
+func TestFullContent(t *testing.T) {
+	testcases := []struct {
+		name    string
+		item    *common.Item
+		content string
+	}{
+		{
+			"content:encoded",
+			&common.Item{
+				Links:       []common.Link{{Href: "http://example.com/posts/1"}},
+				Description: "<p>Summary</p>",
+				Extensions: map[string]map[string][]common.Extension{
+					contentNamespace: {"encoded": {{Value: `<p>Full <a href="/more">text</a></p><script>alert(1)</script>`}}},
+				},
+			},
+			`<p>Full <a href="http://example.com/more" rel="noopener noreferrer">text</a></p>`,
+		},
+		{
+			"atom html content",
+			&common.Item{
+				Links:       []common.Link{{Href: "http://example.com/posts/1"}},
+				Description: "Summary",
+				Content:     &common.Content{Type: "html", Base: "/blog/", Text: `<img src="a.png">`},
+			},
+			`<img src="http://example.com/blog/a.png"/>`,
+		},
+		{
+			"description",
+			&common.Item{
+				Description: `<p onclick="x()">Just this</p>`,
+			},
+			`<p>Just this</p>`,
+		},
+		{
+			"text content",
+			&common.Item{
+				Content: &common.Content{Type: "text", Text: "1 < 2\n\nThe end"},
+			},
+			`<p>1 &lt; 2</p><p>The end</p>`,
+		},
+		{
+			"none",
+			&common.Item{Title: "Empty"},
+			``,
+		},
+	}
+
+	m := FullContent(DefaultMapping)
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			item := m(tc.item)
+			if assert.NotNil(t, item) {
+				assert.Equal(t, tc.content, item.Content)
+			}
+		})
+	}
+}
+
+func TestFullContentWhenDropped(t *testing.T) {
+	m := FullContent(Chain(DefaultMapping, func(*riverjs.Item) *riverjs.Item { return nil }))
+
+	assert.Nil(t, m(&common.Item{Description: "<p>Hey</p>"}))
+}
@@ -13,8 +13,8 @@ import (
 
 // DefaultMapping will always return an item. It: attempts to parse the PubDate,
 // otherwise uses the current time; truncates the description to 280 characters;
-// finds the correct Link and PermaLink; copies any Enclosures; and fills out
-// the other properties by copying the correct values.
+// finds the correct Link and PermaLink; copies any Enclosures and podcast
+// details; and fills out the other properties by copying the correct values.
 func DefaultMapping(item *common.Item) *riverjs.Item {
 	pubDate, err := item.ParsedPubDate()
 	if err != nil {
@@ -81,6 +81,30 @@ func DefaultMapping(item *common.Item) *riverjs.Item {
 		}
 	}
 
+	if item.Podcast != nil {
+		i.Podcast = &riverjs.Podcast{
+			Duration: item.Podcast.Duration,
+			Image:    item.Podcast.Image,
+			Episode:  item.Podcast.Episode,
+		}
+
+		if item.Podcast.Chapters != nil {
+			i.Podcast.Chapters = &riverjs.Chapters{
+				URL:  item.Podcast.Chapters.URL,
+				Type: item.Podcast.Chapters.Type,
+			}
+		}
+
+		for _, transcript := range item.Podcast.Transcripts {
+			i.Podcast.Transcripts = append(i.Podcast.Transcripts, riverjs.Transcript{
+				URL:      transcript.URL,
+				Type:     transcript.Type,
+				Language: transcript.Language,
+				Rel:      transcript.Rel,
+			})
+		}
+	}
+
 	return i
 }
 
@@ -271,6 +271,34 @@ func TestDefaultMapping(t *testing.T) {
 				Enclosures: []riverjs.Enclosure{},
 			},
 		},
+
+		// Podcast
+		{
+			"podcast",
+			&common.Item{
+				PubDate: "Mon, 02 Jan 2006 20:04:19 UTC",
+				ID:      "5",
+				Podcast: &common.Podcast{
+					Duration:    3723,
+					Image:       "http://example.com/art.jpg",
+					Episode:     2,
+					Chapters:    &common.Chapters{URL: "http://example.com/chapters", Type: "application/json+chapters"},
+					Transcripts: []common.Transcript{{URL: "http://example.com/transcript", Type: "text/vtt", Language: "en"}},
+				},
+			},
+			&riverjs.Item{
+				PubDate: riverjs.Time(time.Date(2006, 1, 2, 20, 4, 19, 0, time.UTC)),
+				ID:      "5",
+				Podcast: &riverjs.Podcast{
+					Duration:    3723,
+					Image:       "http://example.com/art.jpg",
+					Episode:     2,
+					Chapters:    &riverjs.Chapters{URL: "http://example.com/chapters", Type: "application/json+chapters"},
+					Transcripts: []riverjs.Transcript{{URL: "http://example.com/transcript", Type: "text/vtt", Language: "en"}},
+				},
+				Enclosures: []riverjs.Enclosure{},
+			},
+		},
 	}
 
 	assert := assert.New(t)
@@ -287,6 +315,7 @@ func TestDefaultMapping(t *testing.T) {
 		assert.Equal(expected.ID, mapped.ID, tc.name)
 		assert.Equal(expected.Comments, mapped.Comments, tc.name)
 		assert.Equal(expected.Enclosures, mapped.Enclosures, tc.name)
+		assert.Equal(expected.Podcast, mapped.Podcast, tc.name)
 	}
 }
 
@@ -0,0 +1,174 @@
+package mapping
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"hawx.me/code/riviera/feed/common"
+	"hawx.me/code/riviera/river/riverjs"
+)
+
+// A Filter changes an item after it has been mapped for the river, if nil is
+// returned the item will not be added to the river.
+type Filter func(*riverjs.Item) *riverjs.Item
+
+// Chain returns a Mapping that maps items with m, then passes them through each
+// filter in turn. If any returns nil the item is dropped.
+func Chain(m Mapping, filters ...Filter) Mapping {
+	return func(item *common.Item) *riverjs.Item {
+		i := m(item)
+
+		for _, filter := range filters {
+			if i == nil {
+				return nil
+			}
+			i = filter(i)
+		}
+
+		return i
+	}
+}
+
+// A Pattern matches text. It is either a keyword, matched ignoring case, or a
+// regular expression given between slashes, such as "/go(lang)?/". A regular
+// expression followed by "i", such as "/golang/i", ignores case.
+type Pattern struct {
+	keyword string
+	re      *regexp.Regexp
+}
+
+// ParsePattern parses the pattern given, returning an error if it is an
+// invalid regular expression.
+func ParsePattern(s string) (Pattern, error) {
+	if len(s) < 2 || s[0] != '/' {
+		return Pattern{keyword: strings.ToLower(s)}, nil
+	}
+
+	expr := s[1:]
+	switch {
+	case strings.HasSuffix(expr, "/i"):
+		expr = "(?i)" + strings.TrimSuffix(expr, "/i")
+	case strings.HasSuffix(expr, "/"):
+		expr = strings.TrimSuffix(expr, "/")
+	default:
+		return Pattern{keyword: strings.ToLower(s)}, nil
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return Pattern{}, err
+	}
+
+	return Pattern{re: re}, nil
+}
+
+// Match returns true if text matches the Pattern.
+func (p Pattern) Match(text string) bool {
+	if p.re != nil {
+		return p.re.MatchString(text)
+	}
+
+	return strings.Contains(strings.ToLower(text), p.keyword)
+}
+
+func matchAny(patterns []Pattern, item *riverjs.Item) bool {
+	for _, pattern := range patterns {
+		if pattern.Match(item.Title) || pattern.Match(item.Body) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Include returns a Filter that only keeps items with a title or body that
+// match one of the patterns.
+func Include(patterns ...Pattern) Filter {
+	return func(item *riverjs.Item) *riverjs.Item {
+		if matchAny(patterns, item) {
+			return item
+		}
+		return nil
+	}
+}
+
+// Exclude returns a Filter that drops items with a title or body that match
+// one of the patterns.
+func Exclude(patterns ...Pattern) Filter {
+	return func(item *riverjs.Item) *riverjs.Item {
+		if matchAny(patterns, item) {
+			return nil
+		}
+		return item
+	}
+}
+
+// RewriteTitle returns a Filter that replaces matches of re in titles with
+// replacement, which can refer to submatches as in regexp.Regexp.ReplaceAllString.
+func RewriteTitle(re *regexp.Regexp, replacement string) Filter {
+	return func(item *riverjs.Item) *riverjs.Item {
+		item.Title = strings.TrimSpace(re.ReplaceAllString(item.Title, replacement))
+		return item
+	}
+}
+
+// DefaultTrackingParams are query parameters commonly added to links to track
+// where a visit came from.
+var DefaultTrackingParams = []string{
+	"utm_*",
+	"fbclid",
+	"gclid",
+	"mc_cid",
+	"mc_eid",
+	"_hsenc",
+	"_hsmi",
+}
+
+// StripParams returns a Filter that removes the query parameters named from the
+// links of items. A name ending in "*" removes every parameter that starts
+// with the rest of the name.
+func StripParams(names ...string) Filter {
+	return func(item *riverjs.Item) *riverjs.Item {
+		item.Link = stripParams(item.Link, names)
+		item.PermaLink = stripParams(item.PermaLink, names)
+		return item
+	}
+}
+
+func stripParams(link string, names []string) string {
+	u, err := url.Parse(link)
+	if err != nil || u.RawQuery == "" {
+		return link
+	}
+
+	query := u.Query()
+	changed := false
+	for key := range query {
+		for _, name := range names {
+			if key == name || (strings.HasSuffix(name, "*") && strings.HasPrefix(key, strings.TrimSuffix(name, "*"))) {
+				query.Del(key)
+				changed = true
+				break
+			}
+		}
+	}
+
+	if !changed {
+		return link
+	}
+
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// MaxAge returns a Filter that drops items published longer ago than age.
+func MaxAge(age time.Duration) Filter {
+	return func(item *riverjs.Item) *riverjs.Item {
+		if time.Since(item.PubDate.Time) > age {
+			return nil
+		}
+		return item
+	}
+}
@@ -0,0 +1,110 @@
+package mapping
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"hawx.me/code/riviera/feed/common"
+	"hawx.me/code/riviera/river/riverjs"
+)
+
+func TestChain(t *testing.T) {
+	var called []string
+	filter := func(name string, keep bool) Filter {
+		return func(item *riverjs.Item) *riverjs.Item {
+			called = append(called, name)
+			if !keep {
+				return nil
+			}
+			return item
+		}
+	}
+
+	m := Chain(DefaultMapping, filter("a", true), filter("b", false), filter("c", true))
+
+	assert.Nil(t, m(&common.Item{Title: "hey"}))
+	assert.Equal(t, []string{"a", "b"}, called)
+
+	called = nil
+	m = Chain(DefaultMapping, filter("a", true), filter("c", true))
+
+	if assert.NotNil(t, m(&common.Item{Title: "hey"})) {
+		assert.Equal(t, []string{"a", "c"}, called)
+	}
+}
+
+func TestPattern(t *testing.T) {
+	testcases := []struct {
+		pattern string
+		text    string
+		match   bool
+	}{
+		{"golang", "All about GoLang", true},
+		{"golang", "All about Go", false},
+		{"/Go(lang)?$/", "All about Go", true},
+		{"/golang/", "All about GoLang", false},
+		{"/golang/i", "All about GoLang", true},
+		{"/usr/bin", "see /usr/bin/env", true},
+		{"/", "a/b", true},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.pattern, func(t *testing.T) {
+			pattern, err := ParsePattern(tc.pattern)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.match, pattern.Match(tc.text))
+		})
+	}
+
+	_, err := ParsePattern("/(/")
+	assert.NotNil(t, err)
+}
+
+func TestIncludeExclude(t *testing.T) {
+	golang, _ := ParsePattern("golang")
+	rust, _ := ParsePattern("/rust/i")
+
+	item := &riverjs.Item{Title: "News", Body: "Learning Rust this week"}
+
+	assert.Nil(t, Include(golang)(item))
+	assert.Equal(t, item, Include(golang, rust)(item))
+
+	assert.Equal(t, item, Exclude(golang)(item))
+	assert.Nil(t, Exclude(golang, rust)(item))
+}
+
+func TestRewriteTitle(t *testing.T) {
+	filter := RewriteTitle(regexp.MustCompile(`^\[(\w+)\] (.*)$`), "$2 ($1)")
+
+	item := filter(&riverjs.Item{Title: "[Sponsor] Buy things"})
+
+	assert.Equal(t, "Buy things (Sponsor)", item.Title)
+}
+
+func TestStripParams(t *testing.T) {
+	filter := StripParams(DefaultTrackingParams...)
+
+	item := filter(&riverjs.Item{
+		Link:      "http://example.com/post?id=5&utm_source=rss&utm_medium=feed#top",
+		PermaLink: "http://example.com/post?fbclid=abc",
+	})
+
+	assert.Equal(t, "http://example.com/post?id=5#top", item.Link)
+	assert.Equal(t, "http://example.com/post", item.PermaLink)
+
+	item = filter(&riverjs.Item{Link: "http://example.com/post?b=2&a=1"})
+
+	assert.Equal(t, "http://example.com/post?b=2&a=1", item.Link)
+}
+
+func TestMaxAge(t *testing.T) {
+	filter := MaxAge(48 * time.Hour)
+
+	recent := &riverjs.Item{PubDate: riverjs.Time(time.Now().Add(-time.Hour))}
+	old := &riverjs.Item{PubDate: riverjs.Time(time.Now().Add(-72 * time.Hour))}
+
+	assert.Equal(t, recent, filter(recent))
+	assert.Nil(t, filter(old))
+}
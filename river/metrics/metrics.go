@@ -0,0 +1,422 @@
+// Package metrics records measurements of the river, and serves them in the
+// Prometheus text format.
+//
+// See https://prometheus.io/docs/instrumenting/exposition_formats/ for details
+// of the format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A Registry holds a set of metrics, each with a distinct name, so that they
+// can be served together.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]metric
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{metrics: map[string]metric{}}
+}
+
+type metric interface {
+	write(w io.Writer)
+}
+
+// register adds m to the Registry, it panics if a metric with the name has
+// already been registered.
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.metrics[name]; exists {
+		panic("metrics: " + name + " is already registered")
+	}
+	r.metrics[name] = m
+}
+
+// Handler serves the current value of every metric in the Registry.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		r.Write(w)
+	})
+}
+
+// Write writes the current value of every metric in the Registry to w, ordered
+// by name.
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	metrics := make([]metric, len(names))
+	for i, name := range names {
+		metrics[i] = r.metrics[name]
+	}
+	r.mu.Unlock()
+
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+// River holds the metrics recorded for a river.
+type River struct {
+	Fetches          *Counter
+	FetchDuration    *Histogram
+	Extractions      *Counter
+	Items            *Counter
+	Tributaries      *Gauge
+	EventWait        *Histogram
+	TruncateDuration *Histogram
+}
+
+// NewRiver registers the metrics for a river with r.
+func NewRiver(r *Registry) *River {
+	return &River{
+		Fetches: r.NewCounter("riviera_fetches_total",
+			"Number of feeds fetched, by the status of the result.", "status"),
+
+		FetchDuration: r.NewHistogram("riviera_fetch_duration_seconds",
+			"Time taken to fetch and read a feed.", DefaultBuckets),
+
+		Extractions: r.NewCounter("riviera_extractions_total",
+			"Number of pages fetched to extract articles from, by the status of the result.", "status"),
+
+		Items: r.NewCounter("riviera_items_total",
+			"Number of new items read, by feed.", "feed"),
+
+		Tributaries: r.NewGauge("riviera_tributaries",
+			"Number of feeds being fetched."),
+
+		EventWait: r.NewHistogram("riviera_event_wait_seconds",
+			"Time events waited to be received once sent, which grows as the river falls behind.", WaitBuckets),
+
+		TruncateDuration: r.NewHistogram("riviera_truncate_duration_seconds",
+			"Time taken to remove old data, by store.", DefaultBuckets, "store"),
+	}
+}
+
+// DefaultBuckets are the upper bounds, in seconds, of the buckets used for
+// durations.
+var DefaultBuckets = []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+// WaitBuckets are the upper bounds, in seconds, of the buckets used for waits
+// that are usually too short for DefaultBuckets.
+var WaitBuckets = []float64{.001, .01, .1, 1, 10, 60}
+
+// family holds the parts shared by each kind of metric. Each set of label
+// values is kept as a series, keyed by the values joined together.
+type family struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+	mu     sync.Mutex
+	keys   []string
+}
+
+func (f *family) key(values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+
+	return strings.Join(values, "\xff")
+}
+
+// add records that the key has been seen, it must be called with mu held.
+func (f *family) add(key string) {
+	i := sort.SearchStrings(f.keys, key)
+	if i < len(f.keys) && f.keys[i] == key {
+		return
+	}
+
+	f.keys = append(f.keys, "")
+	copy(f.keys[i+1:], f.keys[i:])
+	f.keys[i] = key
+}
+
+// remove forgets the key, it must be called with mu held.
+func (f *family) remove(key string) {
+	i := sort.SearchStrings(f.keys, key)
+	if i < len(f.keys) && f.keys[i] == key {
+		f.keys = append(f.keys[:i], f.keys[i+1:]...)
+	}
+}
+
+func (f *family) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+}
+
+// series formats the name of the series with key, along with any extra labels
+// given as name-value pairs.
+func (f *family) series(suffix, key string, extra ...string) string {
+	var values []string
+	if len(f.labels) > 0 {
+		values = strings.Split(key, "\xff")
+	}
+
+	var pairs []string
+	for i, label := range f.labels {
+		pairs = append(pairs, label+`="`+escape(values[i])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+escape(extra[i+1])+`"`)
+	}
+
+	if len(pairs) == 0 {
+		return f.name + suffix
+	}
+	return f.name + suffix + "{" + strings.Join(pairs, ",") + "}"
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// A Counter is a value that only goes up, such as the number of requests made.
+type Counter struct {
+	family
+	values map[string]float64
+}
+
+// NewCounter registers and returns a Counter with the labels given.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{
+		family: family{name: name, help: help, kind: "counter", labels: labels},
+		values: map[string]float64{},
+	}
+
+	r.register(name, c)
+	return c
+}
+
+// Inc adds one to the Counter for the label values.
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds v, which must not be negative, to the Counter for the label values.
+func (c *Counter) Add(v float64, values ...string) {
+	if v < 0 {
+		panic("metrics: counter can not decrease")
+	}
+
+	key := c.key(values)
+
+	c.mu.Lock()
+	c.add(key)
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+// Delete removes the Counter for the label values, so that it is no longer
+// written.
+func (c *Counter) Delete(values ...string) {
+	key := c.key(values)
+
+	c.mu.Lock()
+	c.remove(key)
+	delete(c.values, key)
+	c.mu.Unlock()
+}
+
+// Value returns the value of the Counter for the label values.
+func (c *Counter) Value(values ...string) float64 {
+	key := c.key(values)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[key]
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.header(w)
+	for _, key := range c.keys {
+		fmt.Fprintf(w, "%s %s\n", c.series("", key), formatFloat(c.values[key]))
+	}
+}
+
+// A Gauge is a value that can go up and down, such as the size of a queue. The
+// value can either be set, or read from a function when written.
+type Gauge struct {
+	family
+	funcs map[string]func() float64
+}
+
+// NewGauge registers and returns a Gauge with the labels given.
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{
+		family: family{name: name, help: help, kind: "gauge", labels: labels},
+		funcs:  map[string]func() float64{},
+	}
+
+	r.register(name, g)
+	return g
+}
+
+// Set sets the Gauge to v for the label values.
+func (g *Gauge) Set(v float64, values ...string) {
+	g.SetFunc(func() float64 { return v }, values...)
+}
+
+// SetFunc causes the Gauge for the label values to take the value returned by
+// fn, which is called each time the Gauge is read.
+func (g *Gauge) SetFunc(fn func() float64, values ...string) {
+	key := g.key(values)
+
+	g.mu.Lock()
+	g.add(key)
+	g.funcs[key] = fn
+	g.mu.Unlock()
+}
+
+// Delete removes the Gauge for the label values, so that it is no longer
+// written and any function given to SetFunc is released.
+func (g *Gauge) Delete(values ...string) {
+	key := g.key(values)
+
+	g.mu.Lock()
+	g.remove(key)
+	delete(g.funcs, key)
+	g.mu.Unlock()
+}
+
+// Value returns the value of the Gauge for the label values.
+func (g *Gauge) Value(values ...string) float64 {
+	key := g.key(values)
+
+	g.mu.Lock()
+	fn, ok := g.funcs[key]
+	g.mu.Unlock()
+
+	if !ok {
+		return 0
+	}
+	return fn()
+}
+
+func (g *Gauge) write(w io.Writer) {
+	g.mu.Lock()
+	keys := append([]string{}, g.keys...)
+	funcs := make([]func() float64, len(keys))
+	for i, key := range keys {
+		funcs[i] = g.funcs[key]
+	}
+	g.mu.Unlock()
+
+	// the functions may take locks of their own, so are called without holding
+	// mu
+	g.header(w)
+	for i, key := range keys {
+		fmt.Fprintf(w, "%s %s\n", g.series("", key), formatFloat(funcs[i]()))
+	}
+}
+
+// A Histogram counts observed values, such as durations, in buckets.
+type Histogram struct {
+	family
+	buckets []float64
+	values  map[string]*histogramValue
+}
+
+type histogramValue struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram registers and returns a Histogram that counts values in buckets
+// with the upper bounds given, in increasing order, with the labels given.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		family:  family{name: name, help: help, kind: "histogram", labels: labels},
+		buckets: buckets,
+		values:  map[string]*histogramValue{},
+	}
+
+	r.register(name, h)
+	return h
+}
+
+// Observe adds v to the Histogram for the label values.
+func (h *Histogram) Observe(v float64, values ...string) {
+	key := h.key(values)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	value, ok := h.values[key]
+	if !ok {
+		h.add(key)
+		value = &histogramValue{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = value
+	}
+
+	for i, bound := range h.buckets {
+		if v <= bound {
+			value.counts[i]++
+		}
+	}
+	value.count++
+	value.sum += v
+}
+
+// Count returns the number of values observed for the label values.
+func (h *Histogram) Count(values ...string) uint64 {
+	key := h.key(values)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if value, ok := h.values[key]; ok {
+		return value.count
+	}
+	return 0
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.header(w)
+	for _, key := range h.keys {
+		value := h.values[key]
+
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s %d\n", h.series("_bucket", key, "le", formatFloat(bound)), value.counts[i])
+		}
+		fmt.Fprintf(w, "%s %d\n", h.series("_bucket", key, "le", "+Inf"), value.count)
+		fmt.Fprintf(w, "%s %s\n", h.series("_sum", key), formatFloat(value.sum))
+		fmt.Fprintf(w, "%s %d\n", h.series("_count", key), value.count)
+	}
+}
@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounter(t *testing.T) {
+	c := NewRegistry().NewCounter("test_counter_total", "A counter.", "status")
+	c.Inc("ok")
+	c.Add(2, "ok")
+	c.Inc(`a "quoted"` + "\n")
+
+	assert.Equal(t, float64(3), c.Value("ok"))
+	assert.Equal(t, float64(0), c.Value("error"))
+
+	var buf bytes.Buffer
+	c.write(&buf)
+	assert.Equal(t, `# HELP test_counter_total A counter.
+# TYPE test_counter_total counter
+test_counter_total{status="a \"quoted\"\n"} 1
+test_counter_total{status="ok"} 3
+`, buf.String())
+
+	assert.Panics(t, func() { c.Inc() })
+	assert.Panics(t, func() { c.Add(-1, "ok") })
+
+	c.Delete("ok")
+	assert.Equal(t, float64(0), c.Value("ok"))
+
+	buf.Reset()
+	c.write(&buf)
+	assert.Equal(t, `# HELP test_counter_total A counter.
+# TYPE test_counter_total counter
+test_counter_total{status="a \"quoted\"\n"} 1
+`, buf.String())
+}
+
+func TestGauge(t *testing.T) {
+	g := NewRegistry().NewGauge("test_gauge", "A gauge.")
+
+	var buf bytes.Buffer
+	g.write(&buf)
+	assert.Equal(t, "# HELP test_gauge A gauge.\n# TYPE test_gauge gauge\n", buf.String())
+
+	g.Set(2.5)
+	assert.Equal(t, 2.5, g.Value())
+
+	n := 0
+	g.SetFunc(func() float64 { n++; return float64(n) })
+	assert.Equal(t, float64(1), g.Value())
+
+	buf.Reset()
+	g.write(&buf)
+	assert.Equal(t, "# HELP test_gauge A gauge.\n# TYPE test_gauge gauge\ntest_gauge 2\n", buf.String())
+
+	g.Delete()
+	assert.Equal(t, float64(0), g.Value())
+
+	buf.Reset()
+	g.write(&buf)
+	assert.Equal(t, "# HELP test_gauge A gauge.\n# TYPE test_gauge gauge\n", buf.String())
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewRegistry().NewHistogram("test_seconds", "A histogram.", []float64{1, 5}, "store")
+	h.Observe(0.5, "a")
+	h.Observe(3, "a")
+	h.Observe(10, "a")
+
+	assert.Equal(t, uint64(3), h.Count("a"))
+	assert.Equal(t, uint64(0), h.Count("b"))
+
+	var buf bytes.Buffer
+	h.write(&buf)
+	assert.Equal(t, `# HELP test_seconds A histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{store="a",le="1"} 1
+test_seconds_bucket{store="a",le="5"} 2
+test_seconds_bucket{store="a",le="+Inf"} 3
+test_seconds_sum{store="a"} 13.5
+test_seconds_count{store="a"} 3
+`, buf.String())
+}
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	river := NewRiver(registry)
+	registry.NewGauge("riviera_database_bytes", "Size of the database.").Set(1024)
+
+	river.Fetches.Inc("ok")
+
+	rec := httptest.NewRecorder()
+	registry.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, "text/plain; version=0.0.4", rec.Header().Get("Content-Type"))
+
+	body := rec.Body.String()
+	assert.True(t, strings.Contains(body, "# TYPE riviera_fetches_total counter\n"))
+	assert.True(t, strings.Contains(body, `riviera_fetches_total{status="ok"} `))
+	assert.True(t, strings.Index(body, "riviera_database_bytes") < strings.Index(body, "riviera_fetches_total"))
+
+	// a river's metrics can only be registered once
+	assert.Panics(t, func() { NewRiver(registry) })
+	assert.NotPanics(t, func() { NewRiver(NewRegistry()) })
+}
@@ -3,7 +3,12 @@ package river
 import (
 	"time"
 
+	"hawx.me/code/riviera/river/archive"
+	"hawx.me/code/riviera/river/cloud"
+	"hawx.me/code/riviera/river/extract"
 	"hawx.me/code/riviera/river/mapping"
+	"hawx.me/code/riviera/river/metrics"
+	"hawx.me/code/riviera/river/websub"
 )
 
 // Options change the behaviour of River.
@@ -12,17 +17,70 @@ type Options struct {
 	// river.
 	Mapping mapping.Mapping
 
+	// FeedMapping, if given, returns the Mapping to use for the feed at uri in
+	// place of Mapping, so that items can be treated differently for each feed.
+	FeedMapping func(uri string) mapping.Mapping
+
+	// Dedup, if given, returns true for the feeds, by the URI they are subscribed
+	// at, whose items are merged with the same story posted in other feeds, so
+	// that it is shown once in the river listing where else it was posted.
+	Dedup func(uri string) bool
+
 	// CutOff is the duration after which items are not shown in the river. This
 	// is given as a negative time and is calculated from the time the feed was
 	// fetched not the time the item was published.
 	CutOff time.Duration
 
-	// Refresh is the minimum refresh period. If an rss feed does not specify
-	// when to be fetched this duration will be used.
+	// Refresh is the minimum refresh period. Feeds are fetched more or less
+	// often than this depending on how often they change, but never more often.
 	Refresh time.Duration
 
+	// Concurrency is the maximum number of feeds fetched at once, see
+	// scheduler.DefaultOptions for the default.
+	Concurrency int
+
+	// MoveAfter is the number of fetches in a row that a feed must be permanently
+	// redirected to the same location before it is treated as having moved.
+	MoveAfter int
+
+	// Moved, if given, is called before the river follows a feed from one
+	// location to another, so that the subscription can be changed to match. If
+	// it returns an error the feed is not moved.
+	Moved func(from, to string) error
+
+	// DeadAfter is how long a feed must fail for, without success, before it is
+	// treated as dead and no longer fetched. Feeds that respond 410 Gone are
+	// treated as dead immediately.
+	DeadAfter time.Duration
+
+	// Died, if given, is called when a feed is found to be dead, so that the
+	// subscription can be marked to match.
+	Died func(uri string)
+
 	// LogLength defines the number of events to keep in the crawl log, per feed.
 	LogLength int
+
+	// WebSub, if given, is used to subscribe to feeds that advertise a hub so
+	// that updates are pushed instead of polled for. The Subscriber must be
+	// served at the callback it was created with.
+	WebSub *websub.Subscriber
+
+	// Cloud, if given, is used to register with the rssCloud of feeds that
+	// specify one so that they are fetched as soon as they change. The Subscriber
+	// must be served at the callback it was created with.
+	Cloud *cloud.Subscriber
+
+	// Metrics, if given, is the registry that measurements of the river, such as
+	// the number of fetches, are recorded in.
+	Metrics *metrics.Registry
+
+	// Extractor, if given, fetches the page linked to by each new item of the
+	// feeds it is enabled for, and keeps the article found as its content.
+	Extractor *extract.Extractor
+
+	// Archive, if given, keeps every item read so that the history of each feed
+	// can be browsed.
+	Archive archive.Database
 }
 
 // DefaultOptions are some sensible options to start out with.
@@ -30,5 +88,7 @@ var DefaultOptions = Options{
 	Mapping:   mapping.DefaultMapping,
 	CutOff:    -24 * time.Hour,
 	Refresh:   15 * time.Minute,
+	MoveAfter: 3,
+	DeadAfter: 7 * 24 * time.Hour,
 	LogLength: 0,
 }
@@ -0,0 +1,33 @@
+// Package readstate defines a store for which items in the river have been
+// read.
+package readstate
+
+import "time"
+
+// A Database records the items that have been read, along with a high-water
+// mark for the last time the river was looked at.
+type Database interface {
+	// MarkRead records each item, identified by Key, as read.
+	MarkRead(keys ...string)
+
+	// Read returns true if the item has been marked as read.
+	Read(key string) bool
+
+	// Mark returns the high-water mark, or the zero time if it has never been
+	// set.
+	Mark() time.Time
+
+	// SetMark moves the high-water mark to t. The mark never moves backwards, so
+	// a t before the current mark is ignored.
+	SetMark(t time.Time)
+
+	// Truncate forgets items that were marked as read before the cutoff, given as
+	// a negative duration from now, when they will no longer be in the river.
+	Truncate(cutoff time.Duration)
+}
+
+// Key returns the identifier used for the item with itemID in the feed at
+// feedURL.
+func Key(feedURL, itemID string) string {
+	return feedURL + " " + itemID
+}
@@ -4,31 +4,77 @@
 package river
 
 import (
+	"log"
 	"time"
 
+	"hawx.me/code/riviera/river/cloud"
 	"hawx.me/code/riviera/river/confluence"
 	"hawx.me/code/riviera/river/data"
 	"hawx.me/code/riviera/river/events"
+	"hawx.me/code/riviera/river/extract"
 	"hawx.me/code/riviera/river/mapping"
+	"hawx.me/code/riviera/river/metrics"
+	"hawx.me/code/riviera/river/readstate"
 	"hawx.me/code/riviera/river/riverjs"
+	"hawx.me/code/riviera/river/scheduler"
+	"hawx.me/code/riviera/river/search"
 	"hawx.me/code/riviera/river/tributary"
+	"hawx.me/code/riviera/river/websub"
 )
 
 const docsPath = "http://scripting.com/stories/2010/12/06/innovationRiverOfNewsInJso.html"
 
 // A River aggregates feeds that it is subscribed to, and writes them in riverjs format.
 type River interface {
+	// Latest returns the current river.
 	Latest() (riverjs.River, error)
 
+	// Filter returns the current river with only the blocks from the feeds that
+	// include returns true for, given the URI they are subscribed at.
+	Filter(include func(uri string) bool) (riverjs.River, error)
+
 	// Log returns a list of fetch events.
 	Log() []events.Event
 
+	// Search returns past items that match the query.
+	Search(query search.Query) []search.Result
+
+	// Archive returns a page of archived items for the feed, see
+	// archive.Database for details.
+	Archive(feedURL, before string, limit int) (feed riverjs.Feed, next string, ok bool)
+
+	// MarkRead records the items, identified by readstate.Key, as read.
+	MarkRead(keys ...string)
+
+	// Read returns true if the item, identified by readstate.Key, has been read.
+	Read(key string) bool
+
+	// Mark returns the high-water mark, the time the river was last looked at.
+	Mark() time.Time
+
+	// SetMark moves the high-water mark forward to t.
+	SetMark(t time.Time)
+
 	// Add subscribes the river to the feed at uri.
 	Add(uri string)
 
 	// Remove unsubscribes the river from the feed at url.
 	Remove(uri string)
 
+	// Health returns a summary of the fetch events of each feed.
+	Health() []events.Health
+
+	// Pause stops the feed at uri from being fetched, until Resume is called or
+	// the river is restarted.
+	Pause(uri string)
+
+	// Resume fetches the feed at uri again after it was paused.
+	Resume(uri string)
+
+	// Revive fetches the feed at uri again after it was found to be dead, or
+	// subscribes to it if the river was started without it.
+	Revive(uri string)
+
 	// Close gracefully stops feeds from being checked.
 	Close() error
 }
@@ -38,8 +84,16 @@ type River interface {
 type river struct {
 	confluence   confluence.Confluence
 	store        data.Database
+	read         readstate.Database
+	scheduler    *scheduler.Scheduler
 	cacheTimeout time.Duration
+	moveAfter    int
+	moved        func(from, to string) error
 	mapping      mapping.Mapping
+	feedMapping  func(uri string) mapping.Mapping
+	websub       *websub.Subscriber
+	cloud        *cloud.Subscriber
+	extractor    *extract.Extractor
 }
 
 // New creates an empty river.
@@ -53,19 +107,62 @@ func New(store data.Database, options Options) River {
 	if options.Refresh == 0 {
 		options.Refresh = DefaultOptions.Refresh
 	}
+	if options.MoveAfter == 0 {
+		options.MoveAfter = DefaultOptions.MoveAfter
+	}
+	if options.DeadAfter == 0 {
+		options.DeadAfter = DefaultOptions.DeadAfter
+	}
 
 	confluenceStore, _ := store.Confluence()
-	return &river{
-		confluence:   confluence.New(confluenceStore, options.CutOff, options.LogLength),
-		store:        store,
+	searchStore, _ := store.Search()
+	readStore, _ := store.ReadState()
+
+	var m *metrics.River
+	if options.Metrics != nil {
+		m = metrics.NewRiver(options.Metrics)
+	}
+
+	go func() {
+		for _ = range time.Tick(-options.CutOff) {
+			start := time.Now()
+			readStore.Truncate(options.CutOff)
+			if m != nil {
+				m.TruncateDuration.Observe(time.Since(start).Seconds(), "readstate")
+			}
+		}
+	}()
+
+	r := &river{
+		store: store,
+		read:  readStore,
+		scheduler: scheduler.New(scheduler.Options{
+			MinInterval: options.Refresh,
+			Concurrency: options.Concurrency,
+			Jitter:      0.1,
+			Spread:      time.Minute,
+		}),
 		cacheTimeout: options.Refresh,
+		moveAfter:    options.MoveAfter,
+		moved:        options.Moved,
 		mapping:      options.Mapping,
+		feedMapping:  options.FeedMapping,
+		websub:       options.WebSub,
+		cloud:        options.Cloud,
+		extractor:    options.Extractor,
 	}
+	r.confluence = confluence.New(confluenceStore, searchStore, options.Archive, options.CutOff, options.LogLength, options.DeadAfter, options.Died, r.move, options.Dedup, m)
+
+	return r
 }
 
 func (r *river) Latest() (riverjs.River, error) {
+	return r.Filter(nil)
+}
+
+func (r *river) Filter(include func(uri string) bool) (riverjs.River, error) {
 	updatedFeeds := riverjs.Feeds{
-		UpdatedFeeds: r.confluence.Latest(),
+		UpdatedFeeds: r.confluence.Filter(include),
 	}
 
 	now := time.Now()
@@ -85,7 +182,13 @@ func (r *river) Latest() (riverjs.River, error) {
 
 func (r *river) Add(uri string) {
 	feedStore, _ := r.store.Feed(uri)
-	tributary := tributary.New(feedStore, uri, r.cacheTimeout, r.mapping)
+
+	mapping := r.mapping
+	if r.feedMapping != nil {
+		mapping = r.feedMapping(uri)
+	}
+
+	tributary := tributary.New(feedStore, uri, r.cacheTimeout, r.moveAfter, mapping, r.scheduler, r.websub, r.cloud, r.extractor)
 	r.confluence.Add(tributary)
 
 	tributary.Start()
@@ -95,11 +198,72 @@ func (r *river) Remove(uri string) {
 	r.confluence.Remove(uri)
 }
 
+// move replaces the feed at from with the feed at to, keeping the items and
+// state already known.
+func (r *river) move(from, to string) {
+	if r.moved != nil {
+		if err := r.moved(from, to); err != nil {
+			log.Printf("could not move %s to %s: %s\n", from, to, err)
+			return
+		}
+	}
+
+	log.Printf("%s has moved to %s\n", from, to)
+	r.confluence.Remove(from)
+	if err := r.store.MoveFeed(from, to); err != nil {
+		log.Printf("error moving %s to %s: %s\n", from, to, err)
+	}
+	r.Add(to)
+}
+
+func (r *river) Health() []events.Health {
+	return r.confluence.Health()
+}
+
+func (r *river) Pause(uri string) {
+	r.confluence.Pause(uri)
+}
+
+func (r *river) Resume(uri string) {
+	r.confluence.Resume(uri)
+}
+
+func (r *river) Revive(uri string) {
+	if !r.confluence.Revive(uri) {
+		r.Add(uri)
+	}
+}
+
 func (r *river) Log() []events.Event {
 	return r.confluence.Log()
 }
 
+func (r *river) Search(query search.Query) []search.Result {
+	return r.confluence.Search(query)
+}
+
+func (r *river) Archive(feedURL, before string, limit int) (riverjs.Feed, string, bool) {
+	return r.confluence.Archive(feedURL, before, limit)
+}
+
+func (r *river) MarkRead(keys ...string) {
+	r.read.MarkRead(keys...)
+}
+
+func (r *river) Read(key string) bool {
+	return r.read.Read(key)
+}
+
+func (r *river) Mark() time.Time {
+	return r.read.Mark()
+}
+
+func (r *river) SetMark(t time.Time) {
+	r.read.SetMark(t)
+}
+
 func (r *river) Close() error {
 	r.confluence.Close()
+	r.scheduler.Close()
 	return nil
 }
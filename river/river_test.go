@@ -1,14 +1,26 @@
 package river
 
 import (
-	"bytes"
 	"encoding/json"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"hawx.me/code/riviera/river/archive"
+	"hawx.me/code/riviera/river/data"
+	"hawx.me/code/riviera/river/data/boltdata"
 	"hawx.me/code/riviera/river/data/memdata"
+	"hawx.me/code/riviera/river/events"
+	"hawx.me/code/riviera/river/readstate"
 	"hawx.me/code/riviera/river/riverjs"
+	"hawx.me/code/riviera/subscriptions"
 )
 
 func TestRiver(t *testing.T) {
@@ -16,11 +28,11 @@ func TestRiver(t *testing.T) {
 
 	r := New(db, Options{})
 
-	var buf bytes.Buffer
-	r.Encode(&buf)
+	latest, _ := r.Latest()
+	raw, _ := json.Marshal(latest)
 
 	var v riverjs.River
-	json.Unmarshal(buf.Bytes(), &v)
+	json.Unmarshal(raw, &v)
 
 	assert := assert.New(t)
 
@@ -32,3 +44,349 @@ func TestRiver(t *testing.T) {
 
 	assert.Equal(riverjs.Feeds{UpdatedFeeds: []riverjs.Feed{}}, v.UpdatedFeeds)
 }
+
+func TestRiverjsHandler(t *testing.T) {
+	r := New(memdata.Open(), Options{})
+	handler := Riverjs(r)
+
+	assert := assert.New(t)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/river", nil))
+	assert.Equal("application/json", rec.Header().Get("Content-Type"))
+
+	var v riverjs.River
+	assert.Nil(json.Unmarshal(rec.Body.Bytes(), &v))
+	assert.Equal("3", v.Metadata.Version)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/river.js", nil))
+	assert.Equal("application/javascript", rec.Header().Get("Content-Type"))
+
+	body := rec.Body.String()
+	assert.True(strings.HasPrefix(body, "onGetRiverStream({"))
+	assert.True(strings.HasSuffix(body, "})"))
+}
+
+func TestFeedHandlerWithoutArchive(t *testing.T) {
+	r := New(memdata.Open(), Options{})
+
+	rec := httptest.NewRecorder()
+	Feed(r, nil).ServeHTTP(rec, httptest.NewRequest("GET", "/feed/http://example.com/feed", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestFeedHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "riviera-river-test")
+	defer os.RemoveAll(dir)
+
+	store, _ := boltdata.Open(dir + "/test.db")
+	defer store.Close()
+
+	items, _ := store.(data.Archiver).Archive(archive.Retention{})
+	items.Add(riverjs.Feed{FeedURL: "http://example.com/feed", Items: []riverjs.Item{{ID: "1"}}})
+
+	r := New(store, Options{Archive: items})
+	templates := template.Must(template.New("feed.gotmpl").Parse(`{{.Feed.FeedURL}}`))
+
+	mux := http.NewServeMux()
+	mux.Handle("/feed/", Feed(r, templates))
+
+	// the mux redirects, as the path is cleaned
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/feed/http://example.com/feed", nil))
+	assert.Equal(http.StatusMovedPermanently, rec.Code)
+
+	location := rec.Header().Get("Location")
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", location, nil))
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Equal("http://example.com/feed", rec.Body.String())
+}
+
+func TestListAndReadHandlers(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "riviera-river-test")
+	defer os.RemoveAll(dir)
+
+	store, _ := boltdata.Open(dir + "/test.db")
+	defer store.Close()
+
+	now := time.Now().Round(time.Second)
+	blocks, _ := store.Confluence()
+	blocks.Add(riverjs.Feed{FeedURL: "http://cool", WhenLastUpdate: riverjs.Time(now.Add(-time.Minute)), Items: []riverjs.Item{
+		{ID: "1"}, {ID: "2"},
+	}})
+	blocks.Add(riverjs.Feed{URI: "http://other", FeedURL: "http://what", WhenLastUpdate: riverjs.Time(now), Items: []riverjs.Item{
+		{ID: "3"},
+	}})
+
+	// the feed at http://other gives http://what as its own URL, but the
+	// subscription has not been updated with it
+	subs := subscriptions.New()
+	subs.Refresh(subscriptions.Subscription{URI: "http://cool"})
+	subs.Refresh(subscriptions.Subscription{URI: "http://other", Folder: "Work/Go"})
+
+	r := New(store, Options{})
+	templates := template.Must(template.New("list.gotmpl").Parse(
+		`{{range .Feeds}}{{range .Items}}{{.ID}}{{if .Read}}r{{end}} {{end}}{{end}}`))
+
+	list := func(query string) string {
+		rec := httptest.NewRecorder()
+		List(r, subs, templates).ServeHTTP(rec, httptest.NewRequest("GET", "/"+query, nil))
+		return rec.Body.String()
+	}
+
+	assert.True(r.Mark().IsZero())
+	assert.Equal("3 1 2 ", list("?new=1"))
+	assert.True(now.Equal(r.Mark()))
+	assert.Equal("", list("?new=1"))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/read", strings.NewReader(url.Values{
+		"item": {readstate.Key("http://cool", "2")},
+	}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	Read(r).ServeHTTP(rec, req)
+	assert.Equal(http.StatusSeeOther, rec.Code)
+
+	assert.Equal("3 1 2r ", list(""))
+	assert.Equal("3 1 ", list("?unread=1"))
+
+	req = httptest.NewRequest("POST", "/read", strings.NewReader("all=1"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	Read(r).ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal("", list("?unread=1"))
+	assert.Equal("3r ", list("?folder=Work"))
+	assert.Equal("3r ", list("?folder=Work/Go"))
+	assert.Equal("", list("?folder=Play"))
+}
+
+func TestPodcastsHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "riviera-river-test")
+	defer os.RemoveAll(dir)
+
+	store, _ := boltdata.Open(dir + "/test.db")
+	defer store.Close()
+
+	now := time.Now().Round(time.Second)
+	mp3 := []riverjs.Enclosure{{URL: "http://cool/ep.mp3", Type: "audio/mpeg"}}
+
+	blocks, _ := store.Confluence()
+	blocks.Add(riverjs.Feed{FeedURL: "http://cool", WhenLastUpdate: riverjs.Time(now), Items: []riverjs.Item{
+		{ID: "1", PubDate: riverjs.Time(now.Add(-2 * time.Hour)), Enclosures: mp3},
+		{ID: "2", PubDate: riverjs.Time(now)},
+	}})
+	blocks.Add(riverjs.Feed{FeedURL: "http://what", WhenLastUpdate: riverjs.Time(now.Add(-time.Minute)), Items: []riverjs.Item{
+		{ID: "3", PubDate: riverjs.Time(now.Add(-time.Hour)), Podcast: &riverjs.Podcast{Duration: 3723},
+			Enclosures: []riverjs.Enclosure{{URL: "http://what/ep.m4v", Type: "video/mp4"}}},
+	}})
+
+	subs := subscriptions.New()
+	subs.Refresh(subscriptions.Subscription{URI: "http://cool"})
+	subs.Refresh(subscriptions.Subscription{URI: "http://what", Folder: "Talk"})
+
+	r := New(store, Options{})
+	templates := template.Must(template.New("podcasts.gotmpl").Parse(
+		`{{range .Episodes}}{{.ID}}:{{.Audio.URL}}:{{.Podcast.FormattedDuration}} {{end}}`))
+
+	podcasts := func(query string) string {
+		rec := httptest.NewRecorder()
+		Podcasts(r, subs, templates).ServeHTTP(rec, httptest.NewRequest("GET", "/podcasts"+query, nil))
+		return rec.Body.String()
+	}
+
+	assert.Equal("3:http://what/ep.m4v:1:02:03 1:http://cool/ep.mp3: ", podcasts(""))
+	assert.Equal("3:http://what/ep.m4v:1:02:03 ", podcasts("?folder=Talk"))
+}
+
+func TestSyndicateHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "riviera-river-test")
+	defer os.RemoveAll(dir)
+
+	store, _ := boltdata.Open(dir + "/test.db")
+	defer store.Close()
+
+	now := time.Now().Round(time.Second)
+	blocks, _ := store.Confluence()
+	blocks.Add(riverjs.Feed{FeedURL: "http://cool", WhenLastUpdate: riverjs.Time(now.Add(-time.Minute)), Items: []riverjs.Item{
+		{ID: "1", Title: "one"},
+	}})
+	blocks.Add(riverjs.Feed{FeedURL: "http://what", WhenLastUpdate: riverjs.Time(now), Items: []riverjs.Item{
+		{ID: "2", Title: "two"},
+	}})
+
+	subs := subscriptions.New()
+	subs.Refresh(subscriptions.Subscription{URI: "http://cool", Folder: "Work"})
+	subs.Refresh(subscriptions.Subscription{URI: "http://what"})
+
+	r := New(store, Options{})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		Syndicate(r, subs).ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		return rec
+	}
+
+	rec := get("/river.atom")
+	assert.Equal("application/atom+xml", rec.Header().Get("Content-Type"))
+	assert.Contains(rec.Body.String(), `<id>http://example.com/river.atom</id>`)
+	assert.Contains(rec.Body.String(), `<title>two</title>`)
+	assert.Contains(rec.Body.String(), `<title>one</title>`)
+
+	rec = get("/river.rss?folder=Work")
+	assert.Equal("application/rss+xml", rec.Header().Get("Content-Type"))
+	assert.Contains(rec.Body.String(), `<title>Riviera: Work</title>`)
+	assert.Contains(rec.Body.String(), `<link>http://example.com/?folder=Work</link>`)
+	assert.Contains(rec.Body.String(), `<title>one</title>`)
+	assert.NotContains(rec.Body.String(), `<title>two</title>`)
+
+	rec = get("/river.feed.json")
+	assert.Equal("application/feed+json", rec.Header().Get("Content-Type"))
+
+	var doc struct {
+		Items []struct {
+			ID string `json:"id"`
+		} `json:"items"`
+	}
+	assert.Nil(json.Unmarshal(rec.Body.Bytes(), &doc))
+	assert.Len(doc.Items, 2)
+
+	assert.Equal(http.StatusNotFound, get("/river.xml").Code)
+}
+
+type logRiver struct {
+	River
+	evs []events.Event
+}
+
+func (r logRiver) Log() []events.Event {
+	return r.evs
+}
+
+func TestLogHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	r := logRiver{evs: []events.Event{
+		{URI: "http://a", Code: 200, At: now},
+		{URI: "http://b", Code: -1, Error: "timeout", At: now},
+		{URI: "http://a", Code: 404, At: now.Add(-48 * time.Hour)},
+	}}
+	templates := template.Must(template.New("log.gotmpl").Parse(
+		`{{range .Days}}{{.Header}}:{{range .Items}} {{.URI}} {{.Status}}{{end}};{{end}}`))
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		Log(r, templates).ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		return rec
+	}
+
+	today := now.Format("Monday, 2 January 2006")
+	before := now.Add(-48 * time.Hour).Format("Monday, 2 January 2006")
+
+	assert.Equal(today+": http://a ok http://b fault;"+before+": http://a error;", get("/log").Body.String())
+	assert.Equal(today+": http://a ok;"+before+": http://a error;", get("/log?feed=http://a").Body.String())
+	assert.Equal(today+": http://b fault;", get("/log?status=fault").Body.String())
+	assert.Equal(before+": http://a error;", get("/log?until="+now.Add(-24*time.Hour).Format("2006-01-02")).Body.String())
+
+	rec := get("/log.json?status=error")
+	assert.Equal("application/json", rec.Header().Get("Content-Type"))
+
+	var evs []events.Event
+	assert.Nil(json.Unmarshal(rec.Body.Bytes(), &evs))
+	if assert.Len(evs, 1) {
+		assert.Equal(404, evs[0].Code)
+	}
+}
+
+type feedsRiver struct {
+	River
+	health  []events.Health
+	paused  []string
+	revived []string
+}
+
+func (r *feedsRiver) Health() []events.Health { return r.health }
+func (r *feedsRiver) Pause(uri string)        { r.paused = append(r.paused, uri) }
+func (r *feedsRiver) Revive(uri string)       { r.revived = append(r.revived, uri) }
+
+func TestFeedsHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	r := &feedsRiver{health: []events.Health{
+		{URI: "http://a", LastSuccess: now, ItemsPerDay: 2},
+		{URI: "http://b", LastSuccess: now.Add(-time.Hour), Failures: 3, ItemsPerDay: 5},
+	}}
+
+	subs := subscriptions.New()
+	subs.Refresh(subscriptions.Subscription{URI: "http://a", FeedTitle: "Bee"})
+	subs.Refresh(subscriptions.Subscription{URI: "http://b", FeedTitle: "apple"})
+	subs.Refresh(subscriptions.Subscription{URI: "http://c", FeedTitle: "Cat"})
+
+	templates := template.Must(template.New("feeds.gotmpl").Parse(
+		`{{range .Feeds}}{{.Sub.URI}}:{{.Health.Failures}} {{end}}`))
+
+	get := func(query string) string {
+		rec := httptest.NewRecorder()
+		Feeds(r, subs, nil, templates).ServeHTTP(rec, httptest.NewRequest("GET", "/feeds"+query, nil))
+		return rec.Body.String()
+	}
+
+	assert.Equal("http://b:3 http://a:0 http://c:0 ", get(""))
+	assert.Equal("http://c:0 http://a:0 http://b:3 ", get("?sort=title&desc=1"))
+	assert.Equal("http://a:0 http://c:0 http://b:3 ", get("?sort=failures"))
+	assert.Equal("http://b:3 http://a:0 http://c:0 ", get("?sort=items&desc=1"))
+	assert.Equal("http://c:0 http://b:3 http://a:0 ", get("?sort=success"))
+
+	post := func(form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/feeds", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		Feeds(r, subs, nil, templates).ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := post(url.Values{"url": {"http://b"}, "action": {"pause"}})
+	assert.Equal(http.StatusSeeOther, rec.Code)
+	assert.Equal("/feeds", rec.Header().Get("Location"))
+	assert.Equal([]string{"http://b"}, r.paused)
+
+	rec = post(url.Values{"url": {"http://b"}, "action": {"remove"}})
+	assert.Equal(http.StatusMethodNotAllowed, rec.Code)
+
+	rec = post(url.Values{"url": {"http://c"}, "action": {"revive"}})
+	assert.Equal(http.StatusSeeOther, rec.Code)
+	assert.Equal([]string{"http://c"}, r.revived)
+}
+
+func TestFeedsHandlerReviveCommentedOut(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "riviera-river-test")
+	defer os.RemoveAll(dir)
+
+	r := &feedsRiver{}
+	subs := subscriptions.New()
+	subs.Refresh(subscriptions.Subscription{URI: "http://a", Dead: true})
+	editor := subscriptions.NewEditor(subs, r, dir+"/feeds.opml")
+
+	req := httptest.NewRequest("POST", "/feeds", strings.NewReader("action=revive&url=http://a"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	Feeds(r, subs, editor, nil).ServeHTTP(rec, req)
+
+	assert.Equal(http.StatusSeeOther, rec.Code)
+	assert.Equal([]string{"http://a"}, r.revived)
+	sub, _ := subs.Get("http://a")
+	assert.False(sub.Dead)
+}
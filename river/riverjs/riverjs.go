@@ -4,6 +4,8 @@
 package riverjs
 
 import (
+	"fmt"
+	"html/template"
 	"strings"
 )
 
@@ -29,6 +31,20 @@ type Feed struct {
 	FeedDescription string  `json:"feedDescription"`
 	WhenLastUpdate  RssTime `json:"whenLastUpdate"`
 	Items           []Item  `json:"item"`
+
+	// URI is the address the feed is subscribed at, FeedURL may differ if the
+	// feed gives its own. It is not part of riverjs.
+	URI string `json:"uri,omitempty"`
+}
+
+// SubscriptionURI returns the address the feed is subscribed at. Blocks stored
+// before URI was recorded only have their FeedURL.
+func (f Feed) SubscriptionURI() string {
+	if f.URI != "" {
+		return f.URI
+	}
+
+	return f.FeedURL
 }
 
 type Item struct {
@@ -59,6 +75,26 @@ type Item struct {
 	// Thumbnail has three sub-elements, url that points to the full image, and
 	// width and height which give the size of the thumbnail.
 	Thumbnail *Thumbnail `json:"thumbnail,omitempty"`
+
+	// Podcast is given when the item is an episode of a podcast. It is not part
+	// of riverjs.
+	Podcast *Podcast `json:"podcast,omitempty"`
+
+	// Content is the full content of the item as sanitized HTML, when the river
+	// has been asked to keep it. It is not part of riverjs.
+	Content string `json:"content,omitempty"`
+
+	// AlsoIn lists the other feeds that posted the same story, when duplicates
+	// are merged. It is not part of riverjs.
+	AlsoIn []Source `json:"alsoIn,omitempty"`
+}
+
+// A Source is a feed that an item was also posted in.
+type Source struct {
+	FeedURL    string `json:"feedUrl"`
+	WebsiteURL string `json:"websiteUrl"`
+	FeedTitle  string `json:"feedTitle"`
+	Link       string `json:"link"`
 }
 
 type Enclosure struct {
@@ -73,6 +109,35 @@ type Thumbnail struct {
 	Width  *int   `json:"width,omitempty"`
 }
 
+type Podcast struct {
+	// Duration is the length of the episode in seconds, or 0 if not known.
+	Duration int `json:"duration,omitempty"`
+
+	// Image points to the artwork for the episode.
+	Image string `json:"image,omitempty"`
+
+	// Episode is the number of the episode, or 0 if not known.
+	Episode int `json:"episode,omitempty"`
+
+	// Chapters points to the chapters of the episode, as in Podcasting 2.0.
+	Chapters *Chapters `json:"chapters,omitempty"`
+
+	// Transcripts point to transcripts of the episode, as in Podcasting 2.0.
+	Transcripts []Transcript `json:"transcripts,omitempty"`
+}
+
+type Chapters struct {
+	URL  string `json:"url"`
+	Type string `json:"type"`
+}
+
+type Transcript struct {
+	URL      string `json:"url"`
+	Type     string `json:"type"`
+	Language string `json:"language,omitempty"`
+	Rel      string `json:"rel,omitempty"`
+}
+
 type Metadata struct {
 	// Docs is a link to a web page that documents the format.
 	Docs string `json:"docs"`
@@ -90,6 +155,45 @@ type Metadata struct {
 	Secs float64 `json:"secs,string"`
 }
 
+// Audio returns the enclosure to play for the item, the first that is audio, or
+// if the item is a podcast episode its first enclosure. If there is none it
+// returns nil.
+func (r Item) Audio() *Enclosure {
+	for i, enclosure := range r.Enclosures {
+		if strings.HasPrefix(enclosure.Type, "audio/") {
+			return &r.Enclosures[i]
+		}
+	}
+
+	if r.Podcast != nil && len(r.Enclosures) > 0 {
+		return &r.Enclosures[0]
+	}
+
+	return nil
+}
+
+// FormattedDuration returns the duration of the episode as "H:MM:SS", or
+// "M:SS" when under an hour. It returns an empty string if the duration is not
+// known.
+func (p *Podcast) FormattedDuration() string {
+	if p == nil || p.Duration <= 0 {
+		return ""
+	}
+
+	hours, minutes, seconds := p.Duration/3600, p.Duration/60%60, p.Duration%60
+	if hours > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", hours, minutes, seconds)
+	}
+
+	return fmt.Sprintf("%d:%02d", minutes, seconds)
+}
+
+// ContentHTML returns the Content of the item for use in a template. It must
+// only be used when the Content has been sanitized.
+func (r Item) ContentHTML() template.HTML {
+	return template.HTML(r.Content)
+}
+
 func (r Item) FilteredBody() string {
 	r.Body = strings.TrimSpace(r.Body)
 
@@ -0,0 +1,273 @@
+// Package safehtml cleans HTML taken from feeds so that it can be shown within
+// a page of the river.
+//
+// Only an allow-list of elements and attributes are kept. Elements that could
+// run code or embed other pages, such as <script> or <iframe>, are removed along
+// with their contents, while other unknown elements are removed leaving their
+// text. Links are resolved against the address of the item they came from, and
+// only http, https and mailto links are kept.
+package safehtml
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// allowed lists the elements that are kept, with the attributes kept for each.
+var allowed = map[atom.Atom][]string{
+	atom.A:          {"href", "title"},
+	atom.Abbr:       {"title"},
+	atom.Audio:      {"src", "controls"},
+	atom.B:          nil,
+	atom.Blockquote: {"cite"},
+	atom.Br:         nil,
+	atom.Caption:    nil,
+	atom.Cite:       nil,
+	atom.Code:       nil,
+	atom.Dd:         nil,
+	atom.Del:        nil,
+	atom.Details:    nil,
+	atom.Dfn:        nil,
+	atom.Div:        nil,
+	atom.Dl:         nil,
+	atom.Dt:         nil,
+	atom.Em:         nil,
+	atom.Figcaption: nil,
+	atom.Figure:     nil,
+	atom.H1:         nil,
+	atom.H2:         nil,
+	atom.H3:         nil,
+	atom.H4:         nil,
+	atom.H5:         nil,
+	atom.H6:         nil,
+	atom.Hr:         nil,
+	atom.I:          nil,
+	atom.Img:        {"src", "alt", "title", "width", "height"},
+	atom.Ins:        nil,
+	atom.Kbd:        nil,
+	atom.Li:         nil,
+	atom.Mark:       nil,
+	atom.Ol:         {"start"},
+	atom.P:          nil,
+	atom.Picture:    nil,
+	atom.Pre:        nil,
+	atom.Q:          {"cite"},
+	atom.S:          nil,
+	atom.Samp:       nil,
+	atom.Small:      nil,
+	atom.Source:     {"src", "type"},
+	atom.Span:       nil,
+	atom.Strong:     nil,
+	atom.Sub:        nil,
+	atom.Summary:    nil,
+	atom.Sup:        nil,
+	atom.Table:      nil,
+	atom.Tbody:      nil,
+	atom.Td:         {"colspan", "rowspan"},
+	atom.Tfoot:      nil,
+	atom.Th:         {"colspan", "rowspan"},
+	atom.Thead:      nil,
+	atom.Time:       {"datetime"},
+	atom.Tr:         nil,
+	atom.U:          nil,
+	atom.Ul:         nil,
+	atom.Video:      {"src", "controls", "poster", "width", "height"},
+}
+
+// removed lists the elements that are dropped along with everything in them.
+var removed = map[atom.Atom]bool{
+	atom.Button:   true,
+	atom.Embed:    true,
+	atom.Form:     true,
+	atom.Frame:    true,
+	atom.Frameset: true,
+	atom.Head:     true,
+	atom.Iframe:   true,
+	atom.Input:    true,
+	atom.Math:     true,
+	atom.Noscript: true,
+	atom.Object:   true,
+	atom.Script:   true,
+	atom.Select:   true,
+	atom.Style:    true,
+	atom.Svg:      true,
+	atom.Template: true,
+	atom.Textarea: true,
+	atom.Title:    true,
+}
+
+// urlAttrs are the attributes that hold addresses.
+var urlAttrs = map[string]bool{
+	"href":   true,
+	"src":    true,
+	"cite":   true,
+	"poster": true,
+}
+
+// Sanitize returns content with everything but the allowed elements and
+// attributes removed, and addresses resolved against base. If base is nil
+// relative addresses are removed.
+func Sanitize(content string, base *url.URL) string {
+	var (
+		buf  bytes.Buffer
+		open []atom.Atom
+
+		// skipping is the element being removed, and depth the number of those
+		// elements open
+		skipping atom.Atom
+		depth    int
+	)
+
+	z := html.NewTokenizer(strings.NewReader(content))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+
+		token := z.Token()
+
+		if depth > 0 {
+			switch {
+			case tt == html.StartTagToken && token.DataAtom == skipping:
+				depth++
+			case tt == html.EndTagToken && token.DataAtom == skipping:
+				depth--
+			}
+			continue
+		}
+
+		switch tt {
+		case html.TextToken:
+			buf.WriteString(html.EscapeString(token.Data))
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if removed[token.DataAtom] {
+				if tt == html.StartTagToken {
+					skipping = token.DataAtom
+					depth = 1
+				}
+				continue
+			}
+
+			attrs, ok := allowed[token.DataAtom]
+			if !ok {
+				continue
+			}
+
+			token.Attr = cleanAttrs(token.Attr, attrs, base)
+			if token.DataAtom == atom.A && hasAttr(token.Attr, "href") {
+				token.Attr = append(token.Attr, html.Attribute{Key: "rel", Val: "noopener noreferrer"})
+			}
+
+			if isVoid(token.DataAtom) {
+				token.Type = html.SelfClosingTagToken
+			} else {
+				token.Type = html.StartTagToken
+				open = append(open, token.DataAtom)
+			}
+			buf.WriteString(token.String())
+
+		case html.EndTagToken:
+			// only close elements that were opened, so that the content can not
+			// close elements of the page it is shown in
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] == token.DataAtom {
+					for _, a := range reverse(open[i:]) {
+						buf.WriteString("</" + a.String() + ">")
+					}
+					open = open[:i]
+					break
+				}
+			}
+		}
+	}
+
+	for _, a := range reverse(open) {
+		buf.WriteString("</" + a.String() + ">")
+	}
+
+	return strings.TrimSpace(buf.String())
+}
+
+func cleanAttrs(attrs []html.Attribute, keep []string, base *url.URL) []html.Attribute {
+	var cleaned []html.Attribute
+
+	for _, attr := range attrs {
+		if attr.Namespace != "" || !contains(keep, attr.Key) {
+			continue
+		}
+
+		if urlAttrs[attr.Key] {
+			resolved, ok := resolve(attr.Val, base)
+			if !ok {
+				continue
+			}
+			attr.Val = resolved
+		}
+
+		cleaned = append(cleaned, attr)
+	}
+
+	return cleaned
+}
+
+// resolve returns the address given by ref, resolved against base, if it is
+// an address that can be linked to safely.
+func resolve(ref string, base *url.URL) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return "", false
+	}
+
+	if !u.IsAbs() {
+		if base == nil {
+			return "", false
+		}
+		u = base.ResolveReference(u)
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "mailto":
+		return u.String(), true
+	}
+
+	return "", false
+}
+
+func isVoid(a atom.Atom) bool {
+	return a == atom.Br || a == atom.Hr || a == atom.Img || a == atom.Source
+}
+
+func hasAttr(attrs []html.Attribute, key string) bool {
+	for _, attr := range attrs {
+		if attr.Key == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func reverse(list []atom.Atom) []atom.Atom {
+	reversed := make([]atom.Atom, len(list))
+	for i, a := range list {
+		reversed[len(list)-1-i] = a
+	}
+
+	return reversed
+}
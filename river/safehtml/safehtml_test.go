@@ -0,0 +1,96 @@
+package safehtml
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitize(t *testing.T) {
+	base, _ := url.Parse("http://example.com/posts/1")
+
+	testcases := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{
+			"allowed elements",
+			`<p>Hello <strong>there</strong>, <em>friend</em></p>`,
+			`<p>Hello <strong>there</strong>, <em>friend</em></p>`,
+		},
+		{
+			"text escaped",
+			`<p>1 &lt; 2 &amp; "3"</p>`,
+			`<p>1 &lt; 2 &amp; &#34;3&#34;</p>`,
+		},
+		{
+			"scripts removed",
+			`<p>Hi</p><script>alert("<p>no</p>")</script><style>p { color: red }</style>`,
+			`<p>Hi</p>`,
+		},
+		{
+			"iframes removed",
+			`<iframe src="http://evil.com"><p>fallback</p></iframe><p>After</p>`,
+			`<p>After</p>`,
+		},
+		{
+			"nested removed elements",
+			`<svg><svg><a href="/">x</a></svg><text>y</text></svg><p>After</p>`,
+			`<p>After</p>`,
+		},
+		{
+			"unknown elements unwrapped",
+			`<section><marquee>Look</marquee></section>`,
+			`Look`,
+		},
+		{
+			"attributes removed",
+			`<p class="x" style="color: red" onclick="alert(1)">Hi</p>`,
+			`<p>Hi</p>`,
+		},
+		{
+			"relative links resolved",
+			`<a href="../2">Next</a> <img src="/img.png" alt="pic">`,
+			`<a href="http://example.com/2" rel="noopener noreferrer">Next</a> <img src="http://example.com/img.png" alt="pic"/>`,
+		},
+		{
+			"unsafe links removed",
+			`<a href="javascript:alert(1)">Click</a><img src="data:image/png;base64,AAAA">`,
+			`<a>Click</a><img/>`,
+		},
+		{
+			"mailto kept",
+			`<a href="mailto:me@example.com">Mail</a>`,
+			`<a href="mailto:me@example.com" rel="noopener noreferrer">Mail</a>`,
+		},
+		{
+			"unclosed elements closed",
+			`<div><p>Open <b>bold`,
+			`<div><p>Open <b>bold</b></p></div>`,
+		},
+		{
+			"stray end tags removed",
+			`</li></ul><p>Hi</div></p>`,
+			`<p>Hi</p>`,
+		},
+		{
+			"comments removed",
+			`<p>Hi<!-- secret --></p>`,
+			`<p>Hi</p>`,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, Sanitize(tc.content, base))
+		})
+	}
+}
+
+func TestSanitizeWithoutBase(t *testing.T) {
+	assert.Equal(t,
+		`<a>Next</a> <a href="http://example.com/" rel="noopener noreferrer">Home</a>`,
+		Sanitize(`<a href="/next">Next</a> <a href="http://example.com/">Home</a>`, nil))
+}
@@ -0,0 +1,404 @@
+// Package scheduler decides when each feed should next be fetched, so that
+// feeds are polled about as often as they change and only a few at a time.
+package scheduler
+
+import (
+	"container/heap"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A Result describes the outcome of fetching a feed.
+type Result struct {
+	// Code is the status code of the response, or -1 if no request was made.
+	Code int
+
+	// Err is the error encountered when fetching, if any.
+	Err error
+
+	// Changed is true if new items were found.
+	Changed bool
+
+	// Posted are the times the items in the feed were published, used to learn
+	// how often the feed is updated.
+	Posted []time.Time
+
+	// NotBefore, if set, is the earliest time the feed should be fetched again.
+	// For example when the server has sent Retry-After or Cache-Control headers.
+	NotBefore time.Time
+}
+
+// A FetchFunc fetches a feed, returning the Result.
+type FetchFunc func() Result
+
+// Options change the behaviour of a Scheduler.
+type Options struct {
+	// MinInterval is the shortest time to wait between fetches of a feed.
+	MinInterval time.Duration
+
+	// MaxInterval is the longest time to wait between fetches of a feed, however
+	// often it fails or is unchanged.
+	MaxInterval time.Duration
+
+	// Concurrency is the number of fetches that can run at once.
+	Concurrency int
+
+	// Jitter is the fraction of each interval that is randomly added or removed,
+	// so that feeds added at the same time drift apart.
+	Jitter float64
+
+	// Spread is the duration over which the first fetch of each added feed is
+	// randomly placed.
+	Spread time.Duration
+}
+
+// DefaultOptions are used for any Options that are not set, Jitter and Spread
+// default to none.
+var DefaultOptions = Options{
+	MinInterval: 15 * time.Minute,
+	MaxInterval: 6 * time.Hour,
+	Concurrency: 10,
+}
+
+// the number of published times used to estimate a feed's posting frequency
+const historyLength = 10
+
+type entry struct {
+	name  string
+	fetch FetchFunc
+	next  time.Time
+	index int
+
+	running bool
+	removed bool
+	woken   bool
+
+	// period is the estimated time between items being posted, or zero if not
+	// known.
+	period time.Duration
+
+	// failures and unchanged count the fetches since the feed last changed.
+	failures  int
+	unchanged int
+}
+
+// A Scheduler fetches feeds when they are due.
+type Scheduler struct {
+	options Options
+	mu      sync.Mutex
+	entries map[string]*entry
+	queue   queue
+	wake    chan struct{}
+	slots   chan struct{}
+	quit    chan struct{}
+}
+
+// New returns a running Scheduler.
+func New(options Options) *Scheduler {
+	if options.MinInterval <= 0 {
+		options.MinInterval = DefaultOptions.MinInterval
+	}
+	if options.MaxInterval < options.MinInterval {
+		options.MaxInterval = DefaultOptions.MaxInterval
+		if options.MaxInterval < options.MinInterval {
+			options.MaxInterval = options.MinInterval
+		}
+	}
+	if options.Concurrency <= 0 {
+		options.Concurrency = DefaultOptions.Concurrency
+	}
+
+	s := &Scheduler{
+		options: options,
+		entries: map[string]*entry{},
+		wake:    make(chan struct{}, 1),
+		slots:   make(chan struct{}, options.Concurrency),
+		quit:    make(chan struct{}),
+	}
+
+	go s.run()
+	return s
+}
+
+// Add schedules the named feed to be fetched by calling fetch. The first fetch
+// happens at the time given, or soon after. If the name has already been added
+// no action is taken.
+func (s *Scheduler) Add(name string, fetch FetchFunc, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.entries[name]; exists {
+		return
+	}
+
+	if s.options.Spread > 0 {
+		at = at.Add(time.Duration(rand.Int63n(int64(s.options.Spread))))
+	}
+
+	e := &entry{name: name, fetch: fetch, next: at}
+	s.entries[name] = e
+	heap.Push(&s.queue, e)
+	s.signal()
+}
+
+// Remove stops the named feed from being fetched. A fetch that is running is
+// allowed to finish.
+func (s *Scheduler) Remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, exists := s.entries[name]
+	if !exists {
+		return
+	}
+
+	e.removed = true
+	delete(s.entries, name)
+	if !e.running {
+		heap.Remove(&s.queue, e.index)
+	}
+	s.signal()
+}
+
+// Wake causes the named feed to be fetched as soon as possible.
+func (s *Scheduler) Wake(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, exists := s.entries[name]
+	if !exists {
+		return
+	}
+
+	if e.running {
+		e.woken = true
+		return
+	}
+
+	e.next = time.Now()
+	heap.Fix(&s.queue, e.index)
+	s.signal()
+}
+
+// Next returns the time the named feed is next due to be fetched.
+func (s *Scheduler) Next(name string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, exists := s.entries[name]
+	if !exists {
+		return time.Time{}, false
+	}
+
+	return e.next, true
+}
+
+// Close stops the Scheduler, fetches that are running are allowed to finish.
+func (s *Scheduler) Close() error {
+	s.quit <- struct{}{}
+	<-s.quit
+
+	return nil
+}
+
+func (s *Scheduler) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Scheduler) run() {
+	timer := time.NewTimer(time.Hour)
+
+	for {
+		s.mu.Lock()
+		wait := time.Hour
+		if len(s.queue) > 0 {
+			wait = time.Until(s.queue[0].next)
+		}
+
+		if wait <= 0 {
+			e := heap.Pop(&s.queue).(*entry)
+			e.running = true
+			s.mu.Unlock()
+
+			select {
+			case s.slots <- struct{}{}:
+				go s.fetch(e)
+				continue
+			case <-s.quit:
+				timer.Stop()
+				close(s.quit)
+				return
+			}
+		}
+		s.mu.Unlock()
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+
+		select {
+		case <-timer.C:
+		case <-s.wake:
+		case <-s.quit:
+			timer.Stop()
+			close(s.quit)
+			return
+		}
+	}
+}
+
+func (s *Scheduler) fetch(e *entry) {
+	// the feed may have been removed while waiting for a slot
+	s.mu.Lock()
+	removed := e.removed
+	s.mu.Unlock()
+
+	var result Result
+	if !removed {
+		result = e.fetch()
+	}
+	<-s.slots
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e.running = false
+	if e.removed {
+		return
+	}
+
+	now := time.Now()
+	e.next = s.schedule(e, result, now)
+	if e.woken {
+		e.woken = false
+		e.next = now
+	}
+
+	heap.Push(&s.queue, e)
+	s.signal()
+}
+
+// schedule updates what is known about the feed from the result of fetching it,
+// and returns when it should next be fetched.
+func (s *Scheduler) schedule(e *entry, result Result, now time.Time) time.Time {
+	if period, ok := estimatePeriod(result.Posted, now); ok {
+		e.period = period
+	}
+
+	switch {
+	case result.Err != nil || result.Code >= 400:
+		e.failures++
+	case result.Changed:
+		e.failures = 0
+		e.unchanged = 0
+	case result.Code != -1:
+		// a 304, or a 200 with nothing new
+		e.failures = 0
+		e.unchanged++
+	}
+
+	next := now.Add(s.jitter(s.interval(e)))
+	if result.NotBefore.After(next) {
+		next = result.NotBefore
+	}
+
+	return next
+}
+
+// interval returns the time to wait before fetching the feed again. Feeds are
+// polled twice in the time they are expected to take to post an item, doubling
+// the wait for each consecutive failure or unchanged fetch.
+func (s *Scheduler) interval(e *entry) time.Duration {
+	d := s.options.MinInterval
+	if e.period > 0 {
+		d = e.period / 2
+	}
+
+	backoff := e.unchanged
+	if e.failures > 0 {
+		backoff = e.failures
+	}
+
+	for i := 0; i < backoff && d < s.options.MaxInterval; i++ {
+		d *= 2
+	}
+
+	if d < s.options.MinInterval {
+		return s.options.MinInterval
+	}
+	if d > s.options.MaxInterval {
+		return s.options.MaxInterval
+	}
+	return d
+}
+
+func (s *Scheduler) jitter(d time.Duration) time.Duration {
+	if s.options.Jitter <= 0 {
+		return d
+	}
+
+	return d + time.Duration((rand.Float64()*2-1)*s.options.Jitter*float64(d))
+}
+
+// estimatePeriod returns the average time between the most recently published
+// items. Times that are zero or in the future are ignored.
+func estimatePeriod(posted []time.Time, now time.Time) (time.Duration, bool) {
+	var times []time.Time
+	for _, t := range posted {
+		if !t.IsZero() && !t.After(now) {
+			times = append(times, t)
+		}
+	}
+
+	if len(times) < 2 {
+		return 0, false
+	}
+
+	sort.Slice(times, func(i, j int) bool { return times[i].After(times[j]) })
+	if len(times) > historyLength {
+		times = times[:historyLength]
+	}
+
+	newest, oldest := times[0], times[len(times)-1]
+	if !newest.After(oldest) {
+		return 0, false
+	}
+
+	return newest.Sub(oldest) / time.Duration(len(times)-1), true
+}
+
+// queue is a heap of entries ordered by when they are next due.
+type queue []*entry
+
+func (q queue) Len() int           { return len(q) }
+func (q queue) Less(i, j int) bool { return q[i].next.Before(q[j].next) }
+
+func (q queue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *queue) Push(x interface{}) {
+	e := x.(*entry)
+	e.index = len(*q)
+	*q = append(*q, e)
+}
+
+func (q *queue) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	e.index = -1
+	*q = old[:len(old)-1]
+	return e
+}
@@ -0,0 +1,169 @@
+package scheduler
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedulerFetchesAdded(t *testing.T) {
+	s := New(Options{})
+	defer s.Close()
+
+	fetched := make(chan string, 2)
+	fetch := func(name string) FetchFunc {
+		return func() Result {
+			fetched <- name
+			return Result{Code: http.StatusOK}
+		}
+	}
+
+	s.Add("a", fetch("a"), time.Now())
+	s.Add("b", fetch("b"), time.Now().Add(50*time.Millisecond))
+
+	for _, expected := range []string{"a", "b"} {
+		select {
+		case name := <-fetched:
+			assert.Equal(t, expected, name)
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+	}
+
+	_, ok := s.Next("a")
+	assert.True(t, ok)
+	_, ok = s.Next("c")
+	assert.False(t, ok)
+}
+
+func TestSchedulerConcurrency(t *testing.T) {
+	s := New(Options{Concurrency: 2})
+	defer s.Close()
+
+	var (
+		mu       sync.Mutex
+		running  int
+		most     int
+		finished sync.WaitGroup
+	)
+
+	fetch := func() Result {
+		mu.Lock()
+		running++
+		if running > most {
+			most = running
+		}
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+
+		finished.Done()
+		return Result{Code: http.StatusOK}
+	}
+
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		finished.Add(1)
+		s.Add(name, fetch, time.Now())
+	}
+	finished.Wait()
+
+	assert.Equal(t, 2, most)
+}
+
+func TestSchedulerWakeAndRemove(t *testing.T) {
+	s := New(Options{})
+	defer s.Close()
+
+	fetched := make(chan struct{}, 1)
+	s.Add("a", func() Result {
+		fetched <- struct{}{}
+		return Result{Code: http.StatusOK}
+	}, time.Now().Add(time.Hour))
+
+	s.Wake("a")
+	select {
+	case <-fetched:
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+
+	s.Remove("a")
+	_, ok := s.Next("a")
+	assert.False(t, ok)
+
+	s.Wake("a")
+	select {
+	case <-fetched:
+		t.Fatal("fetched after removal")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	assert := assert.New(t)
+
+	s := &Scheduler{options: Options{MinInterval: 10 * time.Minute, MaxInterval: 4 * time.Hour}}
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// posting every two hours is polled every hour
+	e := &entry{}
+	next := s.schedule(e, Result{Code: http.StatusOK, Changed: true, Posted: []time.Time{
+		now.Add(-2 * time.Hour),
+		now.Add(-4 * time.Hour),
+		now.Add(-6 * time.Hour),
+		{},
+		now.Add(time.Hour),
+	}}, now)
+	assert.Equal(now.Add(time.Hour), next)
+
+	// unchanged fetches back off
+	next = s.schedule(e, Result{Code: http.StatusNotModified}, now)
+	assert.Equal(now.Add(2*time.Hour), next)
+	next = s.schedule(e, Result{Code: http.StatusOK}, now)
+	assert.Equal(now.Add(4*time.Hour), next)
+	next = s.schedule(e, Result{Code: http.StatusNotModified}, now)
+	assert.Equal(now.Add(4*time.Hour), next)
+
+	// but a change resets
+	next = s.schedule(e, Result{Code: http.StatusOK, Changed: true}, now)
+	assert.Equal(now.Add(time.Hour), next)
+
+	// as do failures, separately
+	next = s.schedule(e, Result{Code: -1, Err: errors.New("what")}, now)
+	assert.Equal(now.Add(2*time.Hour), next)
+	next = s.schedule(e, Result{Code: http.StatusInternalServerError}, now)
+	assert.Equal(now.Add(4*time.Hour), next)
+
+	// not fetching changes nothing
+	next = s.schedule(e, Result{Code: -1}, now)
+	assert.Equal(now.Add(4*time.Hour), next)
+
+	// frequent posters are still limited
+	e = &entry{}
+	next = s.schedule(e, Result{Code: http.StatusOK, Changed: true, Posted: []time.Time{
+		now.Add(-time.Minute),
+		now.Add(-2 * time.Minute),
+	}}, now)
+	assert.Equal(now.Add(10*time.Minute), next)
+
+	// and servers can ask for longer
+	next = s.schedule(e, Result{Code: http.StatusOK, NotBefore: now.Add(time.Hour)}, now)
+	assert.Equal(now.Add(time.Hour), next)
+}
+
+func TestJitter(t *testing.T) {
+	s := &Scheduler{options: Options{Jitter: 0.1}}
+
+	for i := 0; i < 100; i++ {
+		d := s.jitter(time.Hour)
+		assert.True(t, d >= 54*time.Minute && d <= 66*time.Minute, d)
+	}
+}
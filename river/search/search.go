@@ -0,0 +1,280 @@
+// Package search provides full-text search over the items that have appeared in
+// the river.
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"hawx.me/code/riviera/river/riverjs"
+)
+
+// A Database indexes items so that they can be searched for later.
+type Database interface {
+	// Add indexes each item in the feed block. Items that have already been
+	// indexed are ignored.
+	Add(feed riverjs.Feed)
+
+	// Search returns the items that match the query, most relevant first.
+	Search(query Query) []Result
+}
+
+// A Query describes the items to find.
+type Query struct {
+	// Terms must all appear in an item for it to match.
+	Terms []string
+
+	// Phrases must all appear, with their terms in order, in an item for it to
+	// match.
+	Phrases [][]string
+
+	// Feed, if given, limits results to those from feeds with a URL or title
+	// containing the value.
+	Feed string
+
+	// Since and Until, if not zero, limit results to items published within the
+	// range.
+	Since, Until time.Time
+
+	// Limit is the maximum number of results to return, if zero all results are
+	// returned.
+	Limit int
+}
+
+// ParseQuery reads a query string, where any terms surrounded by double quotes
+// are treated as a phrase.
+func ParseQuery(s string) Query {
+	var query Query
+
+	for i, part := range strings.Split(s, `"`) {
+		terms := Tokenize(part)
+		if len(terms) == 0 {
+			continue
+		}
+
+		if i%2 == 1 && len(terms) > 1 {
+			query.Phrases = append(query.Phrases, terms)
+		} else {
+			query.Terms = append(query.Terms, terms...)
+		}
+	}
+
+	return query
+}
+
+// Empty returns true if the query has no terms to search for.
+func (q Query) Empty() bool {
+	return len(q.Terms) == 0 && len(q.Phrases) == 0
+}
+
+// A Result is an item that matched a query.
+type Result struct {
+	FeedURL    string       `json:"feedUrl"`
+	WebsiteURL string       `json:"websiteUrl"`
+	FeedTitle  string       `json:"feedTitle"`
+	Item       riverjs.Item `json:"item"`
+	Score      float64      `json:"score"`
+}
+
+// A Document is an indexed item, along with details of the feed it came from.
+type Document struct {
+	ID         string       `json:"id"`
+	FeedURL    string       `json:"feedUrl"`
+	WebsiteURL string       `json:"websiteUrl"`
+	FeedTitle  string       `json:"feedTitle"`
+	Item       riverjs.Item `json:"item"`
+
+	// TitleLength is the number of terms in the title of the item, terms at
+	// positions below this are given more weight.
+	TitleLength int `json:"titleLength"`
+}
+
+// Documents splits a feed block into a Document per item, along with the
+// positions that each term appears at in the Document.
+func Documents(feed riverjs.Feed) ([]Document, []map[string][]int) {
+	docs := make([]Document, len(feed.Items))
+	terms := make([]map[string][]int, len(feed.Items))
+
+	for i, item := range feed.Items {
+		title := Tokenize(item.Title)
+		body := Tokenize(item.Body)
+
+		docs[i] = Document{
+			ID:          feed.FeedURL + " " + item.ID,
+			FeedURL:     feed.FeedURL,
+			WebsiteURL:  feed.WebsiteURL,
+			FeedTitle:   feed.FeedTitle,
+			Item:        item,
+			TitleLength: len(title),
+		}
+
+		positions := map[string][]int{}
+		for j, term := range title {
+			positions[term] = append(positions[term], j)
+		}
+		// leave a gap so that phrases can not span the title and body
+		for j, term := range body {
+			positions[term] = append(positions[term], len(title)+1+j)
+		}
+		terms[i] = positions
+	}
+
+	return docs, terms
+}
+
+// Tokenize splits text into lowercased terms.
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// An Index is the view of stored data that a Database must provide to run a
+// query with Run.
+type Index interface {
+	// Postings returns the positions that the term appears at, keyed by Document
+	// ID.
+	Postings(term string) map[string][]int
+
+	// Document returns the Document with the ID.
+	Document(id string) (Document, bool)
+
+	// Count returns the number of Documents.
+	Count() int
+}
+
+// Run finds the Documents in the index that match the query and ranks them.
+// Each matching Document is scored by the frequency of the query terms within
+// it, weighted by how rare the term is across all Documents, with terms in the
+// title counting double.
+func Run(index Index, query Query) []Result {
+	if query.Empty() {
+		return []Result{}
+	}
+
+	var terms []string
+	terms = append(terms, query.Terms...)
+	for _, phrase := range query.Phrases {
+		terms = append(terms, phrase...)
+	}
+
+	postings := map[string]map[string][]int{}
+	for _, term := range terms {
+		if _, ok := postings[term]; !ok {
+			postings[term] = index.Postings(term)
+		}
+	}
+
+	// candidates must contain every term
+	var candidates []string
+	for id := range postings[terms[0]] {
+		candidates = append(candidates, id)
+	}
+	for _, term := range terms[1:] {
+		var kept []string
+		for _, id := range candidates {
+			if _, ok := postings[term][id]; ok {
+				kept = append(kept, id)
+			}
+		}
+		candidates = kept
+	}
+
+	total := float64(index.Count())
+	results := []Result{}
+
+candidates:
+	for _, id := range candidates {
+		for _, phrase := range query.Phrases {
+			if !containsPhrase(postings, id, phrase) {
+				continue candidates
+			}
+		}
+
+		doc, ok := index.Document(id)
+		if !ok || !query.matches(doc) {
+			continue
+		}
+
+		score := 0.0
+		for _, term := range terms {
+			idf := math.Log(1 + total/float64(len(postings[term])))
+			for _, pos := range postings[term][id] {
+				if pos < doc.TitleLength {
+					score += 2 * idf
+				} else {
+					score += idf
+				}
+			}
+		}
+
+		results = append(results, Result{
+			FeedURL:    doc.FeedURL,
+			WebsiteURL: doc.WebsiteURL,
+			FeedTitle:  doc.FeedTitle,
+			Item:       doc.Item,
+			Score:      score,
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score == results[j].Score {
+			return results[i].Item.PubDate.After(results[j].Item.PubDate.Time)
+		}
+		return results[i].Score > results[j].Score
+	})
+
+	if query.Limit > 0 && len(results) > query.Limit {
+		results = results[:query.Limit]
+	}
+
+	return results
+}
+
+func (q Query) matches(doc Document) bool {
+	if q.Feed != "" {
+		feed := strings.ToLower(q.Feed)
+		if !strings.Contains(strings.ToLower(doc.FeedURL), feed) &&
+			!strings.Contains(strings.ToLower(doc.FeedTitle), feed) {
+			return false
+		}
+	}
+
+	if !q.Since.IsZero() && doc.Item.PubDate.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && doc.Item.PubDate.After(q.Until) {
+		return false
+	}
+
+	return true
+}
+
+func containsPhrase(postings map[string]map[string][]int, id string, phrase []string) bool {
+	for _, start := range postings[phrase[0]][id] {
+		found := true
+		for offset, term := range phrase[1:] {
+			if !containsInt(postings[term][id], start+offset+1) {
+				found = false
+				break
+			}
+		}
+		if found {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsInt(list []int, n int) bool {
+	for _, m := range list {
+		if m == n {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,21 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenize(t *testing.T) {
+	assert.Equal(t, []string{"hello", "world", "it", "s", "2020"}, Tokenize("Hello, World! It's 2020."))
+	assert.Equal(t, []string{}, append([]string{}, Tokenize(" -- ")...))
+}
+
+func TestParseQuery(t *testing.T) {
+	assert.Equal(t, Query{
+		Terms:   []string{"go", "lang", "single"},
+		Phrases: [][]string{{"fast", "compiler"}},
+	}, ParseQuery(`go "fast compiler" lang "single"`))
+
+	assert.True(t, ParseQuery(`  "" `).Empty())
+}
@@ -0,0 +1,328 @@
+// Package syndication writes a river as a feed, in the Atom, RSS or JSON Feed
+// formats, so that it can be read elsewhere.
+//
+// Each item in the river becomes an entry of the feed, noting the feed it came
+// from as its source.
+package syndication
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"time"
+
+	"hawx.me/code/riviera/river/riverjs"
+)
+
+// A Channel describes the feed being written.
+type Channel struct {
+	// Title is the name of the feed.
+	Title string
+
+	// Link is the address of the page the river can be read at.
+	Link string
+
+	// Self is the address the feed is served at.
+	Self string
+
+	// Updated is the time the river last changed.
+	Updated time.Time
+}
+
+type entry struct {
+	feed riverjs.Feed
+	item riverjs.Item
+}
+
+// entries flattens the feeds into their items, keeping the order of the river.
+func entries(feeds []riverjs.Feed) []entry {
+	var list []entry
+	for _, feed := range feeds {
+		for _, item := range feed.Items {
+			list = append(list, entry{feed: feed, item: item})
+		}
+	}
+
+	return list
+}
+
+// id returns a unique identifier for the entry, its permalink if it has one.
+func (e entry) id() string {
+	if e.item.PermaLink != "" {
+		return e.item.PermaLink
+	}
+
+	return e.feed.FeedURL + "#" + e.item.ID
+}
+
+// link returns the address of the entry.
+func (e entry) link() string {
+	if e.item.Link != "" {
+		return e.item.Link
+	}
+
+	return e.item.PermaLink
+}
+
+// published returns the time the entry was published, or if not known the time
+// it was read.
+func (e entry) published() time.Time {
+	if !e.item.PubDate.IsZero() {
+		return e.item.PubDate.Time
+	}
+
+	return e.feed.WhenLastUpdate.Time
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  atomPerson  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type atomLink struct {
+	Rel    string `xml:"rel,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+	Href   string `xml:"href,attr"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title     string     `xml:"title"`
+	ID        string     `xml:"id"`
+	Updated   string     `xml:"updated"`
+	Published string     `xml:"published"`
+	Links     []atomLink `xml:"link"`
+	Summary   string     `xml:"summary,omitempty"`
+	Source    atomSource `xml:"source"`
+}
+
+type atomSource struct {
+	Title   string     `xml:"title"`
+	ID      string     `xml:"id"`
+	Updated string     `xml:"updated"`
+	Links   []atomLink `xml:"link"`
+}
+
+// Atom writes the feeds as an Atom 1.0 document.
+//
+// See https://tools.ietf.org/html/rfc4287
+func Atom(w io.Writer, channel Channel, feeds []riverjs.Feed) error {
+	doc := atomFeed{
+		Title:   channel.Title,
+		ID:      channel.Self,
+		Updated: channel.Updated.UTC().Format(time.RFC3339),
+		Author:  atomPerson{Name: channel.Title, URI: channel.Link},
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: channel.Self},
+			{Rel: "alternate", Type: "text/html", Href: channel.Link},
+		},
+		Entries: []atomEntry{},
+	}
+
+	for _, e := range entries(feeds) {
+		entry := atomEntry{
+			Title:     e.item.Title,
+			ID:        e.id(),
+			Updated:   e.feed.WhenLastUpdate.UTC().Format(time.RFC3339),
+			Published: e.published().UTC().Format(time.RFC3339),
+			Summary:   e.item.Body,
+			Source: atomSource{
+				Title:   e.feed.FeedTitle,
+				ID:      e.feed.FeedURL,
+				Updated: e.feed.WhenLastUpdate.UTC().Format(time.RFC3339),
+				Links: []atomLink{
+					{Rel: "self", Href: e.feed.FeedURL},
+				},
+			},
+		}
+
+		if link := e.link(); link != "" {
+			entry.Links = append(entry.Links, atomLink{Rel: "alternate", Href: link})
+		}
+		for _, enclosure := range e.item.Enclosures {
+			entry.Links = append(entry.Links, atomLink{
+				Rel:    "enclosure",
+				Type:   enclosure.Type,
+				Href:   enclosure.URL,
+				Length: enclosure.Length,
+			})
+		}
+		if e.feed.WebsiteURL != "" {
+			entry.Source.Links = append(entry.Source.Links, atomLink{Rel: "alternate", Href: e.feed.WebsiteURL})
+		}
+
+		doc.Entries = append(doc.Entries, entry)
+	}
+
+	return writeXML(w, doc)
+}
+
+type rssDoc struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title,omitempty"`
+	Link        string        `xml:"link,omitempty"`
+	Description string        `xml:"description,omitempty"`
+	GUID        rssGUID       `xml:"guid"`
+	PubDate     string        `xml:"pubDate"`
+	Comments    string        `xml:"comments,omitempty"`
+	Enclosure   *rssEnclosure `xml:"enclosure"`
+	Source      rssSource     `xml:"source"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Length int64  `xml:"length,attr"`
+}
+
+type rssSource struct {
+	URL   string `xml:"url,attr"`
+	Value string `xml:",chardata"`
+}
+
+// RSS writes the feeds as an RSS 2.0 document. RSS only allows a single
+// enclosure for each item, so only the first is written.
+//
+// See https://www.rssboard.org/rss-specification
+func RSS(w io.Writer, channel Channel, feeds []riverjs.Feed) error {
+	doc := rssDoc{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         channel.Title,
+			Link:          channel.Link,
+			Description:   channel.Title,
+			LastBuildDate: channel.Updated.Format(time.RFC1123Z),
+		},
+	}
+
+	for _, e := range entries(feeds) {
+		item := rssItem{
+			Title:       e.item.Title,
+			Link:        e.link(),
+			Description: e.item.Body,
+			GUID:        rssGUID{IsPermaLink: e.item.PermaLink != "", Value: e.id()},
+			PubDate:     e.published().Format(time.RFC1123Z),
+			Comments:    e.item.Comments,
+			Source:      rssSource{URL: e.feed.FeedURL, Value: e.feed.FeedTitle},
+		}
+
+		if len(e.item.Enclosures) > 0 {
+			enclosure := e.item.Enclosures[0]
+			item.Enclosure = &rssEnclosure{URL: enclosure.URL, Type: enclosure.Type, Length: enclosure.Length}
+		}
+
+		doc.Channel.Items = append(doc.Channel.Items, item)
+	}
+
+	return writeXML(w, doc)
+}
+
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(v)
+}
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url,omitempty"`
+	FeedURL     string         `json:"feed_url,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string               `json:"id"`
+	URL           string               `json:"url,omitempty"`
+	Title         string               `json:"title,omitempty"`
+	ContentText   string               `json:"content_text"`
+	Image         string               `json:"image,omitempty"`
+	DatePublished string               `json:"date_published"`
+	Authors       []jsonFeedAuthor     `json:"authors,omitempty"`
+	Attachments   []jsonFeedAttachment `json:"attachments,omitempty"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url,omitempty"`
+}
+
+type jsonFeedAttachment struct {
+	URL         string `json:"url"`
+	MimeType    string `json:"mime_type"`
+	SizeInBytes int64  `json:"size_in_bytes,omitempty"`
+}
+
+// JSONFeed writes the feeds as a JSON Feed 1.1 document. The feed an item came
+// from is given as its author.
+//
+// See https://jsonfeed.org/version/1.1
+func JSONFeed(w io.Writer, channel Channel, feeds []riverjs.Feed) error {
+	doc := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       channel.Title,
+		HomePageURL: channel.Link,
+		FeedURL:     channel.Self,
+		Items:       []jsonFeedItem{},
+	}
+
+	for _, e := range entries(feeds) {
+		item := jsonFeedItem{
+			ID:            e.id(),
+			URL:           e.link(),
+			Title:         e.item.Title,
+			ContentText:   e.item.Body,
+			DatePublished: e.published().Format(time.RFC3339),
+			Authors: []jsonFeedAuthor{
+				{Name: e.feed.FeedTitle, URL: e.feed.WebsiteURL},
+			},
+		}
+
+		if e.item.Thumbnail != nil {
+			item.Image = e.item.Thumbnail.URL
+		}
+		for _, enclosure := range e.item.Enclosures {
+			item.Attachments = append(item.Attachments, jsonFeedAttachment{
+				URL:         enclosure.URL,
+				MimeType:    enclosure.Type,
+				SizeInBytes: enclosure.Length,
+			})
+		}
+
+		doc.Items = append(doc.Items, item)
+	}
+
+	return json.NewEncoder(w).Encode(doc)
+}
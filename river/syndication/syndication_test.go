@@ -0,0 +1,146 @@
+package syndication
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"hawx.me/code/riviera/river/riverjs"
+)
+
+var (
+	updated = time.Date(2020, 1, 2, 12, 0, 0, 0, time.UTC)
+	posted  = time.Date(2020, 1, 2, 9, 30, 0, 0, time.UTC)
+
+	channel = Channel{
+		Title:   "Riviera",
+		Link:    "http://localhost/",
+		Self:    "http://localhost/river.atom",
+		Updated: updated,
+	}
+
+	feeds = []riverjs.Feed{{
+		FeedURL:        "http://example.com/feed",
+		WebsiteURL:     "http://example.com/",
+		FeedTitle:      "Example",
+		WhenLastUpdate: riverjs.Time(updated),
+		Items: []riverjs.Item{{
+			Title:     "First",
+			Body:      "Hello & goodbye",
+			PermaLink: "http://example.com/1",
+			Link:      "http://example.com/1",
+			PubDate:   riverjs.Time(posted),
+			ID:        "1",
+			Enclosures: []riverjs.Enclosure{
+				{URL: "http://example.com/1.mp3", Type: "audio/mpeg", Length: 100},
+				{URL: "http://example.com/1.ogg", Type: "audio/ogg", Length: 90},
+			},
+		}, {
+			Title: "Second",
+			ID:    "2",
+		}},
+	}}
+)
+
+func TestAtom(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	assert.Nil(Atom(&buf, channel, feeds))
+
+	var doc atomFeed
+	assert.Nil(xml.Unmarshal(buf.Bytes(), &doc))
+
+	assert.Equal("Riviera", doc.Title)
+	assert.Equal("http://localhost/river.atom", doc.ID)
+	assert.Equal("2020-01-02T12:00:00Z", doc.Updated)
+
+	if assert.Len(doc.Entries, 2) {
+		first := doc.Entries[0]
+		assert.Equal("First", first.Title)
+		assert.Equal("http://example.com/1", first.ID)
+		assert.Equal("2020-01-02T09:30:00Z", first.Published)
+		assert.Equal("Hello & goodbye", first.Summary)
+		assert.Equal([]atomLink{
+			{Rel: "alternate", Href: "http://example.com/1"},
+			{Rel: "enclosure", Type: "audio/mpeg", Href: "http://example.com/1.mp3", Length: 100},
+			{Rel: "enclosure", Type: "audio/ogg", Href: "http://example.com/1.ogg", Length: 90},
+		}, first.Links)
+		assert.Equal("Example", first.Source.Title)
+		assert.Equal("http://example.com/feed", first.Source.ID)
+
+		second := doc.Entries[1]
+		assert.Equal("http://example.com/feed#2", second.ID)
+		assert.Equal("2020-01-02T12:00:00Z", second.Published)
+		assert.Empty(second.Links)
+	}
+}
+
+func TestRSS(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	assert.Nil(RSS(&buf, channel, feeds))
+
+	var doc rssDoc
+	assert.Nil(xml.Unmarshal(buf.Bytes(), &doc))
+
+	assert.Equal("2.0", doc.Version)
+	assert.Equal("http://localhost/", doc.Channel.Link)
+
+	if assert.Len(doc.Channel.Items, 2) {
+		first := doc.Channel.Items[0]
+		assert.Equal(rssGUID{IsPermaLink: true, Value: "http://example.com/1"}, first.GUID)
+		assert.Equal(posted.Format(time.RFC1123Z), first.PubDate)
+		assert.Equal(&rssEnclosure{URL: "http://example.com/1.mp3", Type: "audio/mpeg", Length: 100}, first.Enclosure)
+		assert.Equal(rssSource{URL: "http://example.com/feed", Value: "Example"}, first.Source)
+
+		second := doc.Channel.Items[1]
+		assert.Equal(rssGUID{IsPermaLink: false, Value: "http://example.com/feed#2"}, second.GUID)
+		assert.Nil(second.Enclosure)
+	}
+}
+
+func TestJSONFeed(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	assert.Nil(JSONFeed(&buf, channel, feeds))
+
+	var doc jsonFeed
+	assert.Nil(json.Unmarshal(buf.Bytes(), &doc))
+
+	assert.Equal("https://jsonfeed.org/version/1.1", doc.Version)
+	assert.Equal("http://localhost/river.atom", doc.FeedURL)
+
+	if assert.Len(doc.Items, 2) {
+		assert.Equal(jsonFeedItem{
+			ID:            "http://example.com/1",
+			URL:           "http://example.com/1",
+			Title:         "First",
+			ContentText:   "Hello & goodbye",
+			DatePublished: "2020-01-02T09:30:00Z",
+			Authors:       []jsonFeedAuthor{{Name: "Example", URL: "http://example.com/"}},
+			Attachments: []jsonFeedAttachment{
+				{URL: "http://example.com/1.mp3", MimeType: "audio/mpeg", SizeInBytes: 100},
+				{URL: "http://example.com/1.ogg", MimeType: "audio/ogg", SizeInBytes: 90},
+			},
+		}, doc.Items[0])
+	}
+
+	// content_text must be given, even when empty
+	assert.Contains(buf.String(), `"content_text":""`)
+}
+
+func TestEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	JSONFeed(&buf, channel, nil)
+	assert.Contains(t, buf.String(), `"items":[]`)
+
+	buf.Reset()
+	Atom(&buf, channel, nil)
+	assert.Contains(t, buf.String(), `<feed xmlns="http://www.w3.org/2005/Atom">`)
+}
@@ -2,17 +2,23 @@
 package tributary
 
 import (
+	"io"
 	"log"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
 	"golang.org/x/net/html/charset"
 	"hawx.me/code/riviera/feed"
 	"hawx.me/code/riviera/feed/common"
+	"hawx.me/code/riviera/river/cloud"
 	"hawx.me/code/riviera/river/events"
+	"hawx.me/code/riviera/river/extract"
 	"hawx.me/code/riviera/river/mapping"
 	"hawx.me/code/riviera/river/riverjs"
+	"hawx.me/code/riviera/river/scheduler"
+	"hawx.me/code/riviera/river/websub"
 )
 
 // A Tributary reports changes in a feed to the channels it is given.
@@ -41,19 +47,79 @@ type tributary struct {
 	mapping mapping.Mapping
 	feeds   chan<- riverjs.Feed
 	events  chan<- events.Event
-	quit    chan struct{}
+
+	// name is the URI the tributary was created with, it does not change when
+	// the feed moves so can be used to refer to the tributary.
+	name  string
+	sched *scheduler.Scheduler
+
+	// mu guards feed, as content can be pushed while it is being fetched.
+	mu sync.Mutex
+
+	// newItems, bytes, redirect and moved record details of the current fetch
+	// for its event, they are guarded by mu.
+	newItems int
+	bytes    int64
+	redirect string
+	moved    string
+
+	// movingTo is the location the feed has been permanently redirected to by
+	// the last moves fetches in a row. Once moves reaches moveAfter the feed is
+	// reported as moved.
+	movingTo  string
+	moves     int
+	moveAfter int
+
+	// hub is used to subscribe to feeds that advertise a WebSub hub, if nil the
+	// feed will only be polled. topic is guarded by topicMu, as it is set while
+	// fetching but read when starting and stopping.
+	hub     *websub.Subscriber
+	topicMu sync.Mutex
+	topic   string
+
+	// cloud is used to register for notifications from feeds that specify an
+	// rssCloud, if nil the feed will only be polled.
+	cloud *cloud.Subscriber
+
+	// extractor is used to fetch the articles linked to by new items, when it
+	// is enabled for the feed. If nil items are sent as they are.
+	extractor *extract.Extractor
+
+	// quit is closed when the tributary is stopped, so that blocks still having
+	// their articles extracted are dropped instead of sent. last is closed once
+	// the latest of those blocks has been sent, or dropped, so that they are
+	// sent in the order they were read. Both are guarded by extractMu.
+	extractMu sync.Mutex
+	quit      chan struct{}
+	last      chan struct{}
 }
 
-// New returns a tributary watching the feed at the URI given.
-func New(store feed.Database, uri string, cacheTimeout time.Duration, mapping mapping.Mapping) Tributary {
+// New returns a tributary watching the feed at the URI given, with fetches
+// timed by sched. When the feed is permanently redirected to the same location
+// moveAfter times in a row an event is sent reporting that it has moved. If hub
+// is not nil it will be used to subscribe to the feed when it advertises a
+// WebSub hub, in which case polling is paused until the subscription lease
+// expires. If cloud is not nil it will be used to register with the feed's
+// rssCloud, if it has one, so that it is fetched as soon as it is updated. If
+// extractor is not nil, and enabled for the feed, new items have the article
+// they link to extracted before they are sent.
+func New(store feed.Database, uri string, cacheTimeout time.Duration, moveAfter int, mapping mapping.Mapping, sched *scheduler.Scheduler, hub *websub.Subscriber, cloud *cloud.Subscriber, extractor *extract.Extractor) Tributary {
 	parsedURI, _ := url.Parse(uri)
 
 	p := &tributary{
-		uri:     parsedURI,
-		mapping: mapping,
-		quit:    make(chan struct{}),
+		uri:       parsedURI,
+		mapping:   mapping,
+		name:      uri,
+		sched:     sched,
+		moveAfter: moveAfter,
+		hub:       hub,
+		cloud:     cloud,
+		extractor: extractor,
 	}
 
+	p.last = make(chan struct{})
+	close(p.last)
+
 	p.feed = feed.New(cacheTimeout, p.itemHandler, store)
 	p.client = &http.Client{Timeout: time.Minute, Transport: &statusTransport{http.DefaultTransport.(*http.Transport), p}}
 
@@ -61,7 +127,7 @@ func New(store feed.Database, uri string, cacheTimeout time.Duration, mapping ma
 }
 
 func (t *tributary) Name() string {
-	return t.uri.String()
+	return t.name
 }
 
 func (t *tributary) Feeds(feeds chan<- riverjs.Feed) {
@@ -73,29 +139,59 @@ func (t *tributary) Events(events chan<- events.Event) {
 }
 
 func (t *tributary) Start() {
-	go func() {
-		log.Printf("started fetching %s\n", t.uri)
-		t.fetch()
-
-	loop:
-		for {
-			select {
-			case <-time.After(t.feed.DurationTillUpdate()):
-				log.Printf("fetching %s\n", t.uri)
-				t.fetch()
-			case <-t.quit:
-				break loop
-			}
+	t.extractMu.Lock()
+	t.quit = make(chan struct{})
+	t.extractMu.Unlock()
+
+	log.Printf("started fetching %s\n", t.uri)
+	t.sched.Add(t.name, t.fetch, time.Now().Add(t.durationTillUpdate()))
+}
+
+// durationTillUpdate returns the time to wait before the feed should next be
+// fetched. While a WebSub subscription is active this is until the lease
+// expires, after which polling takes over again.
+func (t *tributary) durationTillUpdate() time.Duration {
+	t.mu.Lock()
+	d := t.feed.DurationTillUpdate()
+	t.mu.Unlock()
+
+	if topic := t.currentTopic(); t.hub != nil && topic != "" {
+		if lease := time.Until(t.hub.Expires(topic)); lease > d {
+			return lease
 		}
+	}
 
-		log.Printf("stopped fetching %s\n", t.uri)
-		close(t.quit)
-	}()
+	return d
 }
 
 func (t *tributary) Stop() {
-	t.quit <- struct{}{}
-	<-t.quit
+	t.sched.Remove(t.name)
+
+	t.extractMu.Lock()
+	if t.quit != nil {
+		close(t.quit)
+		t.quit = nil
+	}
+	t.extractMu.Unlock()
+
+	t.topicMu.Lock()
+	topic := t.topic
+	t.topic = ""
+	t.topicMu.Unlock()
+
+	if t.hub != nil && topic != "" {
+		// the hub may be slow to respond, so it is not waited for
+		go func() {
+			if err := t.hub.Unsubscribe(topic); err != nil {
+				log.Printf("error unsubscribing from %s: %s\n", topic, err)
+			}
+		}()
+	}
+	if t.cloud != nil {
+		t.cloud.Unregister(t.uri.String())
+	}
+
+	log.Printf("stopped fetching %s\n", t.uri)
 }
 
 type statusTransport struct {
@@ -103,45 +199,227 @@ type statusTransport struct {
 	trib *tributary
 }
 
-// RoundTrip performs a RoundTrip using the underlying Transport, but then
-// checks if the status returned was a 301 MovedPermanently. If so it modifies
-// the underlying uri which will then be saved to the subscriptions next time it
-// is fetched.
+// RoundTrip performs a RoundTrip using the underlying Transport, recording the
+// location of any redirect, and the size of the body read, for the fetch's
+// event. If the feed's uri is permanently redirected the location is also
+// recorded, so that the move can be confirmed by following fetches.
 func (t *statusTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
 	resp, err = t.Transport.RoundTrip(req)
 	if err != nil {
 		return
 	}
 
-	if resp.StatusCode == http.StatusMovedPermanently {
-		newLoc := resp.Header.Get("Location")
+	resp.Body = &countingReader{ReadCloser: resp.Body, n: &t.trib.bytes}
 
-		newURL, errp := url.Parse(newLoc)
-		if errp != nil {
-			log.Printf("%s moved to %s, error: %s\n", t.trib.uri, newLoc, errp)
-			return
-		}
+	location := resp.Header.Get("Location")
+	if location == "" || resp.StatusCode < 300 || resp.StatusCode >= 400 {
+		return
+	}
 
-		log.Printf("%s moved to %s\n", t.trib.uri, newLoc)
-		t.trib.uri = newURL
+	t.trib.redirect = maybeResolvedLink(req.URL, location)
+	if (resp.StatusCode == http.StatusMovedPermanently || resp.StatusCode == http.StatusPermanentRedirect) &&
+		req.URL.String() == t.trib.uri.String() {
+		t.trib.moved = t.trib.redirect
 	}
 
 	return
 }
 
-// fetch retrieves the feed for the tributary.
-func (t *tributary) fetch() {
+// fetch retrieves the feed for the tributary, returning the result so that the
+// next fetch can be scheduled.
+func (t *tributary) fetch() scheduler.Result {
+	log.Printf("fetching %s\n", t.uri)
+
+	t.mu.Lock()
+	t.newItems, t.bytes, t.redirect, t.moved = 0, 0, "", ""
+	start := time.Now()
 	code, err := t.feed.Fetch(t.uri.String(), t.client, charset.NewReaderLabel)
-	t.events <- events.Event{
-		At:   time.Now().UTC(),
-		URI:  t.Name(),
-		Code: code,
+	event := events.Event{
+		At:         time.Now().UTC(),
+		URI:        t.Name(),
+		Code:       code,
+		Duration:   time.Since(start),
+		Bytes:      t.bytes,
+		Format:     t.feed.Format(),
+		NewItems:   t.newItems,
+		RedirectTo: t.redirect,
+		MovedTo:    t.confirmMove(code, err),
 	}
+	channels := t.feed.Channels()
+	cacheHeaders := t.feed.CacheHeaders()
+	result := scheduler.Result{Code: code, Err: err, Changed: t.newItems > 0}
+	t.mu.Unlock()
 
 	if err != nil {
 		log.Printf("error fetching %s: %d %s\n", t.uri, code, err)
+		event.Error = err.Error()
+	}
+
+	if err == nil && code == http.StatusOK {
+		result.Posted = posted(channels)
+
+		if t.hub != nil {
+			t.subscribe(channels)
+		}
+		if t.cloud != nil {
+			t.register(channels)
+		}
+	}
+
+	result.NotBefore = time.Now().Add(t.durationTillUpdate())
+
+	event.CacheControl = cacheHeaders.CacheControl
+	event.Expires = cacheHeaders.Expires
+	event.RetryAfter = cacheHeaders.RetryAfter
+	event.Next = result.NotBefore.UTC()
+	t.events <- event
+
+	return result
+}
+
+// confirmMove counts the fetches that the feed has been permanently redirected
+// to the same location in a row, returning the location once it has been
+// moveAfter times. It must be called with mu held.
+func (t *tributary) confirmMove(code int, err error) string {
+	if code == -1 && err == nil {
+		// no request was made
+		return ""
+	}
+
+	if t.moved == "" || t.moved != t.movingTo {
+		t.movingTo = t.moved
+		t.moves = 0
+	}
+	if t.movingTo == "" {
+		return ""
+	}
+
+	t.moves++
+	log.Printf("%s permanently redirected to %s (%d/%d)\n", t.uri, t.movingTo, t.moves, t.moveAfter)
+	if t.moves < t.moveAfter {
+		return ""
+	}
+
+	t.moves = 0
+	return t.movingTo
+}
+
+// posted returns the publish time of each item in channels that has one.
+func posted(channels []*common.Channel) []time.Time {
+	var times []time.Time
+	for _, ch := range channels {
+		for _, item := range ch.Items {
+			if pubDate, err := item.ParsedPubDate(); err == nil {
+				times = append(times, pubDate)
+			}
+		}
+	}
+
+	return times
+}
+
+// register registers with the rssCloud specified by the feed, if any, unless
+// already registered.
+func (t *tributary) register(channels []*common.Channel) {
+	feedURL := t.uri.String()
+	if t.cloud.Registered(feedURL) {
+		return
+	}
+
+	for _, ch := range channels {
+		if ch.Cloud.Domain == "" {
+			continue
+		}
+
+		if err := t.cloud.Register(feedURL, ch.Cloud, t.ping); err != nil {
+			log.Printf("error registering %s with cloud %s: %s\n", feedURL, ch.Cloud.Domain, err)
+			t.cloud.Unregister(feedURL)
+		}
+		return
+	}
+}
+
+// ping causes the feed to be fetched as soon as possible.
+func (t *tributary) ping() {
+	log.Printf("notified of change to %s\n", t.uri)
+
+	t.mu.Lock()
+	t.feed.Expire()
+	t.mu.Unlock()
+
+	t.sched.Wake(t.name)
+}
+
+// subscribe finds the hub advertised by the feed, if any, and subscribes to it
+// when there is no active subscription.
+func (t *tributary) subscribe(channels []*common.Channel) {
+	var hub, topic string
+	for _, ch := range channels {
+		for _, link := range ch.Links {
+			switch link.Rel {
+			case "hub":
+				hub = maybeResolvedLink(t.uri, link.Href)
+			case "self":
+				topic = maybeResolvedLink(t.uri, link.Href)
+			}
+		}
+	}
+
+	if hub == "" {
 		return
 	}
+	if topic == "" {
+		topic = t.uri.String()
+	}
+
+	if current, ok := t.hub.Hub(topic); ok && current == hub && time.Now().Before(t.hub.Expires(topic)) {
+		return
+	}
+
+	t.topicMu.Lock()
+	previous := t.topic
+	t.topic = topic
+	t.topicMu.Unlock()
+
+	if previous != "" && previous != topic {
+		t.hub.Unsubscribe(previous)
+	}
+
+	if err := t.hub.Subscribe(hub, topic, t.push); err != nil {
+		log.Printf("error subscribing to %s via %s: %s\n", topic, hub, err)
+	}
+}
+
+// currentTopic returns the topic that has been subscribed to, if any.
+func (t *tributary) currentTopic() string {
+	t.topicMu.Lock()
+	defer t.topicMu.Unlock()
+
+	return t.topic
+}
+
+// push loads content for the feed that was sent by the hub.
+func (t *tributary) push(r io.Reader) {
+	log.Printf("received push for %s\n", t.uri)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.feed.Load(r, charset.NewReaderLabel); err != nil {
+		log.Printf("error reading push for %s: %s\n", t.uri, err)
+	}
+}
+
+// countingReader adds the number of bytes read from the ReadCloser to n.
+type countingReader struct {
+	io.ReadCloser
+	n *int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	*r.n += int64(n)
+	return n, err
 }
 
 func maybeResolvedLink(root *url.URL, other string) string {
@@ -170,6 +448,7 @@ func (t *tributary) itemHandler(feed *feed.Feed, ch *common.Channel, newitems []
 	if len(items) == 0 {
 		return
 	}
+	t.newItems += len(items)
 
 	feedURL := t.uri.String()
 	websiteURL := ""
@@ -185,12 +464,61 @@ func (t *tributary) itemHandler(feed *feed.Feed, ch *common.Channel, newitems []
 		}
 	}
 
-	t.feeds <- riverjs.Feed{
+	block := riverjs.Feed{
 		FeedURL:         feedURL,
 		WebsiteURL:      websiteURL,
 		FeedTitle:       ch.Title,
 		FeedDescription: ch.Description,
 		WhenLastUpdate:  riverjs.Time(time.Now()),
 		Items:           items,
+		URI:             t.name,
 	}
+
+	if t.extractor != nil && t.extractor.Enabled(t.name) {
+		t.extract(block)
+		return
+	}
+
+	t.feeds <- block
+}
+
+// extract sends block once the articles its items link to have been extracted.
+// Pages are fetched slowly so this is done without holding up the next fetch
+// of the feed, but blocks are still sent in order. If the tributary is stopped
+// first the block is dropped.
+func (t *tributary) extract(block riverjs.Feed) {
+	t.extractMu.Lock()
+	quit, previous := t.quit, t.last
+	done := make(chan struct{})
+	t.last = done
+	t.extractMu.Unlock()
+
+	if quit == nil {
+		close(done)
+		return
+	}
+
+	go func() {
+		defer close(done)
+
+		t.extractor.Extract(t.name, &block, t.events, quit)
+
+		select {
+		case <-previous:
+		case <-quit:
+			return
+		}
+
+		// select chooses at random when both are ready, so quit is checked first
+		select {
+		case <-quit:
+			return
+		default:
+		}
+
+		select {
+		case <-quit:
+		case t.feeds <- block:
+		}
+	}()
 }
@@ -1,16 +1,27 @@
 package tributary_test
 
 import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"hawx.me/code/riviera/river/data/memdata"
+	"hawx.me/code/riviera/river/events"
+	"hawx.me/code/riviera/river/extract"
 	"hawx.me/code/riviera/river/mapping"
 	"hawx.me/code/riviera/river/riverjs"
+	"hawx.me/code/riviera/river/scheduler"
 	"hawx.me/code/riviera/river/tributary"
+	"hawx.me/code/riviera/river/websub"
 )
 
 func TestTributary(t *testing.T) {
@@ -36,7 +47,7 @@ func TestTributary(t *testing.T) {
 	defer s.Close()
 
 	db, _ := memdata.Open().Feed(s.URL)
-	tributary := tributary.New(db, s.URL, time.Minute, mapping.DefaultMapping)
+	tributary := tributary.New(db, s.URL, time.Minute, 3, mapping.DefaultMapping, scheduler.New(scheduler.Options{}), nil, nil, nil)
 	tributary.Start()
 
 	expected := riverjs.Feed{
@@ -107,11 +118,12 @@ good engineering culture— is our obsession with aggressively measuring everyth
 	defer s.Close()
 
 	db, _ := memdata.Open().Feed(s.URL)
-	tributary := tributary.New(db, s.URL, time.Minute, mapping.DefaultMapping)
+	tributary := tributary.New(db, s.URL, time.Minute, 3, mapping.DefaultMapping, scheduler.New(scheduler.Options{}), nil, nil, nil)
 	tributary.Start()
 
 	expected := riverjs.Feed{
 		FeedURL:         s.URL + "/atom.xml",
+		URI:             s.URL,
 		WebsiteURL:      s.URL,
 		FeedTitle:       "GitHub Engineering",
 		FeedDescription: "",
@@ -135,6 +147,7 @@ good engineering culture— is our obsession with aggressively measuring everyth
 	select {
 	case f := <-feeds:
 		assert.Equal(expected.FeedURL, f.FeedURL)
+		assert.Equal(expected.URI, f.URI)
 		assert.Equal(expected.WebsiteURL, f.WebsiteURL)
 		assert.Equal(expected.FeedTitle, f.FeedTitle)
 		assert.Equal(expected.FeedDescription, f.FeedDescription)
@@ -158,3 +171,283 @@ func assertItemEqual(t *testing.T, a, b riverjs.Item) {
 	assert.Equal(t, a.Comments, b.Comments)
 	assert.Equal(t, a.Enclosures, b.Enclosures)
 }
+
+func TestTributaryWithWebSub(t *testing.T) {
+	const rss = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom">
+  <channel>
+    <title>Pushed</title>
+    <link>http://example.com</link>
+    <atom:link rel="hub" href="%s" />
+    <atom:link rel="self" href="%s" />
+    <item>
+      <title>%s</title>
+      <guid>%s</guid>
+    </item>
+  </channel>
+</rss>`
+
+	var feedURL, hubURL string
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, rss, hubURL, feedURL, "First", "1")
+	}))
+	defer s.Close()
+	feedURL = s.URL
+
+	var subscriber *websub.Subscriber
+	callbacks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subscriber.ServeHTTP(w, r)
+	}))
+	defer callbacks.Close()
+	subscriber = websub.New(callbacks.URL)
+
+	unsubscribed := make(chan string, 1)
+	release := make(chan struct{})
+
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.PostForm.Get("hub.mode") == "unsubscribe" {
+			unsubscribed <- r.PostForm.Get("hub.topic")
+			<-release
+			return
+		}
+		if r.PostForm.Get("hub.mode") != "subscribe" {
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+
+		go func(form url.Values) {
+			callback := form.Get("hub.callback")
+
+			resp, err := http.Get(callback + "?" + url.Values{
+				"hub.mode":          {"subscribe"},
+				"hub.topic":         {form.Get("hub.topic")},
+				"hub.challenge":     {"yes"},
+				"hub.lease_seconds": {"3600"},
+			}.Encode())
+			if err != nil {
+				return
+			}
+			resp.Body.Close()
+
+			content := fmt.Sprintf(rss, hubURL, feedURL, "Second", "2")
+			mac := hmac.New(sha1.New, []byte(form.Get("hub.secret")))
+			io.WriteString(mac, content)
+
+			req, _ := http.NewRequest("POST", callback, strings.NewReader(content))
+			req.Header.Set("X-Hub-Signature", "sha1="+hex.EncodeToString(mac.Sum(nil)))
+			if resp, err := http.DefaultClient.Do(req); err == nil {
+				resp.Body.Close()
+			}
+		}(r.PostForm)
+	}))
+	defer hub.Close()
+	defer close(release)
+	hubURL = hub.URL
+
+	feeds := make(chan riverjs.Feed)
+	evs := make(chan events.Event, 10)
+
+	db, _ := memdata.Open().Feed(s.URL)
+	tributary := tributary.New(db, s.URL, time.Minute, 3, mapping.DefaultMapping, scheduler.New(scheduler.Options{}), subscriber, nil, nil)
+	tributary.Feeds(feeds)
+	tributary.Events(evs)
+	tributary.Start()
+
+	for _, title := range []string{"First", "Second"} {
+		select {
+		case f := <-feeds:
+			if assert.Len(t, f.Items, 1) {
+				assert.Equal(t, title, f.Items[0].Title)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+	}
+
+	assert.WithinDuration(t, time.Now().Add(time.Hour), subscriber.Expires(s.URL), time.Second)
+
+	ev := <-evs
+	assert.Equal(t, http.StatusOK, ev.Code)
+	assert.Equal(t, "rss", ev.Format)
+	assert.Equal(t, 1, ev.NewItems)
+	assert.True(t, ev.Bytes > 0)
+	assert.Equal(t, "", ev.Error)
+
+	// the hub does not respond to the unsubscription until the test ends
+	stopped := make(chan struct{})
+	go func() {
+		tributary.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("timeout stopping")
+	}
+
+	select {
+	case topic := <-unsubscribed:
+		assert.Equal(t, s.URL, topic)
+	case <-time.After(time.Second):
+		t.Fatal("timeout unsubscribing")
+	}
+}
+
+func TestTributaryHonoursRetryAfter(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7200")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer s.Close()
+
+	sched := scheduler.New(scheduler.Options{})
+	defer sched.Close()
+
+	evs := make(chan events.Event)
+
+	db, _ := memdata.Open().Feed(s.URL)
+	tributary := tributary.New(db, s.URL, time.Minute, 3, mapping.DefaultMapping, sched, nil, nil, nil)
+	tributary.Events(evs)
+	tributary.Start()
+
+	select {
+	case ev := <-evs:
+		assert.Equal(t, http.StatusServiceUnavailable, ev.Code)
+		assert.Equal(t, "7200", ev.RetryAfter)
+		assert.WithinDuration(t, time.Now().Add(2*time.Hour), ev.Next, time.Second)
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+
+	// the result is passed to the scheduler after the event is sent
+	for i := 0; i < 100; i++ {
+		if next, _ := sched.Next(s.URL); next.After(time.Now().Add(time.Hour)) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	next, ok := sched.Next(s.URL)
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(2*time.Hour), next, time.Second)
+}
+
+func TestTributaryMovesAfterPermanentRedirects(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+  <channel>
+    <title>Moved</title>
+    <item>
+      <title>Hello</title>
+      <guid>1</guid>
+    </item>
+  </channel>
+</rss>`))
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	sched := scheduler.New(scheduler.Options{})
+	defer sched.Close()
+
+	feeds := make(chan riverjs.Feed, 10)
+	evs := make(chan events.Event)
+
+	db, _ := memdata.Open().Feed(s.URL + "/old")
+	tributary := tributary.New(db, s.URL+"/old", 0, 3, mapping.DefaultMapping, sched, nil, nil, nil)
+	tributary.Feeds(feeds)
+	tributary.Events(evs)
+	tributary.Start()
+
+	for i := 1; i <= 3; i++ {
+		select {
+		case ev := <-evs:
+			assert.Equal(t, s.URL+"/old", ev.URI)
+			assert.Equal(t, http.StatusOK, ev.Code)
+			assert.Equal(t, s.URL+"/new", ev.RedirectTo)
+
+			if i < 3 {
+				assert.Equal(t, "", ev.MovedTo)
+			} else {
+				assert.Equal(t, s.URL+"/new", ev.MovedTo)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+
+		sched.Wake(s.URL + "/old")
+	}
+}
+
+func TestTributaryExtract(t *testing.T) {
+	var s *httptest.Server
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/feed":
+			w.Header().Set("Content-Type", "application/rss+xml")
+			fmt.Fprintf(w, `<rss version="2.0"><channel><title>Feed</title>
+  <item><title>Post</title><link>%s/post?%s</link><guid>%s</guid></item>
+</channel></rss>`, s.URL, r.URL.RawQuery, r.URL.RawQuery)
+
+		case "/post":
+			if r.URL.RawQuery == "slow" {
+				time.Sleep(300 * time.Millisecond)
+			}
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, `<html><body><article>
+  <p>This is the first paragraph of the article, it has a few words, some commas, and goes on for a while.</p>
+  <p>This is the second paragraph, which also goes on, and on, so that it looks like the body of the text.</p>
+  <p>And a third paragraph, because an article needs to be long enough, with enough text, to be found.</p>
+</article></body></html>`)
+		}
+	}))
+	defer s.Close()
+
+	newTributary := func(uri string) (tributary.Tributary, chan riverjs.Feed) {
+		extractor := extract.New(http.DefaultClient, extract.Options{
+			Enabled:  func(string) bool { return true },
+			Interval: time.Millisecond,
+		})
+
+		db, _ := memdata.Open().Feed(uri)
+		trib := tributary.New(db, uri, time.Minute, 3, mapping.DefaultMapping, scheduler.New(scheduler.Options{}), nil, nil, extractor)
+
+		feeds := make(chan riverjs.Feed)
+		trib.Feeds(feeds)
+		trib.Events(make(chan events.Event, 10))
+		return trib, feeds
+	}
+
+	trib, feeds := newTributary(s.URL + "/feed?fast")
+	trib.Start()
+
+	select {
+	case f := <-feeds:
+		if assert.Len(t, f.Items, 1) {
+			assert.Contains(t, f.Items[0].Content, "This is the first paragraph")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+	trib.Stop()
+
+	// the block is dropped if the tributary is stopped while extracting
+	trib, feeds = newTributary(s.URL + "/feed?slow")
+	trib.Start()
+	time.Sleep(100 * time.Millisecond)
+	trib.Stop()
+
+	select {
+	case <-feeds:
+		t.Fatal("block should be dropped once stopped")
+	case <-time.After(500 * time.Millisecond):
+	}
+}
@@ -0,0 +1,311 @@
+// Package websub implements a WebSub subscriber, allowing feeds to be pushed to
+// the river by their hub instead of waiting to be polled.
+//
+// See https://www.w3.org/TR/websub/
+package websub
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxSize limits how much content a hub can distribute in one request.
+const maxSize = 5 << 20
+
+// ContentHandler is called with the body of each valid content distribution
+// request the hub makes for a topic.
+type ContentHandler func(r io.Reader)
+
+// A Subscriber manages subscriptions to WebSub hubs, and handles the requests
+// the hubs make to its callback URLs.
+type Subscriber struct {
+	callback string
+	client   *http.Client
+
+	mu      sync.RWMutex
+	byID    map[string]*subscription
+	byTopic map[string]*subscription
+}
+
+type subscription struct {
+	id      string
+	hub     string
+	topic   string
+	secret  string
+	handler ContentHandler
+
+	// expires is the time the lease granted by the hub ends, it is zero until the
+	// hub has verified the subscription.
+	expires time.Time
+}
+
+// New creates a Subscriber. The callback is the public URL that the Subscriber
+// is served at, each subscription is given a unique path below this.
+func New(callback string) *Subscriber {
+	if !strings.HasSuffix(callback, "/") {
+		callback += "/"
+	}
+
+	return &Subscriber{
+		callback: callback,
+		client:   &http.Client{Timeout: time.Minute},
+		byID:     map[string]*subscription{},
+		byTopic:  map[string]*subscription{},
+	}
+}
+
+// Subscribe asks the hub to start sending updates for topic. The subscription
+// will only be active once the hub has verified it, which happens
+// asynchronously; see Expires.
+func (s *Subscriber) Subscribe(hub, topic string, handler ContentHandler) error {
+	id, err := randomString(16)
+	if err != nil {
+		return err
+	}
+	secret, err := randomString(32)
+	if err != nil {
+		return err
+	}
+
+	sub := &subscription{
+		id:      id,
+		hub:     hub,
+		topic:   topic,
+		secret:  secret,
+		handler: handler,
+	}
+
+	s.mu.Lock()
+	if old, ok := s.byTopic[topic]; ok {
+		delete(s.byID, old.id)
+	}
+	s.byID[id] = sub
+	s.byTopic[topic] = sub
+	s.mu.Unlock()
+
+	return s.request(hub, url.Values{
+		"hub.mode":     {"subscribe"},
+		"hub.topic":    {topic},
+		"hub.callback": {s.callback + id},
+		"hub.secret":   {secret},
+	})
+}
+
+// Unsubscribe asks the hub to stop sending updates for topic. Any content sent
+// for the topic after this call is ignored.
+func (s *Subscriber) Unsubscribe(topic string) error {
+	s.mu.Lock()
+	sub, ok := s.byTopic[topic]
+	if ok {
+		delete(s.byTopic, topic)
+		delete(s.byID, sub.id)
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	return s.request(sub.hub, url.Values{
+		"hub.mode":     {"unsubscribe"},
+		"hub.topic":    {topic},
+		"hub.callback": {s.callback + sub.id},
+	})
+}
+
+// Hub returns the hub that topic has been subscribed with, if any.
+func (s *Subscriber) Hub(topic string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sub, ok := s.byTopic[topic]
+	if !ok {
+		return "", false
+	}
+	return sub.hub, true
+}
+
+// Expires returns the time that the lease for topic ends. If the topic has not
+// been subscribed to, or the hub has not yet verified the subscription, the
+// zero time is returned.
+func (s *Subscriber) Expires(topic string) time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if sub, ok := s.byTopic[topic]; ok {
+		return sub.expires
+	}
+	return time.Time{}
+}
+
+func (s *Subscriber) request(hub string, form url.Values) error {
+	resp, err := s.client.PostForm(hub, form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("hub %s responded with %d", hub, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// ServeHTTP handles verification of intent and content distribution requests
+// made by hubs.
+func (s *Subscriber) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := path.Base(r.URL.Path)
+
+	s.mu.RLock()
+	sub, ok := s.byID[id]
+	s.mu.RUnlock()
+
+	switch r.Method {
+	case "GET":
+		s.verify(w, r, sub, ok)
+	case "POST":
+		s.content(w, r, sub, ok)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Subscriber) verify(w http.ResponseWriter, r *http.Request, sub *subscription, ok bool) {
+	var (
+		mode  = r.FormValue("hub.mode")
+		topic = r.FormValue("hub.topic")
+	)
+
+	switch mode {
+	case "subscribe":
+		if !ok || sub.topic != topic {
+			http.NotFound(w, r)
+			return
+		}
+
+		lease, _ := strconv.Atoi(r.FormValue("hub.lease_seconds"))
+
+		s.mu.Lock()
+		sub.expires = time.Now().Add(time.Duration(lease) * time.Second)
+		s.mu.Unlock()
+
+		log.Printf("websub: subscribed to %s via %s for %ds\n", topic, sub.hub, lease)
+
+	case "unsubscribe":
+		// The subscription has already been removed when Unsubscribe was called,
+		// so only confirm if nothing has been subscribed at the callback since.
+		if ok {
+			http.NotFound(w, r)
+			return
+		}
+
+	case "denied":
+		if ok && sub.topic == topic {
+			log.Printf("websub: subscription to %s denied: %s\n", topic, r.FormValue("hub.reason"))
+
+			s.mu.Lock()
+			delete(s.byID, sub.id)
+			if s.byTopic[topic] == sub {
+				delete(s.byTopic, topic)
+			}
+			s.mu.Unlock()
+		}
+		return
+
+	default:
+		http.Error(w, "unknown hub.mode", http.StatusBadRequest)
+		return
+	}
+
+	io.WriteString(w, r.FormValue("hub.challenge"))
+}
+
+func (s *Subscriber) content(w http.ResponseWriter, r *http.Request, sub *subscription, ok bool) {
+	if !ok {
+		http.Error(w, "unknown subscription", http.StatusGone)
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// A subscriber must still return a success code when the signature does not
+	// match, so that a hub can not be used to determine the secret.
+	w.WriteHeader(http.StatusAccepted)
+
+	if err := checkSignature(r.Header.Get("X-Hub-Signature"), sub.secret, body); err != nil {
+		log.Printf("websub: ignoring content for %s: %v\n", sub.topic, err)
+		return
+	}
+
+	sub.handler(bytes.NewReader(body))
+}
+
+// ErrInvalidSignature is returned when the X-Hub-Signature header does not
+// match the content it was sent with.
+var ErrInvalidSignature = errors.New("invalid signature")
+
+func checkSignature(header, secret string, body []byte) error {
+	parts := strings.SplitN(header, "=", 2)
+	if len(parts) != 2 {
+		return ErrInvalidSignature
+	}
+
+	var h func() hash.Hash
+	switch parts[0] {
+	case "sha1":
+		h = sha1.New
+	case "sha256":
+		h = sha256.New
+	case "sha384":
+		h = sha512.New384
+	case "sha512":
+		h = sha512.New
+	default:
+		return fmt.Errorf("unknown signature method %q", parts[0])
+	}
+
+	expected, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	mac := hmac.New(h, []byte(secret))
+	mac.Write(body)
+	if !hmac.Equal(expected, mac.Sum(nil)) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,157 @@
+package websub_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"hawx.me/code/riviera/river/websub"
+)
+
+type stubHub struct {
+	*httptest.Server
+	requests chan url.Values
+}
+
+// newStubHub returns a hub that records each subscription request it receives.
+func newStubHub() *stubHub {
+	hub := &stubHub{requests: make(chan url.Values, 1)}
+	hub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		w.WriteHeader(http.StatusAccepted)
+		hub.requests <- r.PostForm
+	}))
+
+	return hub
+}
+
+func verify(callback string, query url.Values) (int, string) {
+	resp, err := http.Get(callback + "?" + query.Encode())
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func distribute(callback, signature, content string) int {
+	req, _ := http.NewRequest("POST", callback, strings.NewReader(content))
+	req.Header.Set("X-Hub-Signature", signature)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func sign(secret, content string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	io.WriteString(mac, content)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestSubscriber(t *testing.T) {
+	assert := assert.New(t)
+
+	hub := newStubHub()
+	defer hub.Close()
+
+	var subscriber *websub.Subscriber
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subscriber.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+
+	subscriber = websub.New(s.URL + "/websub")
+
+	pushed := make(chan string, 1)
+	err := subscriber.Subscribe(hub.URL, "http://example.com/feed", func(r io.Reader) {
+		body, _ := ioutil.ReadAll(r)
+		pushed <- string(body)
+	})
+	assert.Nil(err)
+
+	req := <-hub.requests
+	assert.Equal("subscribe", req.Get("hub.mode"))
+	assert.Equal("http://example.com/feed", req.Get("hub.topic"))
+	assert.True(strings.HasPrefix(req.Get("hub.callback"), s.URL+"/websub/"))
+	assert.NotEmpty(req.Get("hub.secret"))
+
+	callback := req.Get("hub.callback")
+	secret := req.Get("hub.secret")
+
+	// not verified yet
+	assert.True(subscriber.Expires("http://example.com/feed").IsZero())
+
+	// wrong topic
+	code, _ := verify(callback, url.Values{
+		"hub.mode":          {"subscribe"},
+		"hub.topic":         {"http://example.com/other"},
+		"hub.challenge":     {"abc"},
+		"hub.lease_seconds": {"600"},
+	})
+	assert.Equal(http.StatusNotFound, code)
+
+	code, body := verify(callback, url.Values{
+		"hub.mode":          {"subscribe"},
+		"hub.topic":         {"http://example.com/feed"},
+		"hub.challenge":     {"abc"},
+		"hub.lease_seconds": {"600"},
+	})
+	assert.Equal(http.StatusOK, code)
+	assert.Equal("abc", body)
+	assert.WithinDuration(time.Now().Add(10*time.Minute), subscriber.Expires("http://example.com/feed"), time.Second)
+
+	// bad signature is accepted, but ignored
+	assert.Equal(http.StatusAccepted, distribute(callback, sign("wrong", "<rss/>"), "<rss/>"))
+	select {
+	case <-pushed:
+		t.Fatal("content with bad signature should be ignored")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	assert.Equal(http.StatusAccepted, distribute(callback, sign(secret, "<rss/>"), "<rss/>"))
+	select {
+	case content := <-pushed:
+		assert.Equal("<rss/>", content)
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+
+	// content over the limit is refused
+	large := "<rss>" + strings.Repeat(" ", 5<<20) + "</rss>"
+	assert.Equal(http.StatusRequestEntityTooLarge, distribute(callback, sign(secret, large), large))
+	select {
+	case <-pushed:
+		t.Fatal("content over the limit should be refused")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	assert.Nil(subscriber.Unsubscribe("http://example.com/feed"))
+	req = <-hub.requests
+	assert.Equal("unsubscribe", req.Get("hub.mode"))
+	assert.Equal(callback, req.Get("hub.callback"))
+
+	code, body = verify(callback, url.Values{
+		"hub.mode":      {"unsubscribe"},
+		"hub.topic":     {"http://example.com/feed"},
+		"hub.challenge": {"def"},
+	})
+	assert.Equal(http.StatusOK, code)
+	assert.Equal("def", body)
+
+	assert.Equal(http.StatusGone, distribute(callback, sign(secret, "<rss/>"), "<rss/>"))
+}
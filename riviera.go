@@ -2,21 +2,29 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"html/template"
 	"io"
 	"log"
 	"net/http"
+	"path/filepath"
+	"strings"
 	"sync"
-	"html/template"
 	"time"
 
 	fsnotify "gopkg.in/fsnotify.v1"
 	"hawx.me/code/riviera/river"
+	"hawx.me/code/riviera/river/archive"
+	"hawx.me/code/riviera/river/cloud"
 	"hawx.me/code/riviera/river/data"
 	"hawx.me/code/riviera/river/data/boltdata"
 	"hawx.me/code/riviera/river/data/memdata"
+	"hawx.me/code/riviera/river/extract"
 	"hawx.me/code/riviera/river/mapping"
+	"hawx.me/code/riviera/river/metrics"
+	"hawx.me/code/riviera/river/websub"
 	"hawx.me/code/riviera/subscriptions"
 	"hawx.me/code/riviera/subscriptions/opml"
 	"hawx.me/code/serve"
@@ -27,13 +35,58 @@ func printHelp() {
 
   Riviera is a feed aggregator. It reads a list of feeds in OPML
   subscription list format (http://dev.opml.org/spec2.html) given
-  as FILE, polls these feeds at a customisable interval, and serves
-  a riverjs (http://riverjs.org) format document at '/river'.
+  as FILE, which may also be an http(s) URL, polls these feeds at a customisable interval, and serves
+  a riverjs (http://riverjs.org) format document at '/river', or
+  wrapped in the onGetRiverStream callback at '/river.js'.
+
+  The river is also served as a feed, at '/river.atom' for Atom,
+  '/river.rss' for RSS and '/river.feed.json' for JSON Feed. Each
+  takes a 'folder' to only include feeds in a folder of FILE.
+
+  A log of fetch events is served at '/log', or as json at
+  '/log.json', filtered by 'feed', 'status' (ok, redirect, error,
+  fault or unknown), 'since' and 'until'.
+
+  The river can be read as a page at '/', with '/?unread=1' hiding
+  items that have been marked as read, '/?new=1' showing only what
+  has arrived since the page was last looked at, and '/?folder=NAME'
+  showing only feeds in a folder of FILE.
+
+  Items with audio, such as podcast episodes, are listed newest first
+  at '/podcasts' with a player, their artwork, duration and any
+  chapters or transcripts. It also takes a 'folder'.
 
-  A json list of fetch events is served at '/river/log'
+  Past items can be searched for at '/search', or '/search.json'.
+
+  The health of each feed is shown at '/feeds', where feeds can be
+  paused until restarted, dead feeds revived, or removed when FILE
+  is local.
+
+  Metrics, such as the number of fetches by status and how long they
+  take, are served at '/metrics' for Prometheus.
+
+  When archiving, the history of a feed can be browsed at
+  '/feed/{url}', for example '/feed/http://example.com/feed'.
+
+  Outlines with type="include" add the feeds from the OPML document
+  at their url.
 
   Changes to FILE are watched and will modify the feeds watched, if it
-  can be successfully parsed.
+  can be successfully parsed. FILE is also read again each refresh
+  period, so that changes to a remote FILE or included lists are seen.
+
+  When FILE is local, subscriptions can also be managed at
+  '/subscriptions', changes made are written back to FILE:
+
+    GET    /subscriptions                list subscriptions
+    GET    /subscriptions?discover=URL   list the feeds found for a page
+    POST   /subscriptions                subscribe to 'url', optionally
+                                         with a 'title' and 'folder'
+    PATCH  /subscriptions?url=URL        change the 'title' or 'folder'
+    DELETE /subscriptions?url=URL        unsubscribe
+
+  When 'url' is a web page, such as a blog's homepage, the best feed
+  it links to is subscribed to instead.
 
  DISPLAY
    --cutoff DUR='-24h'
@@ -41,8 +94,68 @@ func printHelp() {
       (see http://golang.org/pkg/time/#ParseDuration).
 
    --refresh DUR='15m'
-      Time to refresh feeds after. This is the default used, but if
-      advice is given in the feed itself it may be ignored.
+      Minimum time to refresh feeds after. Feeds that are updated less
+      often, fail, or ask for it in their headers are fetched less
+      often, backing off up to 6 hours.
+
+   --concurrency N='10'
+      Number of feeds to fetch at once.
+
+   --move-after N='3'
+      Number of fetches in a row that a feed must be permanently
+      redirected (301 or 308) to the same location before it is
+      treated as moved. The subscription is then changed to the new
+      location and saved, this is only possible when FILE is local.
+
+   --dead-after DUR='168h'
+      Time a feed must fail for, without any success, before it is
+      treated as dead and no longer fetched. Feeds that respond 410
+      Gone are dead straight away. Dead feeds are shown at '/feeds',
+      where they can be revived.
+
+   --comment-dead
+      Comment out dead feeds in FILE, using isComment="true", so they
+      stay dead after restarting. Requires FILE to be local.
+
+   --full-content
+      Keep the full content of items, with any unsafe markup removed,
+      so that it can be expanded in the river. Otherwise only a short
+      summary is kept.
+
+   --dedup
+      Show a story posted in several feeds once, listing where else it
+      was posted. Items are the same story when their links match,
+      ignoring tracking parameters and links that redirect to them,
+      or their titles are near-duplicates. This can also be turned on
+      or off for a 'feed' or 'folder' with 'dedup' in --mapping.
+
+   --extract-interval DUR='2s'
+      Time to wait between fetching pages from the same site, when
+      extracting articles for feeds with extract="true" in FILE. The
+      page each new item links to is fetched, and the article found
+      is kept as its full content.
+
+   --mapping PATH
+      Read rules that change or drop items from the JSON file at PATH.
+      Rules can apply to all feeds, a 'feed' or a 'folder', and can
+      'include' or 'exclude' items matching keywords or /regexps/,
+      'rewriteTitle', remove tracking parameters from links with
+      'stripTracking' or 'stripParams', drop items older than
+      'maxAgeDays', and turn 'dedup' on or off. For example:
+
+        {"rules": [
+          {"stripTracking": true, "maxAgeDays": 30},
+          {"folder": "News", "exclude": ["sponsored", "/^ad:/i"],
+           "dedup": true}
+        ]}
+
+ PUSH
+   --url URL
+      Public URL that riviera can be reached at. If given, feeds that
+      advertise a WebSub hub will be subscribed to so that updates are
+      pushed, polling resumes if the subscription lapses. Feeds that
+      specify an rssCloud will be registered with so that they are
+      fetched as soon as they are updated.
 
  DATA
    By default riviera runs with an in memory database.
@@ -50,6 +163,16 @@ func printHelp() {
    --boltdb PATH
       Use the boltdb file at the given path.
 
+   --archive
+      Keep every item read in an archive, instead of only those within
+      the cutoff. Requires --boltdb.
+
+   --archive-age DUR
+      Remove archived items once they are older than this.
+
+   --archive-count N
+      Keep at most N archived items for each feed.
+
  SERVE
    --port PORT='8080'
       Serve on given port.
@@ -62,8 +185,23 @@ var (
 	cutOff  = flag.String("cutoff", "-24h", "")
 	refresh = flag.String("refresh", "15m", "")
 
-	boltdbPath = flag.String("boltdb", "", "")
-	webPath    = flag.String("web", "web", "")
+	concurrency = flag.Int("concurrency", 10, "")
+	moveAfter   = flag.Int("move-after", 3, "")
+	deadAfter   = flag.Duration("dead-after", 7*24*time.Hour, "")
+	commentDead = flag.Bool("comment-dead", false, "")
+	mappingPath = flag.String("mapping", "", "")
+	fullContent = flag.Bool("full-content", false, "")
+	dedup       = flag.Bool("dedup", false, "")
+
+	extractInterval = flag.Duration("extract-interval", 2*time.Second, "")
+
+	publicURL = flag.String("url", "", "")
+
+	boltdbPath   = flag.String("boltdb", "", "")
+	useArchive   = flag.Bool("archive", false, "")
+	archiveAge   = flag.Duration("archive-age", 0, "")
+	archiveCount = flag.Int("archive-count", 0, "")
+	webPath      = flag.String("web", "web", "")
 
 	port   = flag.String("port", "8080", "")
 	socket = flag.String("socket", "", "")
@@ -77,17 +215,59 @@ func loadDatastore() (data.Database, error) {
 	return memdata.Open(), nil
 }
 
+// loadSubscriptions reads the subscriptions listed in the OPML document at
+// location, including those from any lists that it includes.
+func loadSubscriptions(location string) (*subscriptions.Subscriptions, error) {
+	doc, err := opml.Load(location)
+	if err != nil {
+		return nil, err
+	}
+
+	return subscriptions.FromOpml(opml.LoadIncludes(doc, location)), nil
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
+
+// poll calls f every interval until closed.
+func poll(interval time.Duration, f func()) io.Closer {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				f()
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return closerFunc(func() error {
+		close(done)
+		return nil
+	})
+}
+
+// watchFile calls f whenever the file at path is changed. The directory
+// containing the file is watched, so that the file being replaced is noticed.
 func watchFile(path string, f func()) (io.Closer, error) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return watcher, err
 	}
 
+	path = filepath.Clean(path)
+
 	go func() {
 		for {
 			select {
 			case event := <-watcher.Events:
-				if event.Op&fsnotify.Write == fsnotify.Write {
+				if filepath.Clean(event.Name) == path && event.Op&(fsnotify.Write|fsnotify.Create) != 0 {
 					f()
 				}
 			case err := <-watcher.Errors:
@@ -98,7 +278,7 @@ func watchFile(path string, f func()) (io.Closer, error) {
 		}
 	}()
 
-	return watcher, watcher.Add(path)
+	return watcher, watcher.Add(filepath.Dir(path))
 }
 
 func parseTemplates(path string) (*template.Template, error) {
@@ -152,50 +332,199 @@ func main() {
 	}
 	defer waitFor("datastore", store.Close)
 
-	outline, err := opml.Load(opmlPath)
+	registry := metrics.NewRegistry()
+	if sizer, ok := store.(data.Sizer); ok {
+		registry.NewGauge("riviera_database_bytes", "Size of the database.").SetFunc(func() float64 {
+			size, _ := sizer.Size()
+			return float64(size)
+		})
+	}
+
+	var itemArchive archive.Database
+	if *useArchive {
+		archiver, ok := store.(data.Archiver)
+		if !ok {
+			log.Println("--archive requires --boltdb")
+			return
+		}
+
+		itemArchive, err = archiver.Archive(archive.Retention{
+			MaxAge:   *archiveAge,
+			MaxItems: *archiveCount,
+		})
+		if err != nil {
+			log.Println(err)
+			return
+		}
+	}
+
+	subs, err := loadSubscriptions(opmlPath)
 	if err != nil {
 		log.Println(err)
 		return
 	}
 
+	var (
+		subscriber *websub.Subscriber
+		notifier   *cloud.Subscriber
+	)
+	if *publicURL != "" {
+		base := strings.TrimSuffix(*publicURL, "/")
+
+		subscriber = websub.New(base + "/websub/")
+		http.Handle("/websub/", subscriber)
+
+		notifier, err = cloud.New(base + "/rsscloud")
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		http.Handle("/rsscloud", notifier)
+	}
+
+	var itemMapping mapping.Mapping = mapping.DefaultMapping
+	if *fullContent {
+		itemMapping = mapping.FullContent(itemMapping)
+	}
+
+	var (
+		feedMapping func(uri string) mapping.Mapping
+		config      *mapping.Config
+	)
+	if *mappingPath != "" {
+		config, err = mapping.LoadConfig(*mappingPath)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		feedMapping = func(uri string) mapping.Mapping {
+			return config.Mapping(itemMapping, uri, func() string {
+				sub, _ := subs.Get(uri)
+				return sub.Folder
+			})
+		}
+	}
+
+	var dedupFeed func(uri string) bool
+	if *dedup || config != nil {
+		dedupFeed = func(uri string) bool {
+			if config == nil {
+				return true
+			}
+
+			sub, _ := subs.Get(uri)
+			return config.Dedup(uri, sub.Folder, *dedup)
+		}
+	}
+
+	extractor := extract.New(&http.Client{Timeout: time.Minute}, extract.Options{
+		Enabled: func(uri string) bool {
+			sub, _ := subs.Get(uri)
+			return sub.Extract
+		},
+		Interval: *extractInterval,
+	})
+
+	var editor *subscriptions.Editor
+
 	feeds := river.New(store, river.Options{
-		Mapping:   mapping.DefaultMapping,
-		CutOff:    duration,
-		Refresh:   cacheTimeout,
+		Mapping:     itemMapping,
+		FeedMapping: feedMapping,
+		Dedup:       dedupFeed,
+		CutOff:      duration,
+		Refresh:     cacheTimeout,
+		Concurrency: *concurrency,
+		MoveAfter:   *moveAfter,
+		Moved: func(from, to string) error {
+			if editor == nil {
+				return errors.New("subscriptions can only be changed when FILE is local")
+			}
+			return editor.Move(from, to)
+		},
+		DeadAfter: *deadAfter,
+		Died: func(uri string) {
+			if !*commentDead || editor == nil {
+				return
+			}
+			if _, err := editor.Update(uri, func(sub *subscriptions.Subscription) { sub.Dead = true }); err != nil {
+				log.Printf("could not comment out %s: %s\n", uri, err)
+			}
+		},
 		LogLength: 500,
+		WebSub:    subscriber,
+		Cloud:     notifier,
+		Extractor: extractor,
+		Archive:   itemArchive,
+		Metrics:   registry,
 	})
 	defer waitFor("feeds", feeds.Close)
 
-	subs := subscriptions.FromOpml(outline)
+	if !opml.IsRemote(opmlPath) {
+		editor = subscriptions.NewEditor(subs, feeds, opmlPath)
+	}
+
 	for _, sub := range subs.List() {
-		feeds.Add(sub.URI)
+		if !sub.Dead {
+			feeds.Add(sub.URI)
+		}
 	}
 
-	watcher, err := watchFile(opmlPath, func() {
+	var mu sync.Mutex
+	update := func() {
+		mu.Lock()
+		defer mu.Unlock()
+
 		log.Printf("reading %s\n", opmlPath)
-		outline, err := opml.Load(opmlPath)
+		changed, err := loadSubscriptions(opmlPath)
 		if err != nil {
 			log.Printf("could not read %s: %s\n", opmlPath, err)
 			return
 		}
 
-		added, removed := subscriptions.Diff(subs, subscriptions.FromOpml(outline))
+		added, removed := subscriptions.Diff(subs, changed)
 		for _, uri := range added {
 			feeds.Add(uri)
-			subs.Add(uri)
 		}
 		for _, uri := range removed {
 			feeds.Remove(uri)
 			subs.Remove(uri)
 		}
-	})
-	if err != nil {
-		log.Printf("could not start watching %s: %v\n", opmlPath, err)
+		for _, sub := range changed.List() {
+			subs.Refresh(sub)
+		}
+		subs.SetIncludes(changed.Includes())
+	}
+
+	// remote lists, and any lists they include, can only be checked for changes
+	// by fetching them again
+	defer waitFor("poller", poll(cacheTimeout, update).Close)
+
+	if !opml.IsRemote(opmlPath) {
+		watcher, err := watchFile(opmlPath, update)
+		if err != nil {
+			log.Printf("could not start watching %s: %v\n", opmlPath, err)
+		}
+		defer waitFor("watcher", watcher.Close)
+
+		http.Handle("/subscriptions", subscriptions.Handler(editor, &http.Client{Timeout: time.Minute}))
 	}
-	defer waitFor("watcher", watcher.Close)
 
-	http.Handle("/", river.List(feeds, templates))
+	http.Handle("/", river.List(feeds, subs, templates))
+	http.Handle("/podcasts", river.Podcasts(feeds, subs, templates))
+	http.Handle("/read", river.Read(feeds))
+	http.Handle("/river", river.Riverjs(feeds))
+	http.Handle("/river.js", river.Riverjs(feeds))
+	http.Handle("/river.atom", river.Syndicate(feeds, subs))
+	http.Handle("/river.rss", river.Syndicate(feeds, subs))
+	http.Handle("/river.feed.json", river.Syndicate(feeds, subs))
 	http.Handle("/log", river.Log(feeds, templates))
+	http.Handle("/log.json", river.Log(feeds, templates))
+	http.Handle("/search", river.Search(feeds, templates))
+	http.Handle("/search.json", river.Search(feeds, templates))
+	http.Handle("/feed/", river.Feed(feeds, templates))
+	http.Handle("/feeds", river.Feeds(feeds, subs, editor, templates))
+	http.Handle("/metrics", registry.Handler())
 
 	http.Handle("/public/", http.StripPrefix("/public", http.FileServer(http.Dir(*webPath+"/static"))))
 
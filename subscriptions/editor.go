@@ -0,0 +1,167 @@
+package subscriptions
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+)
+
+var (
+	// ErrInvalidURL is returned when adding a subscription that is not an
+	// absolute url.
+	ErrInvalidURL = errors.New("url must be an absolute url")
+
+	// ErrExists is returned when adding a subscription that already exists.
+	ErrExists = errors.New("already subscribed")
+
+	// ErrNotFound is returned when changing a subscription that does not exist.
+	ErrNotFound = errors.New("not subscribed")
+
+	// ErrIncluded is returned when changing a subscription that was read from an
+	// included list.
+	ErrIncluded = errors.New("subscription is from an included list")
+)
+
+// An Editor makes changes to Subscriptions, saving the Subscriptions to the OPML
+// file at path and then applying each to the feeds. Changes are made one at a
+// time, so that they are written in order. If a change cannot be saved it is
+// undone, so that the Subscriptions and feeds match the file.
+type Editor struct {
+	subs  *Subscriptions
+	feeds Feeds
+	path  string
+	mu    sync.Mutex
+}
+
+// NewEditor returns an Editor for subs.
+func NewEditor(subs *Subscriptions, feeds Feeds, path string) *Editor {
+	return &Editor{subs: subs, feeds: feeds, path: path}
+}
+
+// Subscriptions returns the Subscriptions being edited.
+func (e *Editor) Subscriptions() *Subscriptions {
+	return e.subs
+}
+
+// Add subscribes to the feed at sub.URI.
+func (e *Editor) Add(sub Subscription) (Subscription, error) {
+	if u, err := url.Parse(sub.URI); err != nil || !u.IsAbs() {
+		return sub, ErrInvalidURL
+	}
+	if sub.FeedURL == "" {
+		sub.FeedURL = sub.URI
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, ok := e.subs.Get(sub.URI); ok {
+		return sub, ErrExists
+	}
+
+	e.subs.Refresh(sub)
+	if err := e.save(); err != nil {
+		e.subs.Remove(sub.URI)
+		return sub, err
+	}
+
+	e.feeds.Add(sub.URI)
+	return sub, nil
+}
+
+// Update changes the subscription to uri with the function given.
+func (e *Editor) Update(uri string, update func(*Subscription)) (Subscription, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	sub, ok := e.subs.Get(uri)
+	if !ok {
+		return sub, ErrNotFound
+	}
+	if sub.Include != "" {
+		return sub, ErrIncluded
+	}
+
+	previous := sub
+	update(&sub)
+	sub.URI = uri
+	e.subs.Refresh(sub)
+
+	if err := e.save(); err != nil {
+		e.subs.Refresh(previous)
+		return previous, err
+	}
+
+	return sub, nil
+}
+
+// Remove unsubscribes from the feed at uri.
+func (e *Editor) Remove(uri string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	sub, ok := e.subs.Get(uri)
+	if !ok {
+		return ErrNotFound
+	}
+	if sub.Include != "" {
+		return ErrIncluded
+	}
+
+	e.subs.Remove(uri)
+	if err := e.save(); err != nil {
+		e.subs.Refresh(sub)
+		return err
+	}
+
+	e.feeds.Remove(uri)
+	return nil
+}
+
+// Move changes the subscription to from so that it is to the feed at to,
+// because the feed has permanently moved. The feeds are not changed, as the
+// move has already been made. If there is already a subscription to to, the
+// subscription to from is removed instead.
+func (e *Editor) Move(from, to string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	sub, ok := e.subs.Get(from)
+	if !ok {
+		return ErrNotFound
+	}
+	if sub.Include != "" {
+		return ErrIncluded
+	}
+
+	moved := sub
+	_, exists := e.subs.Get(to)
+
+	e.subs.Remove(from)
+	if !exists {
+		if moved.FeedURL == from {
+			moved.FeedURL = to
+		}
+		moved.URI = to
+		e.subs.Refresh(moved)
+	}
+
+	if err := e.save(); err != nil {
+		if !exists {
+			e.subs.Remove(to)
+		}
+		e.subs.Refresh(sub)
+		return err
+	}
+
+	return nil
+}
+
+func (e *Editor) save() error {
+	if err := AsOpml(e.subs).Save(e.path); err != nil {
+		return fmt.Errorf("could not save %s: %v", e.path, err)
+	}
+
+	return nil
+}
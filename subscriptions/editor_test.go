@@ -0,0 +1,81 @@
+package subscriptions
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"hawx.me/code/riviera/subscriptions/opml"
+)
+
+func TestEditorMove(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "riviera-subscriptions-test")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "feeds.opml")
+
+	subs := New()
+	subs.Refresh(Subscription{URI: "http://old", FeedURL: "http://old", FeedTitle: "Old", Folder: "Work"})
+	subs.Refresh(Subscription{URI: "http://a", FeedTitle: "A"})
+	subs.Refresh(Subscription{URI: "http://b", FeedTitle: "B"})
+	subs.Refresh(Subscription{URI: "http://hey", Include: "http://example.com/team.opml"})
+	feeds := fakeFeeds{"http://old": true, "http://a": true, "http://b": true}
+
+	editor := NewEditor(subs, feeds, path)
+
+	assert.Nil(editor.Move("http://old", "http://new"))
+	_, ok := subs.Get("http://old")
+	assert.False(ok)
+	sub, _ := subs.Get("http://new")
+	assert.Equal(Subscription{URI: "http://new", FeedURL: "http://new", FeedTitle: "Old", Folder: "Work"}, sub)
+
+	// the feeds are left for the caller to move
+	assert.Equal([]string{"http://a", "http://b", "http://old"}, feeds.List())
+
+	// moving to an existing subscription removes the old one
+	assert.Nil(editor.Move("http://a", "http://b"))
+	_, ok = subs.Get("http://a")
+	assert.False(ok)
+
+	doc, _ := opml.Load(path)
+	assert.Equal([]opml.Outline{
+		{Type: "rss", Text: "B", Title: "B", XMLURL: "http://b"},
+		{Text: "Work", Title: "Work", Outline: []opml.Outline{
+			{Type: "rss", Text: "Old", Title: "Old", XMLURL: "http://new"},
+		}},
+	}, doc.Body.Outline)
+
+	assert.Equal(ErrNotFound, editor.Move("http://what", "http://new"))
+	assert.Equal(ErrIncluded, editor.Move("http://hey", "http://new"))
+}
+
+func TestEditorWhenSaveFails(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "riviera-subscriptions-test")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "missing", "feeds.opml")
+
+	subs := New()
+	subs.Refresh(Subscription{URI: "http://a", FeedURL: "http://a", FeedTitle: "A"})
+	feeds := fakeFeeds{"http://a": true}
+
+	editor := NewEditor(subs, feeds, path)
+
+	_, err := editor.Add(Subscription{URI: "http://b"})
+	assert.NotNil(err)
+	_, ok := subs.Get("http://b")
+	assert.False(ok)
+
+	_, err = editor.Update("http://a", func(sub *Subscription) { sub.Folder = "Work" })
+	assert.NotNil(err)
+
+	assert.NotNil(editor.Remove("http://a"))
+	assert.NotNil(editor.Move("http://a", "http://new"))
+
+	assert.Equal([]Subscription{{URI: "http://a", FeedURL: "http://a", FeedTitle: "A"}}, subs.List())
+	assert.Equal([]string{"http://a"}, feeds.List())
+}
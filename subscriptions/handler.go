@@ -0,0 +1,190 @@
+package subscriptions
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"hawx.me/code/riviera/feed/discover"
+)
+
+// Feeds is the set of feeds that changes to subscriptions are applied to.
+type Feeds interface {
+	// Add subscribes to the feed at uri.
+	Add(uri string)
+
+	// Remove unsubscribes from the feed at uri.
+	Remove(uri string)
+}
+
+// Handler serves an API for managing the Subscriptions of the Editor:
+//
+//	GET    /?url=URL       returns the subscription, or all if no url is given
+//	GET    /?discover=URL  returns the feeds found for the page, best first
+//	POST   /               adds the feed at "url", with an optional "title", "folder" and "extract"
+//	PATCH  /?url=URL       renames or moves the subscription, given "title" or "folder",
+//	                       or turns extracting articles on or off, given "extract"
+//	DELETE /?url=URL       removes the subscription
+//
+// Subscriptions read from an included list can not be changed.
+//
+// If client is not nil it is used to find the feeds of pages: when the url
+// added is a web page, rather than a feed, the best feed it links to is added
+// instead. If the url can not be fetched, or is a page that links to no feeds,
+// it is added as given. When client is nil discovery is not available.
+func Handler(editor *Editor, client *http.Client) http.Handler {
+	return &handler{editor: editor, client: client}
+}
+
+type handler struct {
+	editor *Editor
+	client *http.Client
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		h.get(w, r)
+	case "POST":
+		h.add(w, r)
+	case "PATCH":
+		h.update(w, r)
+	case "DELETE":
+		h.remove(w, r)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *handler) get(w http.ResponseWriter, r *http.Request) {
+	if page := r.FormValue("discover"); page != "" {
+		h.discover(w, r, page)
+		return
+	}
+
+	subs := h.editor.Subscriptions()
+
+	uri := r.FormValue("url")
+	if uri == "" {
+		list := subs.List()
+		if list == nil {
+			list = []Subscription{}
+		}
+		writeJSON(w, http.StatusOK, list)
+		return
+	}
+
+	sub, ok := subs.Get(uri)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, sub)
+}
+
+func (h *handler) discover(w http.ResponseWriter, r *http.Request, page string) {
+	if h.client == nil {
+		http.Error(w, "discovery is not available", http.StatusNotImplemented)
+		return
+	}
+
+	feeds, err := discover.Discover(h.client, page)
+	switch err {
+	case nil:
+		writeJSON(w, http.StatusOK, feeds)
+	case discover.ErrNoFeeds:
+		writeJSON(w, http.StatusOK, []discover.Feed{})
+	default:
+		log.Println("subscriptions:", err)
+		http.Error(w, "could not fetch "+page, http.StatusBadGateway)
+	}
+}
+
+func (h *handler) add(w http.ResponseWriter, r *http.Request) {
+	uri := r.PostFormValue("url")
+
+	if h.client != nil {
+		var err error
+		if uri, err = discover.Resolve(h.client, uri); err != nil {
+			log.Printf("subscriptions: could not discover feeds for %s: %v\n", uri, err)
+		}
+	}
+
+	extract, _ := strconv.ParseBool(r.PostFormValue("extract"))
+
+	sub, err := h.editor.Add(Subscription{
+		URI:       uri,
+		FeedTitle: r.PostFormValue("title"),
+		Folder:    r.PostFormValue("folder"),
+		Extract:   extract,
+	})
+	if !writeError(w, r, err) {
+		writeJSON(w, http.StatusCreated, sub)
+	}
+}
+
+func (h *handler) update(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	var extract *bool
+	if values, ok := r.PostForm["extract"]; ok {
+		v, err := strconv.ParseBool(values[0])
+		if err != nil {
+			http.Error(w, "extract must be true or false", http.StatusBadRequest)
+			return
+		}
+		extract = &v
+	}
+
+	sub, err := h.editor.Update(r.FormValue("url"), func(sub *Subscription) {
+		if title, ok := r.PostForm["title"]; ok {
+			sub.FeedTitle = title[0]
+		}
+		if folder, ok := r.PostForm["folder"]; ok {
+			sub.Folder = folder[0]
+		}
+		if extract != nil {
+			sub.Extract = *extract
+		}
+	})
+	if !writeError(w, r, err) {
+		writeJSON(w, http.StatusOK, sub)
+	}
+}
+
+func (h *handler) remove(w http.ResponseWriter, r *http.Request) {
+	err := h.editor.Remove(r.FormValue("url"))
+	if !writeError(w, r, err) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// writeError writes a response for err returned by the Editor, if it is not
+// nil, and returns true if it did.
+func writeError(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch err {
+	case nil:
+		return false
+	case ErrInvalidURL:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case ErrExists, ErrIncluded:
+		http.Error(w, err.Error(), http.StatusConflict)
+	case ErrNotFound:
+		http.NotFound(w, r)
+	default:
+		log.Println("subscriptions:", err)
+		http.Error(w, "could not save subscriptions", http.StatusInternalServerError)
+	}
+
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("subscriptions:", err)
+	}
+}
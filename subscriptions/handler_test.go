@@ -0,0 +1,201 @@
+package subscriptions
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"hawx.me/code/riviera/feed/discover"
+	"hawx.me/code/riviera/subscriptions/opml"
+)
+
+type fakeFeeds map[string]bool
+
+func (f fakeFeeds) Add(uri string)    { f[uri] = true }
+func (f fakeFeeds) Remove(uri string) { delete(f, uri) }
+
+func (f fakeFeeds) List() []string {
+	l := []string{}
+	for uri := range f {
+		l = append(l, uri)
+	}
+	sort.Strings(l)
+	return l
+}
+
+func TestHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "riviera-subscriptions-test")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "feeds.opml")
+
+	subs := New()
+	subs.Refresh(Subscription{URI: "http://cool", FeedURL: "http://cool", FeedTitle: "cool"})
+	feeds := fakeFeeds{"http://cool": true}
+
+	s := httptest.NewServer(Handler(NewEditor(subs, feeds, path), nil))
+	defer s.Close()
+
+	do := func(method, query string, form url.Values) *http.Response {
+		req, _ := http.NewRequest(method, s.URL+query, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp, _ := http.DefaultClient.Do(req)
+		return resp
+	}
+
+	saved := func() []opml.Outline {
+		doc, _ := opml.Load(path)
+		return doc.Body.Outline
+	}
+
+	// add
+	resp := do("POST", "", url.Values{"url": {"http://what"}, "title": {"What"}, "folder": {"Work"}})
+	assert.Equal(http.StatusCreated, resp.StatusCode)
+	assert.Equal([]string{"http://cool", "http://what"}, feeds.List())
+	assert.Equal([]opml.Outline{
+		{Type: "rss", Text: "cool", Title: "cool", XMLURL: "http://cool"},
+		{Text: "Work", Title: "Work", Outline: []opml.Outline{
+			{Type: "rss", Text: "What", Title: "What", XMLURL: "http://what"},
+		}},
+	}, saved())
+
+	resp = do("POST", "", url.Values{"url": {"http://what"}})
+	assert.Equal(http.StatusConflict, resp.StatusCode)
+
+	resp = do("POST", "", url.Values{"url": {"not a url"}})
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	// list
+	resp = do("GET", "", nil)
+	var list []Subscription
+	json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	assert.Equal([]Subscription{
+		{URI: "http://cool", FeedURL: "http://cool", FeedTitle: "cool"},
+		{URI: "http://what", FeedURL: "http://what", FeedTitle: "What", Folder: "Work"},
+	}, list)
+
+	// rename and move
+	resp = do("PATCH", "?url="+url.QueryEscape("http://cool"), url.Values{"title": {"Cool"}, "folder": {"Work"}})
+	assert.Equal(http.StatusOK, resp.StatusCode)
+
+	resp = do("GET", "?url="+url.QueryEscape("http://cool"), nil)
+	var sub Subscription
+	json.NewDecoder(resp.Body).Decode(&sub)
+	resp.Body.Close()
+	assert.Equal(Subscription{URI: "http://cool", FeedURL: "http://cool", FeedTitle: "Cool", Folder: "Work"}, sub)
+
+	resp = do("PATCH", "?url="+url.QueryEscape("http://what"), url.Values{"folder": {""}})
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal([]opml.Outline{
+		{Text: "Work", Title: "Work", Outline: []opml.Outline{
+			{Type: "rss", Text: "Cool", Title: "Cool", XMLURL: "http://cool"},
+		}},
+		{Type: "rss", Text: "What", Title: "What", XMLURL: "http://what"},
+	}, saved())
+
+	// remove
+	resp = do("DELETE", "?url="+url.QueryEscape("http://cool"), nil)
+	assert.Equal(http.StatusNoContent, resp.StatusCode)
+	assert.Equal([]string{"http://what"}, feeds.List())
+	assert.Equal([]opml.Outline{
+		{Type: "rss", Text: "What", Title: "What", XMLURL: "http://what"},
+	}, saved())
+
+	resp = do("DELETE", "?url="+url.QueryEscape("http://cool"), nil)
+	assert.Equal(http.StatusNotFound, resp.StatusCode)
+
+	// extract
+	resp = do("PATCH", "?url="+url.QueryEscape("http://what"), url.Values{"extract": {"true"}})
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal([]opml.Outline{
+		{Type: "rss", Text: "What", Title: "What", XMLURL: "http://what", Extract: "true"},
+	}, saved())
+
+	resp = do("PATCH", "?url="+url.QueryEscape("http://what"), url.Values{"extract": {"maybe"}})
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	// included subscriptions can't be changed
+	subs.Refresh(Subscription{URI: "http://hey", Include: "http://example.com/team.opml"})
+
+	resp = do("PATCH", "?url="+url.QueryEscape("http://hey"), url.Values{"title": {"Hey"}})
+	assert.Equal(http.StatusConflict, resp.StatusCode)
+
+	resp = do("DELETE", "?url="+url.QueryEscape("http://hey"), nil)
+	assert.Equal(http.StatusConflict, resp.StatusCode)
+}
+
+func TestHandlerDiscovery(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "riviera-subscriptions-test")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "feeds.opml")
+
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head>
+  <link rel="alternate" type="application/rss+xml" href="/rss">
+  <link rel="alternate" type="application/atom+xml" title="Blog" href="/atom">
+</head></html>`))
+		case "/empty":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html></html>`))
+		case "/posts.rss":
+			w.Header().Set("Content-Type", "application/rss+xml")
+			w.Write([]byte(`<rss version="2.0"><channel><title>Feed</title></channel></rss>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer site.Close()
+
+	subs := New()
+	feeds := fakeFeeds{}
+
+	s := httptest.NewServer(Handler(NewEditor(subs, feeds, path), http.DefaultClient))
+	defer s.Close()
+
+	// discover
+	resp, _ := http.Get(s.URL + "?discover=" + url.QueryEscape(site.URL))
+	var found []discover.Feed
+	json.NewDecoder(resp.Body).Decode(&found)
+	resp.Body.Close()
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal([]discover.Feed{
+		{URL: site.URL + "/atom", Title: "Blog", Type: "application/atom+xml"},
+		{URL: site.URL + "/rss", Type: "application/rss+xml"},
+	}, found)
+
+	resp, _ = http.Get(s.URL + "?discover=" + url.QueryEscape(site.URL+"/empty"))
+	assert.Equal(http.StatusOK, resp.StatusCode)
+
+	// add a page
+	resp, _ = http.PostForm(s.URL, url.Values{"url": {site.URL}})
+	assert.Equal(http.StatusCreated, resp.StatusCode)
+	assert.Equal([]string{site.URL + "/atom"}, feeds.List())
+
+	// urls that aren't pages, can't be fetched, or have no feeds are added as
+	// given
+	resp, _ = http.PostForm(s.URL, url.Values{"url": {site.URL + "/posts.rss"}})
+	assert.Equal(http.StatusCreated, resp.StatusCode)
+
+	resp, _ = http.PostForm(s.URL, url.Values{"url": {site.URL + "/missing"}})
+	assert.Equal(http.StatusCreated, resp.StatusCode)
+
+	resp, _ = http.PostForm(s.URL, url.Values{"url": {site.URL + "/empty"}})
+	assert.Equal(http.StatusCreated, resp.StatusCode)
+
+	assert.Equal([]string{site.URL + "/atom", site.URL + "/empty", site.URL + "/missing", site.URL + "/posts.rss"}, feeds.List())
+}
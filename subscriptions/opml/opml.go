@@ -4,8 +4,17 @@ package opml
 
 import (
 	"encoding/xml"
+	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"golang.org/x/net/html/charset"
 )
@@ -55,10 +64,48 @@ type Outline struct {
 	// title is probably the same as text, it should not be omitted. title
 	// contains the top-level title element from the feed.
 	Title string `xml:"title,attr,omitempty"`
+
+	// isComment is "true" if the outline, and any children, are commented out.
+	IsComment string `xml:"isComment,attr,omitempty"`
+
+	// extract is "true" if the page linked to by each new item of the feed
+	// should be fetched to read the full article.
+	Extract string `xml:"extract,attr,omitempty"`
+
+	// url is used by outlines with a type of include to point to another OPML
+	// document, the outlines of which appear as children of the outline.
+	URL string `xml:"url,attr,omitempty"`
+
+	// Outline contains any child outlines, this is used to group feeds into
+	// folders.
+	Outline []Outline `xml:"outline"`
+}
+
+// IsRemote returns true if location is an http or https URL rather than a
+// path.
+func IsRemote(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
 }
 
-// Load parses the OPML file at the path.
+var client = &http.Client{Timeout: time.Minute}
+
+// Load parses the OPML file at the path, or if given an http or https URL the
+// OPML document served at that location.
 func Load(path string) (doc Opml, err error) {
+	if IsRemote(path) {
+		resp, err := client.Get(path)
+		if err != nil {
+			return doc, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return doc, fmt.Errorf("%s responded with %d", path, resp.StatusCode)
+		}
+
+		return Read(resp.Body)
+	}
+
 	file, err := os.Open(path)
 	if err != nil {
 		return
@@ -68,6 +115,92 @@ func Load(path string) (doc Opml, err error) {
 	return Read(file)
 }
 
+// maxIncludeDepth limits how deeply includes can be nested.
+const maxIncludeDepth = 10
+
+// LoadIncludes loads the document for each outline in doc with a type of
+// include, and sets the outlines of that document as its children. Includes
+// within included documents are also loaded. The url of an include is resolved
+// against location, which is where doc was loaded from. An include that can not
+// be loaded, or that includes itself, is logged and left without children.
+func LoadIncludes(doc Opml, location string) Opml {
+	doc.Body.Outline = loadIncludes(doc.Body.Outline, location, []string{location})
+	return doc
+}
+
+func loadIncludes(outlines []Outline, location string, seen []string) []Outline {
+	if outlines == nil {
+		return nil
+	}
+
+	result := make([]Outline, len(outlines))
+
+	for i, outline := range outlines {
+		if outline.Type != "include" {
+			outline.Outline = loadIncludes(outline.Outline, location, seen)
+			result[i] = outline
+			continue
+		}
+
+		include, included, err := loadInclude(outline, location, seen)
+		if err != nil {
+			log.Printf("opml: could not include %s: %v\n", outline.URL, err)
+			outline.Outline = nil
+			result[i] = outline
+			continue
+		}
+
+		outline.Outline = loadIncludes(included.Body.Outline, include, append(seen, include))
+		result[i] = outline
+	}
+
+	return result
+}
+
+// loadInclude loads the document for the include outline, returning where it
+// was loaded from.
+func loadInclude(outline Outline, location string, seen []string) (string, Opml, error) {
+	include, err := resolve(location, outline.URL)
+	if err != nil {
+		return "", Opml{}, err
+	}
+	for _, s := range seen {
+		if s == include {
+			return "", Opml{}, fmt.Errorf("%s includes itself", include)
+		}
+	}
+	if len(seen) > maxIncludeDepth {
+		return "", Opml{}, fmt.Errorf("includes nested too deeply at %s", include)
+	}
+
+	included, err := Load(include)
+	return include, included, err
+}
+
+// resolve returns the location of ref, relative to the document at base.
+func resolve(base, ref string) (string, error) {
+	if ref == "" {
+		return "", errors.New("include outline has no url")
+	}
+
+	if IsRemote(base) {
+		baseURL, err := url.Parse(base)
+		if err != nil {
+			return "", err
+		}
+		refURL, err := url.Parse(ref)
+		if err != nil {
+			return "", err
+		}
+		return baseURL.ResolveReference(refURL).String(), nil
+	}
+
+	if IsRemote(ref) || filepath.IsAbs(ref) {
+		return ref, nil
+	}
+	return filepath.Join(filepath.Dir(base), ref), nil
+}
+
 // Read parses an OPML document.
 func Read(r io.Reader) (doc Opml, err error) {
 	d := xml.NewDecoder(r)
@@ -85,3 +218,35 @@ func (doc Opml) Encode(w io.Writer) error {
 
 	return xml.NewEncoder(w).Encode(doc)
 }
+
+// Save writes the OPML document to the file at path. The document is written to
+// a temporary file first which is then renamed, so that the file at path is
+// never left partially written.
+func (doc Opml) Save(path string) error {
+	file, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+
+	if err := doc.Encode(file); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode()
+	}
+	if err := os.Chmod(file.Name(), mode); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
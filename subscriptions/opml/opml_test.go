@@ -3,6 +3,11 @@ package opml
 import (
 	"bytes"
 	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -75,3 +80,121 @@ func TestWrite(t *testing.T) {
 	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
 <opml version="2.0"><head><title>mySubscriptions.opml</title></head><body><outline type="rss" text="CNET News.com" xmlUrl="http://news.com.com/2547-1_3-0-5.xml" description="Tech news and business reports by CNET News.com. Focused on information technology, core topics include computers, hardware, software, networking, and Internet media." htmlUrl="http://news.com.com/" language="unknown" title="CNET News.com"></outline><outline type="rss" text="washingtonpost.com - Politics" xmlUrl="http://www.washingtonpost.com/wp-srv/politics/rssheadlines.xml" description="Politics" htmlUrl="http://www.washingtonpost.com/wp-dyn/politics?nav=rss_politics" language="unknown" title="washingtonpost.com - Politics"></outline></body></opml>`, buf.String())
 }
+
+func TestSave(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "riviera-opml-test")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "feeds.opml")
+	ioutil.WriteFile(path, []byte("old"), 0640)
+
+	doc := Opml{
+		Version: "1.1",
+		Head:    Head{Title: "Subscriptions"},
+		Body: Body{Outline: []Outline{
+			{Text: "Work", Outline: []Outline{
+				{Type: "rss", Text: "cool", XMLURL: "http://cool"},
+			}},
+		}},
+	}
+
+	assert.Nil(doc.Save(path))
+
+	info, _ := os.Stat(path)
+	assert.Equal(os.FileMode(0640), info.Mode())
+
+	files, _ := ioutil.ReadDir(dir)
+	assert.Len(files, 1)
+
+	read, err := Load(path)
+	assert.Nil(err)
+	assert.Equal(doc, read)
+}
+
+func TestLoadRemote(t *testing.T) {
+	assert := assert.New(t)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/feeds.opml" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, `<opml version="1.1"><body><outline type="rss" text="cool" xmlUrl="http://cool"/></body></opml>`)
+	}))
+	defer s.Close()
+
+	assert.True(IsRemote(s.URL))
+	assert.False(IsRemote("feeds.opml"))
+
+	doc, err := Load(s.URL + "/feeds.opml")
+	assert.Nil(err)
+	assert.Equal([]Outline{{Type: "rss", Text: "cool", XMLURL: "http://cool"}}, doc.Body.Outline)
+
+	_, err = Load(s.URL + "/missing.opml")
+	assert.NotNil(err)
+}
+
+func TestLoadIncludes(t *testing.T) {
+	assert := assert.New(t)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/team.opml":
+			io.WriteString(w, `<opml version="2.0"><body>
+  <outline type="rss" text="what" xmlUrl="http://what"/>
+  <outline type="include" text="More" url="more.opml"/>
+</body></opml>`)
+		case "/more.opml":
+			io.WriteString(w, `<opml version="2.0"><body><outline type="rss" text="hey" xmlUrl="http://hey"/></body></opml>`)
+		case "/loop.opml":
+			io.WriteString(w, `<opml version="2.0"><body><outline type="include" url="loop.opml"/></body></opml>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+
+	dir, _ := ioutil.TempDir("", "riviera-opml-test")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "feeds.opml")
+	ioutil.WriteFile(path, []byte(`<opml version="2.0"><body>
+  <outline type="rss" text="cool" xmlUrl="http://cool"/>
+  <outline text="Work">
+    <outline type="include" text="Team" url="`+s.URL+`/team.opml"/>
+  </outline>
+</body></opml>`), 0600)
+
+	doc, _ := Load(path)
+	doc = LoadIncludes(doc, path)
+	assert.Equal([]Outline{
+		{Type: "rss", Text: "cool", XMLURL: "http://cool"},
+		{Text: "Work", Outline: []Outline{
+			{Type: "include", Text: "Team", URL: s.URL + "/team.opml", Outline: []Outline{
+				{Type: "rss", Text: "what", XMLURL: "http://what"},
+				{Type: "include", Text: "More", URL: "more.opml", Outline: []Outline{
+					{Type: "rss", Text: "hey", XMLURL: "http://hey"},
+				}},
+			}},
+		}},
+	}, doc.Body.Outline)
+
+	// includes that fail are left empty
+	doc, _ = Load(s.URL + "/loop.opml")
+	doc = LoadIncludes(doc, s.URL+"/loop.opml")
+	assert.Equal([]Outline{
+		{Type: "include", URL: "loop.opml"},
+	}, doc.Body.Outline)
+
+	doc, _ = Read(strings.NewReader(`<opml><body>
+  <outline type="rss" text="cool" xmlUrl="http://cool"/>
+  <outline type="include" text="Missing" url="missing.opml"/>
+</body></opml>`))
+	doc = LoadIncludes(doc, s.URL+"/feeds.opml")
+	assert.Equal([]Outline{
+		{Type: "rss", Text: "cool", XMLURL: "http://cool"},
+		{Type: "include", Text: "Missing", URL: "missing.opml"},
+	}, doc.Body.Outline)
+}
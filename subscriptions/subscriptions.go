@@ -4,6 +4,7 @@ package subscriptions
 
 import (
 	"sort"
+	"strings"
 	"sync"
 
 	"hawx.me/code/riviera/subscriptions/opml"
@@ -12,25 +13,55 @@ import (
 // A List provides a read-only view to Subscriptions.
 type List interface {
 	List() []Subscription
+	Includes() []Include
 	Refresh(Subscription)
 }
 
 // Subscription represents the metadata for a single feed.
 type Subscription struct {
-	// URI the subscription was created with, never changed!
+	// URI the subscription was created with, only changed if the feed
+	// permanently moves.
 	URI string `json:"uri"`
 
 	FeedURL         string `json:"feedUrl"`
 	WebsiteURL      string `json:"websiteUrl"`
 	FeedTitle       string `json:"feedTitle"`
 	FeedDescription string `json:"feedDescription"`
+
+	// Folder is the path of the folder the subscription is grouped under, with
+	// the name of each nested folder separated by "/", or empty if it is not in
+	// a folder.
+	Folder string `json:"folder"`
+
+	// Include is the url of the included list that the subscription was read
+	// from, or empty if it was given directly.
+	Include string `json:"include"`
+
+	// Dead is true if the feed has gone, or failed for a long time, so is no
+	// longer fetched. It is written as a commented out outline.
+	Dead bool `json:"dead"`
+
+	// Extract is true if the page linked to by each new item should be fetched,
+	// so that the full article can be read.
+	Extract bool `json:"extract"`
+}
+
+// An Include is an outline that includes the subscriptions listed in another
+// OPML document.
+type Include struct {
+	URL  string `json:"url"`
+	Text string `json:"text"`
+
+	// Folder is the path of the folder the include outline is in.
+	Folder string `json:"folder"`
 }
 
 // Subscriptions is a list of subscriptions that is safe to access across
 // goroutines.
 type Subscriptions struct {
-	m  map[string]Subscription
-	mu sync.RWMutex
+	m        map[string]Subscription
+	includes []Include
+	mu       sync.RWMutex
 }
 
 // New returns an empty subscription list.
@@ -57,6 +88,30 @@ func (s *Subscriptions) List() []Subscription {
 	return l
 }
 
+// Includes returns the included lists that some Subscriptions were read from.
+func (s *Subscriptions) Includes() []Include {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]Include{}, s.includes...)
+}
+
+// SetIncludes replaces the included lists.
+func (s *Subscriptions) SetIncludes(includes []Include) {
+	s.mu.Lock()
+	s.includes = append([]Include{}, includes...)
+	s.mu.Unlock()
+}
+
+// Get the Subscription with url provided.
+func (s *Subscriptions) Get(uri string) (Subscription, bool) {
+	s.mu.RLock()
+	sub, ok := s.m[uri]
+	s.mu.RUnlock()
+
+	return sub, ok
+}
+
 // Add a new feed url to the list.
 func (s *Subscriptions) Add(uri string) {
 	s.mu.Lock()
@@ -79,10 +134,33 @@ func (s *Subscriptions) Remove(uri string) {
 }
 
 // FromOpml adds all feeds listed in an opml.Opml document to the Subscriptions.
+// Feeds nested within outlines that are not themselves feeds are put in a
+// folder, named by the path of those outlines. Outlines with a type of include
+// are treated as folders, their children should have been loaded with
+// opml.LoadIncludes. Feeds in commented out outlines are marked as dead.
 func FromOpml(doc opml.Opml) *Subscriptions {
 	s := New()
-	for _, e := range doc.Body.Outline {
+	s.addOutlines(doc.Body.Outline, "", "", false)
+	return s
+}
+
+func (s *Subscriptions) addOutlines(outlines []opml.Outline, folder, include string, dead bool) {
+	for _, e := range outlines {
+		commented := dead || e.IsComment == "true"
+
 		if e.Type != "rss" {
+			name := e.Text
+			if name == "" {
+				name = e.Title
+			}
+
+			childInclude := include
+			if e.Type == "include" && include == "" {
+				childInclude = e.URL
+				s.includes = append(s.includes, Include{URL: e.URL, Text: name, Folder: folder})
+			}
+
+			s.addOutlines(e.Outline, JoinFolder(folder, name), childInclude, commented)
 			continue
 		}
 
@@ -92,12 +170,18 @@ func FromOpml(doc opml.Opml) *Subscriptions {
 			URI:             e.XMLURL,
 			WebsiteURL:      e.HTMLURL,
 			FeedDescription: e.Description,
+			Folder:          folder,
+			Include:         include,
+			Dead:            commented,
+			Extract:         e.Extract == "true",
 		})
 	}
-	return s
 }
 
 // AsOpml returns a representation of the Subscriptions as an OMPL document.
+// Subscriptions in a folder are nested in an outline for each part of the
+// folder's path. Subscriptions read from an included list are not written,
+// instead the include outline is.
 func AsOpml(s List) opml.Opml {
 	l := opml.Opml{
 		Version: "1.1",
@@ -106,19 +190,106 @@ func AsOpml(s List) opml.Opml {
 	}
 
 	for _, e := range s.List() {
-		l.Body.Outline = append(l.Body.Outline, opml.Outline{
+		if e.Include != "" {
+			continue
+		}
+
+		outline := opml.Outline{
 			Type:        "rss",
 			Text:        e.FeedTitle,
 			XMLURL:      e.URI,
 			Description: e.FeedDescription,
 			HTMLURL:     e.WebsiteURL,
 			Title:       e.FeedTitle,
+		}
+		if e.Dead {
+			outline.IsComment = "true"
+		}
+		if e.Extract {
+			outline.Extract = "true"
+		}
+
+		outlines := folderOutlines(&l.Body.Outline, e.Folder)
+		*outlines = append(*outlines, outline)
+	}
+
+	for _, e := range s.Includes() {
+		outlines := folderOutlines(&l.Body.Outline, e.Folder)
+		*outlines = append(*outlines, opml.Outline{
+			Type: "include",
+			Text: e.Text,
+			URL:  e.URL,
 		})
 	}
 
 	return l
 }
 
+// folderOutlines returns the outlines within the folder at path, adding
+// outlines for each part of the path that does not exist.
+func folderOutlines(outlines *[]opml.Outline, path string) *[]opml.Outline {
+	if path == "" {
+		return outlines
+	}
+
+	for _, name := range strings.Split(path, "/") {
+		outlines = &folderOutline(outlines, name).Outline
+	}
+	return outlines
+}
+
+// folderOutline returns the outline for the folder with name in outlines,
+// adding one if it does not exist.
+func folderOutline(outlines *[]opml.Outline, name string) *opml.Outline {
+	for i, e := range *outlines {
+		if e.Type == "" && e.Text == name {
+			return &(*outlines)[i]
+		}
+	}
+
+	*outlines = append(*outlines, opml.Outline{Text: name, Title: name})
+	return &(*outlines)[len(*outlines)-1]
+}
+
+// JoinFolder returns the path of the folder with name in parent.
+func JoinFolder(parent, name string) string {
+	if parent == "" || name == "" {
+		return parent + name
+	}
+	return parent + "/" + name
+}
+
+// InFolder returns true if the Subscription is in folder, or one of its
+// subfolders.
+func (s Subscription) InFolder(folder string) bool {
+	return s.Folder == folder || strings.HasPrefix(s.Folder, folder+"/")
+}
+
+// Folders returns the path of each folder that contains a Subscription, along
+// with their parents, in order.
+func Folders(s List) []string {
+	set := map[string]struct{}{}
+	for _, e := range s.List() {
+		if e.Folder == "" {
+			continue
+		}
+
+		folder := ""
+		for _, name := range strings.Split(e.Folder, "/") {
+			folder = JoinFolder(folder, name)
+			set[folder] = struct{}{}
+		}
+	}
+
+	folders := []string{}
+	for folder := range set {
+		folders = append(folders, folder)
+	}
+	sort.Strings(folders)
+
+	return folders
+}
+
 type ChangeType int
 
 const (
@@ -131,19 +302,20 @@ type Change struct {
 	URI  string
 }
 
-// Diff finds the difference between two subscription lists.
+// Diff finds the difference between the feeds to fetch of two subscription
+// lists, dead subscriptions are treated as missing.
 func Diff(a, b *Subscriptions) (added, removed []string) {
 	a.mu.RLock()
 	b.mu.RLock()
 
 	for _, s := range a.m {
-		if _, ok := b.m[s.URI]; !ok {
+		if t, ok := b.m[s.URI]; !s.Dead && (!ok || t.Dead) {
 			removed = append(removed, s.URI)
 		}
 	}
 
 	for _, s := range b.m {
-		if _, ok := a.m[s.URI]; !ok {
+		if t, ok := a.m[s.URI]; !s.Dead && (!ok || t.Dead) {
 			added = append(added, s.URI)
 		}
 	}
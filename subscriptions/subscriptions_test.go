@@ -56,6 +56,80 @@ func TestDiffWhenChanged(t *testing.T) {
 	assert.Equal(t, []string{"http://example.com/feed2"}, removed)
 }
 
+func TestDiffWhenDead(t *testing.T) {
+	a := New()
+	a.Add("http://example.com/feed")
+	a.Refresh(Subscription{URI: "http://example.com/dead", Dead: true})
+
+	b := New()
+	b.Refresh(Subscription{URI: "http://example.com/feed", Dead: true})
+	b.Add("http://example.com/dead")
+
+	added, removed := Diff(a, b)
+	assert.Equal(t, []string{"http://example.com/dead"}, added)
+	assert.Equal(t, []string{"http://example.com/feed"}, removed)
+}
+
+func TestOpmlComments(t *testing.T) {
+	doc := opml.Opml{
+		Version: "1.1",
+		Head:    opml.Head{Title: "Subscriptions"},
+		Body: opml.Body{Outline: []opml.Outline{
+			{Type: "rss", Text: "a", Title: "a", XMLURL: "http://a", IsComment: "true"},
+			{Text: "Old", Title: "Old", IsComment: "true", Outline: []opml.Outline{
+				{Type: "rss", Text: "b", Title: "b", XMLURL: "http://b"},
+			}},
+			{Type: "rss", Text: "c", Title: "c", XMLURL: "http://c"},
+		}},
+	}
+
+	subs := FromOpml(doc)
+	assert.Equal(t, []Subscription{
+		{URI: "http://a", FeedURL: "http://a", FeedTitle: "a", Dead: true},
+		{URI: "http://b", FeedURL: "http://b", FeedTitle: "b", Folder: "Old", Dead: true},
+		{URI: "http://c", FeedURL: "http://c", FeedTitle: "c"},
+	}, subs.List())
+
+	// only the feeds are written as comments
+	assert.Equal(t, opml.Opml{
+		Version: "1.1",
+		Head:    opml.Head{Title: "Subscriptions"},
+		Body: opml.Body{Outline: []opml.Outline{
+			{Type: "rss", Text: "a", Title: "a", XMLURL: "http://a", IsComment: "true"},
+			{Text: "Old", Title: "Old", Outline: []opml.Outline{
+				{Type: "rss", Text: "b", Title: "b", XMLURL: "http://b", IsComment: "true"},
+			}},
+			{Type: "rss", Text: "c", Title: "c", XMLURL: "http://c"},
+		}},
+	}, AsOpml(subs))
+}
+
+func TestOpmlExtract(t *testing.T) {
+	doc := opml.Opml{
+		Version: "1.1",
+		Head:    opml.Head{Title: "Subscriptions"},
+		Body: opml.Body{Outline: []opml.Outline{
+			{Type: "rss", Text: "a", Title: "a", XMLURL: "http://a", Extract: "true"},
+			{Type: "rss", Text: "b", Title: "b", XMLURL: "http://b", Extract: "false"},
+		}},
+	}
+
+	subs := FromOpml(doc)
+	assert.Equal(t, []Subscription{
+		{URI: "http://a", FeedURL: "http://a", FeedTitle: "a", Extract: true},
+		{URI: "http://b", FeedURL: "http://b", FeedTitle: "b"},
+	}, subs.List())
+
+	assert.Equal(t, opml.Opml{
+		Version: "1.1",
+		Head:    opml.Head{Title: "Subscriptions"},
+		Body: opml.Body{Outline: []opml.Outline{
+			{Type: "rss", Text: "a", Title: "a", XMLURL: "http://a", Extract: "true"},
+			{Type: "rss", Text: "b", Title: "b", XMLURL: "http://b"},
+		}},
+	}, AsOpml(subs))
+}
+
 func TestFromOpml(t *testing.T) {
 	doc := opml.Opml{
 		Version: "1.1",
@@ -89,3 +163,111 @@ func TestFromOpml(t *testing.T) {
 		{URI: "yes", FeedTitle: "cool", FeedURL: "yes", WebsiteURL: "htmls", FeedDescription: "this desc"},
 	}, subs.List())
 }
+
+func TestOpmlFolders(t *testing.T) {
+	doc := opml.Opml{
+		Version: "1.1",
+		Body: opml.Body{Outline: []opml.Outline{
+			{Type: "rss", Text: "cool", XMLURL: "http://cool"},
+			{Text: "Work", Outline: []opml.Outline{
+				{Type: "rss", Text: "what", XMLURL: "http://what"},
+				{Type: "rss", Text: "hey", XMLURL: "http://hey"},
+			}},
+		}},
+	}
+
+	subs := FromOpml(doc)
+
+	assert.Equal(t, []Subscription{
+		{URI: "http://cool", FeedTitle: "cool", FeedURL: "http://cool"},
+		{URI: "http://hey", FeedTitle: "hey", FeedURL: "http://hey", Folder: "Work"},
+		{URI: "http://what", FeedTitle: "what", FeedURL: "http://what", Folder: "Work"},
+	}, subs.List())
+
+	assert.Equal(t, []opml.Outline{
+		{Type: "rss", Text: "cool", Title: "cool", XMLURL: "http://cool"},
+		{Text: "Work", Title: "Work", Outline: []opml.Outline{
+			{Type: "rss", Text: "hey", Title: "hey", XMLURL: "http://hey"},
+			{Type: "rss", Text: "what", Title: "what", XMLURL: "http://what"},
+		}},
+	}, AsOpml(subs).Body.Outline)
+}
+
+func TestOpmlNestedFolders(t *testing.T) {
+	doc := opml.Opml{
+		Version: "1.1",
+		Body: opml.Body{Outline: []opml.Outline{
+			{Text: "Work", Outline: []opml.Outline{
+				{Type: "rss", Text: "what", XMLURL: "http://what"},
+				{Text: "Go", Outline: []opml.Outline{
+					{Type: "rss", Text: "hey", XMLURL: "http://hey"},
+				}},
+			}},
+			{Title: "Play", Outline: []opml.Outline{
+				{Type: "rss", Text: "cool", XMLURL: "http://cool"},
+			}},
+		}},
+	}
+
+	subs := FromOpml(doc)
+
+	assert.Equal(t, []Subscription{
+		{URI: "http://cool", FeedTitle: "cool", FeedURL: "http://cool", Folder: "Play"},
+		{URI: "http://hey", FeedTitle: "hey", FeedURL: "http://hey", Folder: "Work/Go"},
+		{URI: "http://what", FeedTitle: "what", FeedURL: "http://what", Folder: "Work"},
+	}, subs.List())
+
+	assert.Equal(t, []string{"Play", "Work", "Work/Go"}, Folders(subs))
+
+	hey, _ := subs.Get("http://hey")
+	assert.True(t, hey.InFolder("Work"))
+	assert.True(t, hey.InFolder("Work/Go"))
+	assert.False(t, hey.InFolder("Wo"))
+
+	assert.Equal(t, []opml.Outline{
+		{Text: "Play", Title: "Play", Outline: []opml.Outline{
+			{Type: "rss", Text: "cool", Title: "cool", XMLURL: "http://cool"},
+		}},
+		{Text: "Work", Title: "Work", Outline: []opml.Outline{
+			{Text: "Go", Title: "Go", Outline: []opml.Outline{
+				{Type: "rss", Text: "hey", Title: "hey", XMLURL: "http://hey"},
+			}},
+			{Type: "rss", Text: "what", Title: "what", XMLURL: "http://what"},
+		}},
+	}, AsOpml(subs).Body.Outline)
+
+	// round trips
+	assert.Equal(t, subs.List(), FromOpml(AsOpml(subs)).List())
+}
+
+func TestOpmlIncludes(t *testing.T) {
+	doc := opml.Opml{
+		Version: "1.1",
+		Body: opml.Body{Outline: []opml.Outline{
+			{Type: "rss", Text: "cool", XMLURL: "http://cool"},
+			{Text: "Work", Outline: []opml.Outline{
+				{Type: "include", Text: "Team", URL: "http://example.com/team.opml", Outline: []opml.Outline{
+					{Type: "rss", Text: "what", XMLURL: "http://what"},
+				}},
+			}},
+		}},
+	}
+
+	subs := FromOpml(doc)
+
+	assert.Equal(t, []Subscription{
+		{URI: "http://cool", FeedTitle: "cool", FeedURL: "http://cool"},
+		{URI: "http://what", FeedTitle: "what", FeedURL: "http://what", Folder: "Work/Team", Include: "http://example.com/team.opml"},
+	}, subs.List())
+
+	assert.Equal(t, []Include{
+		{URL: "http://example.com/team.opml", Text: "Team", Folder: "Work"},
+	}, subs.Includes())
+
+	assert.Equal(t, []opml.Outline{
+		{Type: "rss", Text: "cool", Title: "cool", XMLURL: "http://cool"},
+		{Text: "Work", Title: "Work", Outline: []opml.Outline{
+			{Type: "include", Text: "Team", URL: "http://example.com/team.opml"},
+		}},
+	}, AsOpml(subs).Body.Outline)
+}